@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"charm.land/log/v2"
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/gencmd"
+	"github.com/arnarg/nilla-utils/internal/generation"
+	"github.com/arnarg/nilla-utils/internal/util"
+	"github.com/urfave/cli/v3"
+)
+
+func listGenerations(ctx context.Context, cmd *cli.Command) error {
+	util.InitLogger(verboseCount)
+
+	name := cmd.Args().First()
+	if name == "" {
+		return fmt.Errorf("MicroVM name is required")
+	}
+
+	format, err := gencmd.ParseFormat(cmd.String("format"))
+	if err != nil {
+		return err
+	}
+
+	return gencmd.List(ctx, generation.MicroVMSystem{Name: name}, "", gencmd.ListOptions{
+		Format: format,
+	})
+}
+
+func cleanGenerations(ctx context.Context, cmd *cli.Command) error {
+	util.InitLogger(verboseCount)
+
+	name := cmd.Args().First()
+	if name == "" {
+		return fmt.Errorf("MicroVM name is required")
+	}
+
+	format, err := gencmd.ParseFormat(cmd.String("format"))
+	if err != nil {
+		return err
+	}
+
+	var from, to *int
+	if cmd.IsSet("from") {
+		v := int(cmd.Int("from"))
+		from = &v
+	}
+	if cmd.IsSet("to") {
+		v := int(cmd.Int("to"))
+		to = &v
+	}
+
+	return gencmd.Clean(ctx, generation.MicroVMSystem{Name: name}, "", gencmd.CleanOptions{
+		Keep:    uint(cmd.Uint("keep")),
+		KeepSet: cmd.IsSet("keep"),
+		From:    from,
+		To:      to,
+		Confirm: cmd.Bool("confirm"),
+		SkipGC:  cmd.Bool("skip-gc"),
+		Format:  format,
+	})
+}
+
+func rollbackGenerations(ctx context.Context, cmd *cli.Command) error {
+	util.InitLogger(verboseCount)
+
+	name := cmd.Args().First()
+	if name == "" {
+		return fmt.Errorf("MicroVM name is required")
+	}
+
+	format, err := gencmd.ParseFormat(cmd.String("format"))
+	if err != nil {
+		return err
+	}
+
+	var id *int
+	if cmd.Args().Len() > 1 {
+		v, err := strconv.Atoi(cmd.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("invalid generation ID: %s", cmd.Args().Get(1))
+		}
+		id = &v
+	}
+
+	return gencmd.Rollback(ctx, generation.MicroVMSystem{Name: name, Restart: cmd.Bool("restart")}, "", gencmd.RollbackOptions{
+		ID:      id,
+		Confirm: cmd.Bool("confirm"),
+		Cleanup: cmd.Bool("cleanup"),
+		SkipGC:  cmd.Bool("skip-gc"),
+		Format:  format,
+	})
+}
+
+// recordRunner adds the runner that install or update just put in place to
+// the MicroVM's generation history. Failing to do so does not fail the
+// install or update itself.
+func recordRunner(ctx context.Context, name string) {
+	h, err := exec.NewHost(ctx, "", nil)
+	if err != nil {
+		log.Warnf("Failed to record MicroVM generation: %v", err)
+		return
+	}
+	defer h.Close()
+
+	if err := generation.RecordMicroVMRunner(ctx, h, name); err != nil {
+		log.Warnf("Failed to record MicroVM generation: %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"charm.land/log/v2"
+	"github.com/arnarg/nilla-utils/internal/audit"
 	"github.com/arnarg/nilla-utils/internal/diff"
 	"github.com/arnarg/nilla-utils/internal/exec"
 	"github.com/arnarg/nilla-utils/internal/microvm"
@@ -122,6 +123,33 @@ var app = &cli.Command{
 					Aliases: []string{"r"},
 					Usage:   "Restart the MicroVM after update",
 				},
+				&cli.StringFlag{
+					Name:  "diff-format",
+					Usage: "Also render the diff as json or markdown, to stdout or --diff-output",
+					Value: "terminal",
+				},
+				&cli.StringFlag{
+					Name:  "diff-output",
+					Usage: "Write the diff rendered by --diff-format to this file",
+				},
+				&cli.StringSliceFlag{
+					Name:  "why",
+					Usage: "Explain why a package is in the new runner by printing its shortest reference chain (can be repeated)",
+				},
+				&cli.BoolFlag{
+					Name:  "audit",
+					Usage: "Check the new runner against a local advisory database for known vulnerabilities",
+				},
+				&cli.StringFlag{
+					Name:    "advisory-db",
+					Usage:   "Path to an OSV advisory dump (a JSON file or a directory of them) used by --audit",
+					Sources: cli.EnvVars("NILLA_UTILS_ADVISORY_DB"),
+				},
+				&cli.StringFlag{
+					Name:    "advisory-ecosystem",
+					Usage:   "Only use advisories of this OSV ecosystem (e.g. \"Debian:12\") from --advisory-db, required when it mixes ecosystems",
+					Sources: cli.EnvVars("NILLA_UTILS_ADVISORY_ECOSYSTEM"),
+				},
 			},
 			Action: updateMicroVM,
 		},
@@ -159,6 +187,107 @@ var app = &cli.Command{
 			Description: "List MicroVMs in project",
 			Action:      listMicroVMs,
 		},
+
+		// Generations
+		{
+			Name:        "generations",
+			Aliases:     []string{"gen"},
+			Usage:       "Work with generations of an installed MicroVM",
+			Description: "Work with the runner generations of an installed MicroVM. Generations are recorded by install and update.",
+			Commands: []*cli.Command{
+				// List
+				{
+					Name:        "list",
+					Aliases:     []string{"ls"},
+					Usage:       "List MicroVM generations",
+					Description: fmt.Sprintf("List MicroVM generations, marking the current and the booted runner.\n\n%s", description),
+					ArgsUsage:   "<name>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json, csv or tsv)",
+							Value: "table",
+						},
+					},
+					Action: listGenerations,
+				},
+
+				// Clean
+				{
+					Name:        "clean",
+					Aliases:     []string{"c"},
+					Usage:       "Delete and garbage collect MicroVM generations",
+					Description: fmt.Sprintf("Delete and garbage collect MicroVM generations.\n\n%s", description),
+					ArgsUsage:   "<name>",
+					Flags: []cli.Flag{
+						&cli.UintFlag{
+							Name:    "keep",
+							Aliases: []string{"k"},
+							Usage:   "Number of generations to keep",
+							Value:   1,
+						},
+						&cli.BoolFlag{
+							Name:    "confirm",
+							Aliases: []string{"c"},
+							Usage:   "Do not ask for confirmation",
+						},
+						&cli.IntFlag{
+							Name:  "from",
+							Usage: "Lowest generation number to delete",
+						},
+						&cli.IntFlag{
+							Name:  "to",
+							Usage: "Highest generation number to delete",
+						},
+						&cli.BoolFlag{
+							Name:  "skip-gc",
+							Usage: "Skip garbage collection",
+						},
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json, csv or tsv)",
+							Value: "table",
+						},
+					},
+					Action: cleanGenerations,
+				},
+
+				// Rollback
+				{
+					Name:        "rollback",
+					Aliases:     []string{"rb"},
+					Usage:       "Roll a MicroVM back to a previous runner",
+					Description: fmt.Sprintf("Roll a MicroVM back to a previous runner. Defaults to the previous generation if no ID is given.\n\n%s", description),
+					ArgsUsage:   "<name> [ID]",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "confirm",
+							Aliases: []string{"c"},
+							Usage:   "Do not ask for confirmation",
+						},
+						&cli.BoolFlag{
+							Name:    "restart",
+							Aliases: []string{"r"},
+							Usage:   "Restart the MicroVM after rollback",
+						},
+						&cli.BoolFlag{
+							Name:  "cleanup",
+							Usage: "Clean up newer generations after rollback",
+						},
+						&cli.BoolFlag{
+							Name:  "skip-gc",
+							Usage: "Skip garbage collection",
+						},
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json, csv or tsv)",
+							Value: "table",
+						},
+					},
+					Action: rollbackGenerations,
+				},
+			},
+		},
 	},
 	Action: func(ctx context.Context, cmd *cli.Command) error {
 		if cmd.Args().Len() < 1 {
@@ -349,6 +478,8 @@ func installMicroVM(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("failed to install MicroVM: %w", err)
 	}
 
+	recordRunner(ctx, name)
+
 	return nil
 }
 
@@ -362,6 +493,17 @@ func updateMicroVM(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("MicroVM name is required")
 	}
 
+	diffOutput, err := diff.ParseOutput(cmd.String("diff-format"), cmd.String("diff-output"))
+	if err != nil {
+		return err
+	}
+	diffOutput.Why = cmd.StringSlice("why")
+
+	advisories, err := audit.Open(cmd.Bool("audit"), cmd.String("advisory-db"), cmd.String("advisory-ecosystem"))
+	if err != nil {
+		return err
+	}
+
 	// Check if exists
 	stateDir := getMicroVMStateDir(name)
 	if _, err := os.Stat(stateDir); err != nil {
@@ -408,19 +550,30 @@ func updateMicroVM(ctx context.Context, cmd *cli.Command) error {
 			fmt.Fprintln(os.Stderr)
 			printSection("Comparing changes")
 
-			localExec := exec.NewLocalExecutor()
-			if err := diff.Execute(
-				&diff.Generation{
-					Path:    oldSystemPath,
-					Querier: diff.NewExecutorQuerier(localExec),
-				},
-				&diff.Generation{
-					Path:    newSystemPath,
-					Querier: diff.NewExecutorQuerier(localExec),
-				},
-			); err != nil {
+			// The guest system is a NixOS toplevel, its packages are
+			// referenced by sw
+			querier := diff.NewCachedQuerier(exec.NewLocalExecutor(), diff.DefaultCache())
+			from := &diff.Generation{
+				Path:    oldSystemPath,
+				Querier: querier,
+				Roots:   []string{"sw"},
+			}
+			to := &diff.Generation{
+				Path:    newSystemPath,
+				Querier: querier,
+				Roots:   []string{"sw"},
+			}
+			if err := diff.Execute(from, to, diffOutput); err != nil {
 				log.Warnf("Failed to show diff: %v", err)
 			}
+
+			if advisories != nil {
+				fmt.Fprintln(os.Stderr)
+				printSection("Checking known vulnerabilities")
+				if _, err := audit.Execute(ctx, advisories, from, to, os.Stderr); err != nil {
+					log.Warnf("Failed to check vulnerabilities: %v", err)
+				}
+			}
 		}
 	}
 
@@ -455,6 +608,8 @@ func updateMicroVM(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("failed to update MicroVM: %w", err)
 	}
 
+	recordRunner(ctx, name)
+
 	return nil
 }
 
@@ -13,12 +13,55 @@ import (
 
 func listGenerations(ctx context.Context, cmd *cli.Command) error {
 	util.InitLogger(verboseCount)
-	return gencmd.List(ctx, generation.NixOSSystem{}, cmd.String("target"))
+
+	system, err := gencmd.GenerationSystem(cmd, generation.NixOSSystem{})
+	if err != nil {
+		return err
+	}
+
+	format, err := gencmd.ParseFormat(cmd.String("format"))
+	if err != nil {
+		return err
+	}
+
+	columns, err := gencmd.ParseColumns(cmd.StringSlice("columns"))
+	if err != nil {
+		return err
+	}
+
+	targets, err := gencmd.GenerationTargets(cmd, "systems.nixos", "NixOS")
+	if err != nil {
+		return err
+	}
+
+	opts := gencmd.ListOptions{
+		Format:  format,
+		Columns: columns,
+	}
+	if len(targets) > 1 {
+		return gencmd.ListHosts(ctx, system, targets, opts)
+	}
+	return gencmd.List(ctx, system, gencmd.FirstTarget(targets), opts)
 }
 
 func cleanGenerations(ctx context.Context, cmd *cli.Command) error {
 	util.InitLogger(verboseCount)
 
+	system, err := gencmd.GenerationSystem(cmd, generation.NixOSSystem{})
+	if err != nil {
+		return err
+	}
+
+	format, err := gencmd.ParseFormat(cmd.String("format"))
+	if err != nil {
+		return err
+	}
+
+	olderThan, err := gencmd.ParseAge(cmd.String("older-than"))
+	if err != nil {
+		return err
+	}
+
 	var from, to *int
 	if cmd.IsSet("from") {
 		v := int(cmd.Int("from"))
@@ -29,19 +72,45 @@ func cleanGenerations(ctx context.Context, cmd *cli.Command) error {
 		to = &v
 	}
 
-	return gencmd.Clean(ctx, generation.NixOSSystem{}, cmd.String("target"), gencmd.CleanOptions{
+	targets, err := gencmd.GenerationTargets(cmd, "systems.nixos", "NixOS")
+	if err != nil {
+		return err
+	}
+
+	opts := gencmd.CleanOptions{
 		Keep:    uint(cmd.Uint("keep")),
 		KeepSet: cmd.IsSet("keep"),
+		Retention: gencmd.Retention{
+			OlderThan:   olderThan,
+			KeepDaily:   uint(cmd.Uint("keep-daily")),
+			KeepWeekly:  uint(cmd.Uint("keep-weekly")),
+			KeepMonthly: uint(cmd.Uint("keep-monthly")),
+		},
 		From:    from,
 		To:      to,
 		Confirm: cmd.Bool("confirm"),
 		SkipGC:  cmd.Bool("skip-gc"),
-	})
+		Format:  format,
+	}
+	if len(targets) > 1 {
+		return gencmd.CleanHosts(ctx, system, targets, opts)
+	}
+	return gencmd.Clean(ctx, system, gencmd.FirstTarget(targets), opts)
 }
 
 func rollbackGenerations(ctx context.Context, cmd *cli.Command) error {
 	util.InitLogger(verboseCount)
 
+	system, err := gencmd.GenerationSystem(cmd, generation.NixOSSystem{})
+	if err != nil {
+		return err
+	}
+
+	format, err := gencmd.ParseFormat(cmd.String("format"))
+	if err != nil {
+		return err
+	}
+
 	var id *int
 	if cmd.Args().Len() > 0 {
 		v, err := strconv.Atoi(cmd.Args().First())
@@ -51,10 +120,80 @@ func rollbackGenerations(ctx context.Context, cmd *cli.Command) error {
 		id = &v
 	}
 
-	return gencmd.Rollback(ctx, generation.NixOSSystem{}, cmd.String("target"), gencmd.RollbackOptions{
+	target, err := gencmd.SingleTarget(cmd)
+	if err != nil {
+		return err
+	}
+
+	return gencmd.Rollback(ctx, system, target, gencmd.RollbackOptions{
 		ID:      id,
 		Confirm: cmd.Bool("confirm"),
 		Cleanup: cmd.Bool("cleanup"),
+		Boot:    cmd.Bool("boot"),
 		SkipGC:  cmd.Bool("skip-gc"),
+		Format:  format,
+	})
+}
+
+func logGenerations(ctx context.Context, cmd *cli.Command) error {
+	util.InitLogger(verboseCount)
+
+	system, err := gencmd.GenerationSystem(cmd, generation.NixOSSystem{})
+	if err != nil {
+		return err
+	}
+
+	var from, to *int
+	if cmd.IsSet("from") {
+		v := int(cmd.Int("from"))
+		from = &v
+	}
+	if cmd.IsSet("to") {
+		v := int(cmd.Int("to"))
+		to = &v
+	}
+
+	target, err := gencmd.SingleTarget(cmd)
+	if err != nil {
+		return err
+	}
+
+	return gencmd.Log(ctx, system, target, gencmd.LogOptions{
+		Limit:   uint(cmd.Uint("limit")),
+		From:    from,
+		To:      to,
+		Package: cmd.String("package"),
 	})
 }
+
+func pinGenerations(ctx context.Context, cmd *cli.Command) error {
+	return setPinned(ctx, cmd, true)
+}
+
+func unpinGenerations(ctx context.Context, cmd *cli.Command) error {
+	return setPinned(ctx, cmd, false)
+}
+
+func setPinned(ctx context.Context, cmd *cli.Command, pinned bool) error {
+	util.InitLogger(verboseCount)
+
+	system, err := gencmd.GenerationSystem(cmd, generation.NixOSSystem{})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Args().Len() < 1 {
+		return fmt.Errorf("missing generation ID")
+	}
+	id, err := strconv.Atoi(cmd.Args().First())
+	if err != nil {
+		return fmt.Errorf("invalid generation ID: %s", cmd.Args().First())
+	}
+
+	target, err := gencmd.SingleTarget(cmd)
+	if err != nil {
+		return err
+	}
+
+	return gencmd.Pin(ctx, system, target, id, pinned)
+}
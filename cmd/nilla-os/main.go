@@ -7,7 +7,9 @@ import (
 
 	"charm.land/log/v2"
 	"github.com/arnarg/nilla-utils/internal/askpass"
+	"github.com/arnarg/nilla-utils/internal/audit"
 	"github.com/arnarg/nilla-utils/internal/deploy"
+	"github.com/arnarg/nilla-utils/internal/diff"
 	"github.com/arnarg/nilla-utils/internal/nix"
 	"github.com/arnarg/nilla-utils/internal/project"
 	"github.com/arnarg/nilla-utils/internal/util"
@@ -59,6 +61,41 @@ var app = &cli.Command{
 			Name:  "raw",
 			Usage: "Raw output from Nix",
 		},
+		&cli.StringFlag{
+			Name:  "diff-format",
+			Usage: "Also render the diff as json or markdown, to stdout or --diff-output",
+			Value: "terminal",
+		},
+		&cli.StringFlag{
+			Name:  "diff-output",
+			Usage: "Write the diff rendered by --diff-format to this file",
+		},
+		&cli.StringSliceFlag{
+			Name:  "why",
+			Usage: "Explain why a package is in the new generation by printing its shortest reference chain (can be repeated)",
+		},
+		&cli.BoolFlag{
+			Name:  "diff-config",
+			Usage: "Also list changed systemd units, /etc files, kernel modules and firmware",
+		},
+		&cli.BoolFlag{
+			Name:  "diff-files",
+			Usage: "Show a unified diff of small changed configuration files and units (implies --diff-config)",
+		},
+		&cli.BoolFlag{
+			Name:  "audit",
+			Usage: "Check the new generation against a local advisory database for known vulnerabilities",
+		},
+		&cli.StringFlag{
+			Name:    "advisory-db",
+			Usage:   "Path to an OSV advisory dump (a JSON file or a directory of them) used by --audit",
+			Sources: cli.EnvVars("NILLA_UTILS_ADVISORY_DB"),
+		},
+		&cli.StringFlag{
+			Name:    "advisory-ecosystem",
+			Usage:   "Only use advisories of this OSV ecosystem (e.g. \"Debian:12\") from --advisory-db, required when it mixes ecosystems",
+			Sources: cli.EnvVars("NILLA_UTILS_ADVISORY_ECOSYSTEM"),
+		},
 		&cli.BoolFlag{
 			Name:    "notify",
 			Usage:   "Send a desktop notification when a build is ready for confirmation",
@@ -73,7 +110,7 @@ var app = &cli.Command{
 		&cli.StringFlag{
 			Name:    "target",
 			Aliases: []string{"t"},
-			Usage:   "Target host to deploy/activate on (for switch/test/boot commands). Can also be used with --build-on-target for builds.",
+			Usage:   "Target host to deploy/activate on (for switch/test/boot commands). Can also be used with --build-on-target for builds. Generations list and clean accept a comma-separated list of hosts.",
 		},
 		&cli.StringFlag{
 			Name:  "build-on",
@@ -172,6 +209,12 @@ var app = &cli.Command{
 			Aliases:     []string{"gen"},
 			Usage:       "Work with NixOS generations",
 			Description: "Work with NixOS generations",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "profile",
+					Usage: "Manage the generations of this Nix profile instead of the NixOS ones",
+				},
+			},
 			Commands: []*cli.Command{
 				// List
 				{
@@ -179,7 +222,50 @@ var app = &cli.Command{
 					Aliases:     []string{"ls"},
 					Usage:       "List NixOS generations",
 					Description: "List NixOS generations",
-					Action:      listGenerations,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json, csv or tsv)",
+							Value: "table",
+						},
+						&cli.BoolFlag{
+							Name:  "all-targets",
+							Usage: "Run on the target of every NixOS configuration in the project that has one",
+						},
+						&cli.StringSliceFlag{
+							Name:  "columns",
+							Usage: "Extra columns to show (revision, label, nixpkgs, size, specialisations)",
+						},
+					},
+					Action: listGenerations,
+				},
+
+				// Log
+				{
+					Name:        "log",
+					Usage:       "Show package changes between consecutive NixOS generations",
+					Description: "Show, newest first, the package changes and closure size delta of each NixOS generation compared to the one before it",
+					Flags: []cli.Flag{
+						&cli.UintFlag{
+							Name:    "limit",
+							Aliases: []string{"n"},
+							Usage:   "Maximum number of generations to show",
+						},
+						&cli.IntFlag{
+							Name:  "from",
+							Usage: "Lowest generation number to show",
+						},
+						&cli.IntFlag{
+							Name:  "to",
+							Usage: "Highest generation number to show",
+						},
+						&cli.StringFlag{
+							Name:    "package",
+							Aliases: []string{"p"},
+							Usage:   "Only show changes to packages whose name contains this string",
+						},
+					},
+					Action: logGenerations,
 				},
 
 				// Clean
@@ -195,6 +281,22 @@ var app = &cli.Command{
 							Usage:   "Number of generations to keep",
 							Value:   1,
 						},
+						&cli.StringFlag{
+							Name:  "older-than",
+							Usage: "Only delete generations older than this age (e.g. 30d, 2w)",
+						},
+						&cli.UintFlag{
+							Name:  "keep-daily",
+							Usage: "Keep the newest generation of each of the last N days with generations",
+						},
+						&cli.UintFlag{
+							Name:  "keep-weekly",
+							Usage: "Keep the newest generation of each of the last N weeks with generations",
+						},
+						&cli.UintFlag{
+							Name:  "keep-monthly",
+							Usage: "Keep the newest generation of each of the last N months with generations",
+						},
 						&cli.BoolFlag{
 							Name:    "confirm",
 							Aliases: []string{"c"},
@@ -208,14 +310,41 @@ var app = &cli.Command{
 							Name:  "to",
 							Usage: "Highest generation number to delete",
 						},
+						&cli.BoolFlag{
+							Name:  "all-targets",
+							Usage: "Run on the target of every NixOS configuration in the project that has one",
+						},
 						&cli.BoolFlag{
 							Name:  "skip-gc",
 							Usage: "Skip garbage collection",
 						},
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json, csv or tsv)",
+							Value: "table",
+						},
 					},
 					Action: cleanGenerations,
 				},
 
+				// Pin
+				{
+					Name:        "pin",
+					Usage:       "Protect a NixOS generation from cleanup",
+					Description: "Protect a NixOS generation from being deleted by clean and rollback --cleanup, and register it as a garbage collector root",
+					ArgsUsage:   "ID",
+					Action:      pinGenerations,
+				},
+
+				// Unpin
+				{
+					Name:        "unpin",
+					Usage:       "Allow a pinned NixOS generation to be cleaned up again",
+					Description: "Allow a pinned NixOS generation to be cleaned up again",
+					ArgsUsage:   "ID",
+					Action:      unpinGenerations,
+				},
+
 				// Rollback
 				{
 					Name:        "rollback",
@@ -233,10 +362,19 @@ var app = &cli.Command{
 							Name:  "cleanup",
 							Usage: "Clean up newer generations after rollback",
 						},
+						&cli.BoolFlag{
+							Name:  "boot",
+							Usage: "Only make the generation the boot default, without activating it",
+						},
 						&cli.BoolFlag{
 							Name:  "skip-gc",
 							Usage: "Skip garbage collection",
 						},
+						&cli.StringFlag{
+							Name:  "format",
+							Usage: "Output format (table, json, csv or tsv)",
+							Value: "table",
+						},
 					},
 					Action: rollbackGenerations,
 				},
@@ -279,6 +417,19 @@ func printSection(text string) {
 func run(ctx context.Context, cmd *cli.Command, sc deploy.Command) error {
 	util.InitLogger(verboseCount)
 
+	diffOutput, err := diff.ParseOutput(cmd.String("diff-format"), cmd.String("diff-output"))
+	if err != nil {
+		return err
+	}
+	diffOutput.Why = cmd.StringSlice("why")
+	diffOutput.Texts = cmd.Bool("diff-files")
+	diffOutput.Config = diffOutput.Texts || cmd.Bool("diff-config")
+
+	advisories, err := audit.Open(cmd.Bool("audit"), cmd.String("advisory-db"), cmd.String("advisory-ecosystem"))
+	if err != nil {
+		return err
+	}
+
 	plan, err := deploy.ResolvePlan(deploy.Options{
 		ProjectPath: cmd.String("project"),
 		Name:        cmd.Args().First(),
@@ -293,6 +444,8 @@ func run(ctx context.Context, cmd *cli.Command, sc deploy.Command) error {
 		OutLink:     cmd.String("out-link"),
 		Confirm:     cmd.Bool("confirm"),
 		Notify:      cmd.Bool("notify"),
+		DiffOutput:  diffOutput,
+		Audit:       advisories,
 	}, deploy.NixOSSystem{})
 	if err != nil {
 		return err
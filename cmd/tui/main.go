@@ -49,7 +49,7 @@ var app = &cli.Command{
 
 type delayReader struct {
 	r        io.Reader
-	maxDelay uint64
+	maxDelay uint
 }
 
 func (r *delayReader) Read(p []byte) (int, error) {
@@ -0,0 +1,275 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/diff"
+)
+
+// Advisory is a known vulnerability in the OSV format, reduced to the fields
+// needed to match it against packages.
+type Advisory struct {
+	ID       string     `json:"id"`
+	Aliases  []string   `json:"aliases"`
+	Summary  string     `json:"summary"`
+	Affected []affected `json:"affected"`
+}
+
+type affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges   []versionRange `json:"ranges"`
+	Versions []string       `json:"versions"`
+}
+
+type versionRange struct {
+	Type   string  `json:"type"`
+	Events []event `json:"events"`
+}
+
+type event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// CVE returns the CVE identifier of a, falling back to its ID.
+func (a *Advisory) CVE() string {
+	if strings.HasPrefix(a.ID, "CVE-") {
+		return a.ID
+	}
+	for _, alias := range a.Aliases {
+		if strings.HasPrefix(alias, "CVE-") {
+			return alias
+		}
+	}
+	return a.ID
+}
+
+// DB is an advisory database indexed by lower-cased package name.
+//
+// Package names only identify a package within an OSV ecosystem, so a DB
+// holds the entries of a single ecosystem. Either the ecosystem is given, and
+// entries of all others are skipped, or the dump must not mix ecosystems.
+type DB struct {
+	byName    map[string][]*Advisory
+	ecosystem string
+	// seen holds the ecosystems found while loading, without their release
+	// suffix ("Debian" for "Debian:12").
+	seen map[string]bool
+}
+
+// Load reads an advisory database from path, which is either a directory of
+// OSV JSON files, as found in an extracted OSV dump, or a single file with
+// one advisory or a JSON array of them. Nothing is fetched from the network.
+//
+// When ecosystem is set, such as "Debian" or "Debian:12", only entries of
+// that ecosystem are used. Otherwise loading fails if the dump has entries of
+// more than one ecosystem.
+func Load(path, ecosystem string) (*DB, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("advisory database: %w", err)
+	}
+
+	db := &DB{byName: map[string][]*Advisory{}, ecosystem: ecosystem, seen: map[string]bool{}}
+
+	if !fi.IsDir() {
+		err = db.loadFile(path)
+	} else {
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Ext(p) != ".json" {
+				return nil
+			}
+			return db.loadFile(p)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ecosystem == "" && len(db.seen) > 1 {
+		names := slices.Sorted(maps.Keys(db.seen))
+		return nil, fmt.Errorf("advisory database %s mixes the ecosystems %s, choose one with --advisory-ecosystem",
+			path, strings.Join(names, ", "))
+	}
+	return db, nil
+}
+
+// Open loads the database at path when enabled is set, for the --audit flag.
+// It returns nil when auditing is disabled.
+func Open(enabled bool, path, ecosystem string) (*DB, error) {
+	if !enabled {
+		return nil, nil
+	}
+	if path == "" {
+		return nil, fmt.Errorf("--audit requires --advisory-db or NILLA_UTILS_ADVISORY_DB")
+	}
+	return Load(path, ecosystem)
+}
+
+func (db *DB) loadFile(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("advisory database: %w", err)
+	}
+
+	advisories, err := decodeAdvisories(buf)
+	if err != nil {
+		return fmt.Errorf("advisory database %s: %w", path, err)
+	}
+	for _, a := range advisories {
+		db.add(a)
+	}
+	return nil
+}
+
+func decodeAdvisories(buf []byte) ([]*Advisory, error) {
+	buf = bytes.TrimSpace(buf)
+	if len(buf) > 0 && buf[0] == '[' {
+		var advisories []*Advisory
+		if err := json.Unmarshal(buf, &advisories); err != nil {
+			return nil, err
+		}
+		return advisories, nil
+	}
+
+	var a Advisory
+	if err := json.Unmarshal(buf, &a); err != nil {
+		return nil, err
+	}
+	return []*Advisory{&a}, nil
+}
+
+func (db *DB) add(a *Advisory) {
+	seen := map[string]bool{}
+	for _, aff := range a.Affected {
+		if !db.wants(aff) {
+			continue
+		}
+		if base, _, _ := strings.Cut(aff.Package.Ecosystem, ":"); base != "" {
+			db.seen[base] = true
+		}
+
+		name := strings.ToLower(aff.Package.Name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		db.byName[name] = append(db.byName[name], a)
+	}
+}
+
+// wants reports whether aff belongs to the ecosystem of db. An ecosystem
+// without a release suffix matches all of its releases.
+func (db *DB) wants(aff affected) bool {
+	if db.ecosystem == "" {
+		return true
+	}
+	eco := aff.Package.Ecosystem
+	if strings.EqualFold(eco, db.ecosystem) {
+		return true
+	}
+	base, _, _ := strings.Cut(eco, ":")
+	return !strings.Contains(db.ecosystem, ":") && strings.EqualFold(base, db.ecosystem)
+}
+
+// Match returns the advisories affecting version v of package name.
+func (db *DB) Match(name diff.PackageName, v diff.Version) []*Advisory {
+	if v == "" {
+		return nil
+	}
+
+	lname := strings.ToLower(string(name))
+	var out []*Advisory
+	for _, a := range db.byName[lname] {
+		for _, aff := range a.Affected {
+			if strings.ToLower(aff.Package.Name) == lname && db.wants(aff) && aff.affects(v) {
+				out = append(out, a)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// affects reports whether v is listed in the affected versions or falls in
+// one of the affected ranges. Git commit ranges cannot be matched against
+// store paths and are ignored.
+func (aff affected) affects(v diff.Version) bool {
+	for _, listed := range aff.Versions {
+		if c, ok := diff.CompareVersions(v, diff.Version(listed)); ok && c == 0 {
+			return true
+		}
+	}
+	for _, r := range aff.Ranges {
+		if r.Type != "GIT" && r.affects(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects evaluates the events of r in version order, as described by the
+// OSV schema: v is affected after an introduced event it is not older than,
+// until a fixed event it is not older than or a last_affected event it is
+// newer than. A version that cannot be parsed is unknown rather than
+// affected, even by ranges introduced at "0".
+func (r versionRange) affects(v diff.Version) bool {
+	if _, ok := diff.CompareVersions(v, v); !ok {
+		return false
+	}
+
+	events := slices.Clone(r.Events)
+	slices.SortStableFunc(events, func(a, b event) int {
+		c, _ := diff.CompareVersions(diff.Version(a.version()), diff.Version(b.version()))
+		return c
+	})
+
+	vulnerable := false
+	for _, e := range events {
+		switch {
+		case e.Introduced != "":
+			if e.Introduced == "0" || atLeast(v, e.Introduced) {
+				vulnerable = true
+			}
+		case e.Fixed != "":
+			if atLeast(v, e.Fixed) {
+				vulnerable = false
+			}
+		case e.LastAffected != "":
+			if c, ok := diff.CompareVersions(v, diff.Version(e.LastAffected)); ok && c > 0 {
+				vulnerable = false
+			}
+		}
+	}
+	return vulnerable
+}
+
+func (e event) version() string {
+	switch {
+	case e.Introduced != "":
+		return e.Introduced
+	case e.Fixed != "":
+		return e.Fixed
+	}
+	return e.LastAffected
+}
+
+func atLeast(v diff.Version, bound string) bool {
+	c, ok := diff.CompareVersions(v, diff.Version(bound))
+	return ok && c >= 0
+}
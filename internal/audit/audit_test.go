@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/diff"
+	"github.com/go-test/deep"
+)
+
+const advisoriesJSON = `[
+  {
+    "id": "CVE-2023-0286",
+    "summary": "X.400 address type confusion",
+    "affected": [{
+      "package": {"name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "3.0.0"}, {"fixed": "3.0.8"}]}]
+    }]
+  },
+  {
+    "id": "GHSA-xxxx-yyyy-zzzz",
+    "aliases": ["CVE-2024-6387"],
+    "summary": "regreSSHion",
+    "affected": [{
+      "package": {"name": "OpenSSH"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "8.5"}, {"last_affected": "9.7p1"}]}]
+    }]
+  },
+  {
+    "id": "CVE-2022-37434",
+    "summary": "inflateGetHeader heap overflow",
+    "affected": [{
+      "package": {"name": "zlib"},
+      "versions": ["1.2.12"]
+    }]
+  }
+]`
+
+func writeAdvisories(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "advisories.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Load(writeAdvisories(t, advisoriesJSON), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+const mixedJSON = `[
+  {
+    "id": "DSA-5343-1",
+    "aliases": ["CVE-2023-0286"],
+    "affected": [{
+      "package": {"ecosystem": "Debian:11", "name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.1.1n-0+deb11u4"}]}]
+    }]
+  },
+  {
+    "id": "DLA-3325-1",
+    "aliases": ["CVE-2023-0286"],
+    "affected": [{
+      "package": {"ecosystem": "Debian:10", "name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.1.1n-0+deb10u4"}]}]
+    }]
+  },
+  {
+    "id": "USN-5844-1",
+    "aliases": ["CVE-2023-0286"],
+    "affected": [{
+      "package": {"ecosystem": "Ubuntu:22.04:LTS", "name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}]}]
+    }]
+  },
+  {
+    "id": "DSA-5417-1",
+    "aliases": ["CVE-2023-2650"],
+    "affected": [{
+      "package": {"ecosystem": "Debian:12", "name": "openssl"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}]}]
+    }]
+  }
+]`
+
+func TestMatch(t *testing.T) {
+	db := testDB(t)
+
+	tests := []struct {
+		name    string
+		pkg     diff.PackageName
+		version diff.Version
+		want    []string
+	}{
+		{"in range", "openssl", "3.0.7", []string{"CVE-2023-0286"}},
+		{"output suffix", "openssl", "3.0.7-bin", []string{"CVE-2023-0286"}},
+		{"fixed", "openssl", "3.0.8", nil},
+		{"before introduced", "openssl", "1.1.1w", nil},
+		{"last affected", "openssh", "9.7p1", []string{"CVE-2024-6387"}},
+		{"after last affected", "openssh", "9.8p1", nil},
+		{"listed version", "zlib", "1.2.12", []string{"CVE-2022-37434"}},
+		{"unlisted version", "zlib", "1.3", nil},
+		{"no version", "openssl", "", nil},
+		{"unknown package", "bash", "5.2", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range db.Match(tt.pkg, tt.version) {
+				got = append(got, a.CVE())
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "CVE-2022-37434.json"), []byte(`{
+		"id": "CVE-2022-37434",
+		"affected": [{"package": {"name": "zlib"}, "versions": ["1.2.12"]}]
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Match("zlib", "1.2.12"); len(got) != 1 {
+		t.Errorf("expected 1 advisory, got %d", len(got))
+	}
+}
+
+func TestCompare(t *testing.T) {
+	db := testDB(t)
+
+	before := []diff.Package{
+		{Name: "openssl", Version: "3.0.7"},
+		{Name: "openssl", Version: "3.0.7-bin"},
+		{Name: "zlib", Version: "1.2.12"},
+	}
+	after := []diff.Package{
+		{Name: "openssl", Version: "3.0.8"},
+		{Name: "openssh", Version: "9.6p1"},
+		{Name: "zlib", Version: "1.2.12"},
+	}
+
+	r := Compare(db, before, after)
+
+	ids := func(fs []Finding) []string {
+		var out []string
+		for _, f := range fs {
+			out = append(out, f.Advisory.CVE())
+		}
+		return out
+	}
+	if diff := deep.Equal(ids(r.Introduced), []string{"CVE-2024-6387"}); diff != nil {
+		t.Errorf("Introduced: %v", diff)
+	}
+	if diff := deep.Equal(ids(r.Fixed), []string{"CVE-2023-0286"}); diff != nil {
+		t.Errorf("Fixed: %v", diff)
+	}
+	if diff := deep.Equal(ids(r.Present), []string{"CVE-2022-37434"}); diff != nil {
+		t.Errorf("Present: %v", diff)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if db, err := Open(false, "", ""); db != nil || err != nil {
+		t.Errorf("Open(false) = %v, %v", db, err)
+	}
+	if _, err := Open(true, "", ""); err == nil {
+		t.Error("expected an error without a database path")
+	}
+}
+
+func TestLoadEcosystem(t *testing.T) {
+	path := writeAdvisories(t, mixedJSON)
+
+	if _, err := Load(path, ""); err == nil {
+		t.Error("expected an error for a dump mixing ecosystems")
+	}
+
+	tests := []struct {
+		ecosystem string
+		want      []string
+	}{
+		{"Debian", []string{"DSA-5343-1", "DLA-3325-1", "DSA-5417-1"}},
+		{"debian:12", []string{"DSA-5417-1"}},
+		{"Ubuntu:22.04:LTS", []string{"USN-5844-1"}},
+		{"Alpine", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ecosystem, func(t *testing.T) {
+			db, err := Load(path, tt.ecosystem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, a := range db.Match("openssl", "1.1.1m") {
+				got = append(got, a.ID)
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestMatchUnparseableVersion(t *testing.T) {
+	db, err := Load(writeAdvisories(t, mixedJSON), "Debian:12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A range introduced at "0" affects every known version, but not one
+	// that cannot be ordered.
+	if got := db.Match("openssl", "git"); len(got) != 0 {
+		t.Errorf("expected no match for an unparseable version, got %d", len(got))
+	}
+}
+
+func TestCompareByCVE(t *testing.T) {
+	db, err := Load(writeAdvisories(t, mixedJSON), "Debian")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// DSA-5343-1 and DLA-3325-1 are both CVE-2023-0286, reported once.
+	r := Compare(db, nil, []diff.Package{{Name: "openssl", Version: "1.1.1m"}})
+	var got []string
+	for _, f := range r.Introduced {
+		got = append(got, f.Advisory.CVE())
+	}
+	if diff := deep.Equal(got, []string{"CVE-2023-0286", "CVE-2023-2650"}); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	"charm.land/lipgloss/v2"
+	"github.com/arnarg/nilla-utils/internal/diff"
+)
+
+var (
+	colorIntroduced = lipgloss.Color("1")
+	colorFixed      = lipgloss.Color("2")
+	colorPresent    = lipgloss.Color("3")
+	colorMuted      = lipgloss.Color("8")
+)
+
+// Finding is an advisory affecting a package of a generation.
+type Finding struct {
+	Advisory *Advisory
+	Package  diff.PackageName
+	Version  diff.Version
+}
+
+// Report holds the findings introduced by the new generation, fixed by it and
+// present in both.
+type Report struct {
+	Introduced []Finding
+	Fixed      []Finding
+	Present    []Finding
+}
+
+type findingKey struct {
+	cve string
+	pkg diff.PackageName
+}
+
+// Compare matches the packages of both generations against db.
+func Compare(db *DB, before, after []diff.Package) Report {
+	old := findings(db, before)
+	cur := findings(db, after)
+
+	var r Report
+	for k, f := range cur {
+		if _, ok := old[k]; ok {
+			r.Present = append(r.Present, f)
+		} else {
+			r.Introduced = append(r.Introduced, f)
+		}
+	}
+	for k, f := range old {
+		if _, ok := cur[k]; !ok {
+			r.Fixed = append(r.Fixed, f)
+		}
+	}
+
+	for _, fs := range [][]Finding{r.Introduced, r.Fixed, r.Present} {
+		slices.SortFunc(fs, func(a, b Finding) int {
+			if c := cmp.Compare(a.Package, b.Package); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Advisory.CVE(), b.Advisory.CVE())
+		})
+	}
+	return r
+}
+
+// findings matches every package against db, keyed by CVE and package so
+// that a CVE matching several outputs of a package, or published in several
+// advisories, counts once.
+func findings(db *DB, pkgs []diff.Package) map[findingKey]Finding {
+	out := map[findingKey]Finding{}
+	for _, p := range pkgs {
+		for _, a := range db.Match(p.Name, p.Version) {
+			k := findingKey{cve: a.CVE(), pkg: p.Name}
+			if _, ok := out[k]; !ok {
+				out[k] = Finding{Advisory: a, Package: p.Name, Version: p.Version}
+			}
+		}
+	}
+	return out
+}
+
+// Execute queries the packages of both generations, matches them against db
+// and prints the report to w.
+func Execute(ctx context.Context, db *DB, from, to *diff.Generation, w io.Writer) (Report, error) {
+	before, err := from.Querier.QueryPackages(ctx, from.Path)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to query from generation: %w", err)
+	}
+
+	after, err := to.Querier.QueryPackages(ctx, to.Path)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to query to generation: %w", err)
+	}
+
+	r := Compare(db, before, after)
+	r.Render(w)
+	return r, nil
+}
+
+// Render prints the findings grouped by whether they were introduced, fixed
+// or are still present.
+func (r Report) Render(w io.Writer) {
+	if len(r.Introduced)+len(r.Fixed)+len(r.Present) == 0 {
+		fmt.Fprintln(w, "No known vulnerabilities.")
+		return
+	}
+
+	for _, sec := range []struct {
+		title    string
+		findings []Finding
+		clr      lipgloss.Style
+	}{
+		{"Vulnerabilities introduced", r.Introduced, lipgloss.NewStyle().Foreground(colorIntroduced).Bold(true)},
+		{"Vulnerabilities fixed", r.Fixed, lipgloss.NewStyle().Foreground(colorFixed)},
+		{"Vulnerabilities still present", r.Present, lipgloss.NewStyle().Foreground(colorPresent)},
+	} {
+		if len(sec.findings) == 0 {
+			continue
+		}
+
+		idWidth, nameWidth := 0, 0
+		for _, f := range sec.findings {
+			idWidth = max(idWidth, len(f.Advisory.CVE()))
+			nameWidth = max(nameWidth, len(f.Package)+len(f.Version)+1)
+		}
+
+		fmt.Fprintf(w, "%s (%d):\n", sec.title, len(sec.findings))
+		for _, f := range sec.findings {
+			id := sec.clr.Width(idWidth).Render(f.Advisory.CVE())
+			pkg := lipgloss.NewStyle().Width(nameWidth).Render(fmt.Sprintf("%s %s", f.Package, f.Version))
+			summary := lipgloss.NewStyle().Foreground(colorMuted).Render(f.Advisory.Summary)
+			fmt.Fprintf(w, "  %s  %s  %s\n", id, pkg, summary)
+		}
+	}
+}
@@ -73,7 +73,7 @@ func TestResolveCopy(t *testing.T) {
 
 func TestConfirm(t *testing.T) {
 	t.Run("skip returns true without error", func(t *testing.T) {
-		ok, err := Confirm(true)
+		ok, err := Confirm(true, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -41,10 +41,14 @@ func (HomeSystem) CurrentGeneration(executor exec.Executor, name string) (*Gener
 	}
 	return &Generation{
 		Path:    path,
-		Querier: diff.NewExecutorQuerier(executor),
+		Querier: diff.NewCachedQuerier(executor, diff.DefaultCache()),
 	}, nil
 }
 
+func (HomeSystem) DiffRoots() []string {
+	return []string{"home-path"}
+}
+
 func (HomeSystem) Activate(ctx context.Context, executor exec.Executor, outPath string, cmd Command) error {
 	if cmd != Switch {
 		return nil
@@ -30,10 +30,14 @@ func (NixOSSystem) AttrPath(name string) string {
 func (NixOSSystem) CurrentGeneration(executor exec.Executor, _ string) (*Generation, error) {
 	return &Generation{
 		Path:    currentProfile,
-		Querier: diff.NewExecutorQuerier(executor),
+		Querier: diff.NewCachedQuerier(executor, diff.DefaultCache()),
 	}, nil
 }
 
+func (NixOSSystem) DiffRoots() []string {
+	return []string{"sw"}
+}
+
 func (NixOSSystem) Activate(ctx context.Context, target exec.Executor, outPath string, cmd Command) error {
 	if cmd == Test || cmd == Switch {
 		fmt.Fprintln(os.Stderr)
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"charm.land/log/v2"
+	"github.com/arnarg/nilla-utils/internal/audit"
+	"github.com/arnarg/nilla-utils/internal/diff"
 	"github.com/arnarg/nilla-utils/internal/nix"
 	"github.com/arnarg/nilla-utils/internal/project"
 	"github.com/arnarg/nilla-utils/internal/util"
@@ -51,6 +53,11 @@ type Options struct {
 
 	Confirm bool
 	Notify  bool
+
+	DiffOutput diff.Output
+	// Audit is the advisory database the new generation is checked against
+	// after diffing, nil to skip the check.
+	Audit *audit.DB
 }
 
 type Plan struct {
@@ -72,6 +79,9 @@ type Plan struct {
 
 	Confirm bool
 	Notify  bool
+
+	DiffOutput diff.Output
+	Audit      *audit.DB
 }
 
 func ResolvePlan(opts Options, sys System) (*Plan, error) {
@@ -134,5 +144,7 @@ func ResolvePlan(opts Options, sys System) (*Plan, error) {
 		OutLink:      opts.OutLink,
 		Confirm:      opts.Confirm,
 		Notify:       opts.Notify,
+		DiffOutput:   opts.DiffOutput,
+		Audit:        opts.Audit,
 	}, nil
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"charm.land/log/v2"
+	"github.com/arnarg/nilla-utils/internal/audit"
 	"github.com/arnarg/nilla-utils/internal/diff"
 	"github.com/arnarg/nilla-utils/internal/exec"
 	"github.com/arnarg/nilla-utils/internal/nix"
@@ -130,24 +131,47 @@ func (s *Session) Diff(ctx context.Context, outPath string) error {
 
 	log.Debugf("Running diff: current=%s, new=%s", current.Path, outPath)
 
-	if err := diff.Execute(
-		&diff.Generation{Path: current.Path, Querier: current.Querier},
-		&diff.Generation{Path: outPath, Querier: diff.NewExecutorQuerier(s.forDiff)},
-	); err != nil {
+	roots := s.System.DiffRoots()
+	from := &diff.Generation{Path: current.Path, Querier: current.Querier, Roots: roots}
+	to := &diff.Generation{Path: outPath, Querier: diff.NewCachedQuerier(s.forDiff, diff.DefaultCache()), Roots: roots}
+	if err := diff.Execute(from, to, s.Plan.DiffOutput); err != nil {
 		log.Debugf("Diff execution failed with error: %v", err)
 		return fmt.Errorf("failed to compare changes: %w", err)
 	}
 	log.Debugf("Diff execution completed successfully")
 
+	if s.Plan.Audit != nil {
+		fmt.Fprintln(os.Stderr)
+		printSection("Checking known vulnerabilities")
+		if _, err := audit.Execute(ctx, s.Plan.Audit, from, to, os.Stderr); err != nil {
+			return fmt.Errorf("failed to check vulnerabilities: %w", err)
+		}
+	}
+
 	return nil
 }
 
-func Confirm(skip bool) (bool, error) {
+// Confirm asks whether to continue, unless skip is set. why lets the user
+// look up why a package is part of the new generation before answering.
+func Confirm(skip bool, why tui.WhyFunc) (bool, error) {
 	if skip {
 		return true, nil
 	}
 
-	return tui.RunConfirm("Do you want to continue?")
+	return tui.RunConfirmWhy("Do you want to continue?", why)
+}
+
+// why explains packages in the closure of outPath, querying the store the new
+// generation was built in.
+func (s *Session) why(ctx context.Context, outPath string) tui.WhyFunc {
+	q := diff.NewExecutorQuerier(s.forDiff)
+	return func(pkg string) (string, error) {
+		chain, err := q.WhyDepends(ctx, outPath, diff.PackageName(pkg))
+		if err != nil {
+			return "", err
+		}
+		return diff.FormatWhy(chain), nil
+	}
 }
 
 func (s *Session) Copy(ctx context.Context, outPath string) error {
@@ -192,7 +216,7 @@ func (s *Session) Run(ctx context.Context) error {
 		_ = beeep.Notify("nilla-utils", fmt.Sprintf("%s '%s' ready, awaiting confirmation", s.Plan.SubCmd, s.Plan.Name), "")
 	}
 
-	ok, err := Confirm(s.Plan.Confirm)
+	ok, err := Confirm(s.Plan.Confirm, s.why(ctx, outPath))
 	if err != nil || !ok {
 		return err
 	}
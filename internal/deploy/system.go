@@ -17,4 +17,8 @@ type System interface {
 	AttrPath(name string) string
 	CurrentGeneration(executor exec.Executor, name string) (*Generation, error)
 	Activate(ctx context.Context, executor exec.Executor, outPath string, cmd Command) error
+	// DiffRoots returns the paths, relative to a generation, whose direct
+	// references are the packages the user asked for. The diff lists changes
+	// to them before dependency changes.
+	DiffRoots() []string
 }
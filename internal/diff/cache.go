@@ -0,0 +1,295 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/log/v2"
+	"github.com/arnarg/nilla-utils/internal/exec"
+)
+
+// cacheFormat is part of every cache path and is bumped whenever the cached
+// results change shape, e.g. when store paths are parsed differently.
+const cacheFormat = "v2"
+
+const (
+	// cacheMaxAge is how long an entry is kept after it was last used.
+	cacheMaxAge = 30 * 24 * time.Hour
+	// pruneInterval is how often DefaultCache prunes the cache.
+	pruneInterval = 24 * time.Hour
+	// pruneStamp is the file whose modification time records the last prune.
+	pruneStamp = ".pruned"
+)
+
+// Cache persists closure query results on disk, keyed by the identity of the
+// host's store and a store path. Store paths are immutable, so entries never
+// go stale, but they are removed by Prune once they have not been used for a
+// while.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a Cache that stores its entries below dir.
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// DefaultCache returns a Cache in the user's cache directory, or nil when
+// there is none or caching is disabled with NILLA_UTILS_NO_CACHE.
+func DefaultCache() *Cache {
+	if os.Getenv("NILLA_UTILS_NO_CACHE") != "" {
+		return nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	c := NewCache(filepath.Join(dir, "nilla-utils", "closures"))
+	c.pruneIfDue(time.Now())
+	return c
+}
+
+// Prune removes the entries that have not been used since before cutoff, and
+// everything written in other cache formats, including the unversioned
+// layout that kept host directories directly in the cache directory.
+func (c *Cache) Prune(cutoff time.Time) error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == cacheFormat || e.Name() == pruneStamp {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	hosts, err := os.ReadDir(filepath.Join(c.dir, cacheFormat))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, h := range hosts {
+		dir := filepath.Join(c.dir, cacheFormat, h.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if info, err := f.Info(); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(dir, f.Name()))
+			}
+		}
+		// Only succeeds once the host has no entries left
+		os.Remove(dir)
+	}
+	return nil
+}
+
+// pruneIfDue prunes the cache when it was last pruned more than
+// pruneInterval before now.
+func (c *Cache) pruneIfDue(now time.Time) {
+	stamp := filepath.Join(c.dir, pruneStamp)
+	if info, err := os.Stat(stamp); err == nil && now.Sub(info.ModTime()) < pruneInterval {
+		return
+	}
+	if err := c.Prune(now.Add(-cacheMaxAge)); err != nil {
+		log.Debugf("Could not prune cache: %s", err)
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return
+	}
+	if err := os.WriteFile(stamp, nil, 0o644); err == nil {
+		os.Chtimes(stamp, now, now)
+	}
+}
+
+func (c *Cache) file(host, storePath, kind string) string {
+	return filepath.Join(c.dir, cacheFormat, host, filepath.Base(storePath)+"."+kind+".json")
+}
+
+// get reads an entry and marks it as used, so Prune keeps it.
+func (c *Cache) get(host, storePath, kind string, v any) bool {
+	path := c.file(host, storePath, kind)
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if json.Unmarshal(buf, v) != nil {
+		return false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return true
+}
+
+// put writes an entry atomically, so concurrent runs never read half of one.
+// Failing to write only costs a query next time.
+func (c *Cache) put(host, storePath, kind string, v any) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	path := c.file(host, storePath, kind)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Debugf("Could not create cache directory: %s", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		log.Debugf("Could not write cache entry: %s", err)
+		return
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// cachedQuerier is an executorQuerier that keeps package lists and closure
+// sizes in a Cache. Generation paths are usually profile links, so they are
+// resolved to their store path first, once per path. The host is identified
+// by its machine id, and nothing is cached when that cannot be read.
+type cachedQuerier struct {
+	*executorQuerier
+	cache *Cache
+
+	once sync.Once
+	host string
+
+	mu       sync.Mutex
+	resolved map[string]string
+}
+
+// NewCachedQuerier returns a StoreQuerier like NewExecutorQuerier that reuses
+// results from cache across runs. A nil cache disables caching.
+func NewCachedQuerier(e exec.Executor, cache *Cache) StoreQuerier {
+	if cache == nil {
+		return NewExecutorQuerier(e)
+	}
+	return &cachedQuerier{
+		executorQuerier: &executorQuerier{exec: e},
+		cache:           cache,
+		resolved:        map[string]string{},
+	}
+}
+
+func (q *cachedQuerier) QueryPackages(ctx context.Context, path string) ([]Package, error) {
+	return cached(q, path, "packages", func() ([]Package, error) {
+		return q.executorQuerier.QueryPackages(ctx, path)
+	})
+}
+
+func (q *cachedQuerier) GetClosureSize(ctx context.Context, path string) (int64, error) {
+	return cached(q, path, "closure-size", func() (int64, error) {
+		return q.executorQuerier.GetClosureSize(ctx, path)
+	})
+}
+
+func (q *cachedQuerier) GetPathSizes(ctx context.Context, path string) (map[string]int64, error) {
+	return cached(q, path, "path-sizes", func() (map[string]int64, error) {
+		return q.executorQuerier.GetPathSizes(ctx, path)
+	})
+}
+
+// cached returns the entry of kind for the store path of path, running query
+// and storing its result on a miss.
+func cached[T any](q *cachedQuerier, path, kind string, query func() (T, error)) (T, error) {
+	host := q.hostID()
+	storePath := q.storePath(path)
+	if host == "" || storePath == "" {
+		return query()
+	}
+
+	var v T
+	if q.cache.get(host, storePath, kind, &v) {
+		return v, nil
+	}
+
+	v, err := query()
+	if err != nil {
+		return v, err
+	}
+	q.cache.put(host, storePath, kind, v)
+	return v, nil
+}
+
+// hostID returns the machine id of the host, read once.
+func (q *cachedQuerier) hostID() string {
+	q.once.Do(func() {
+		out, err := q.runCommand("cat", "/etc/machine-id")
+		if err != nil {
+			log.Debugf("Not caching closure queries, could not read machine id: %s", err)
+			return
+		}
+		q.host = parseMachineID(string(out))
+	})
+	return q.host
+}
+
+// storePath resolves path to the store path it links to, or returns an empty
+// string when it is not in the store. Store paths are returned as they are,
+// other paths are resolved on the host once.
+func (q *cachedQuerier) storePath(path string) string {
+	if toStorePath(path) == path && path != "" {
+		return path
+	}
+
+	q.mu.Lock()
+	sp, ok := q.resolved[path]
+	q.mu.Unlock()
+	if ok {
+		return sp
+	}
+
+	if out, err := q.runCommand("readlink", "-f", path); err == nil {
+		sp = toStorePath(strings.TrimSpace(string(out)))
+	}
+	q.mu.Lock()
+	q.resolved[path] = sp
+	q.mu.Unlock()
+	return sp
+}
+
+// toStorePath returns the top-level store path containing path, or an empty
+// string when path is not in the store.
+func toStorePath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/nix/store/")
+	if !ok || rest == "" {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return "/nix/store/" + name
+}
+
+// parseMachineID validates the contents of /etc/machine-id, which is used as
+// a directory name.
+func parseMachineID(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/\\. \n") {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,282 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/go-test/deep"
+)
+
+// scriptedExecutor answers commands with canned output, keyed by the full
+// command line, and records every command run.
+type scriptedExecutor struct {
+	outputs map[string]string
+	ran     []string
+}
+
+func (e *scriptedExecutor) Command(name string, args ...string) (exec.Command, error) {
+	return e.CommandContext(context.Background(), name, args...)
+}
+
+func (e *scriptedExecutor) CommandContext(_ context.Context, name string, args ...string) (exec.Command, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	e.ran = append(e.ran, line)
+	out, ok := e.outputs[line]
+	return &scriptedCommand{out: out, ok: ok}, nil
+}
+
+func (e *scriptedExecutor) PathExists(string) (bool, error) { return false, nil }
+func (e *scriptedExecutor) IsLocal() bool                   { return true }
+
+type scriptedCommand struct {
+	out    string
+	ok     bool
+	stdout io.Writer
+}
+
+func (c *scriptedCommand) Run() error {
+	if !c.ok {
+		return errors.New("unexpected command")
+	}
+	if c.stdout != nil {
+		io.WriteString(c.stdout, c.out)
+	}
+	return nil
+}
+
+func (c *scriptedCommand) Start() error          { return c.Run() }
+func (c *scriptedCommand) Wait() error           { return nil }
+func (c *scriptedCommand) SetStdin(io.Reader)    {}
+func (c *scriptedCommand) SetStdout(w io.Writer) { c.stdout = w }
+func (c *scriptedCommand) SetStderr(io.Writer)   {}
+func (c *scriptedCommand) StdinPipe() (io.WriteCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *scriptedCommand) StdoutPipe() (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *scriptedCommand) StderrPipe() (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+// pathInfoCmd is the start of the nix path-info command run by the querier.
+const pathInfoCmd = "nix path-info --extra-experimental-features nix-command --json "
+
+func TestCachedQuerier(t *testing.T) {
+	const (
+		link  = "/nix/var/nix/profiles/system-1-link"
+		store = "/nix/store/aaaa-nixos-system-host-24.11"
+	)
+	outputs := map[string]string{
+		"cat /etc/machine-id":                    "0123456789abcdef\n",
+		"readlink -f " + link:                    store + "\n",
+		"nix-store --query --requisites " + link: store + "\n/nix/store/bbbb-gzip-1.13\n",
+		"nix --version":                          "nix (Nix) 2.24.9\n",
+		pathInfoCmd + "--closure-size " + link:   `{"` + store + `": {"closureSize": 4096}}`,
+	}
+	cache := NewCache(t.TempDir())
+	ctx := context.Background()
+
+	want := []Package{
+		{Name: "nixos-system-host", Version: "24.11", Path: store},
+		{Name: "gzip", Version: "1.13", Path: "/nix/store/bbbb-gzip-1.13"},
+	}
+
+	for run := range 2 {
+		e := &scriptedExecutor{outputs: outputs}
+		q := NewCachedQuerier(e, cache)
+
+		pkgs, err := q.QueryPackages(ctx, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(pkgs, want); diff != nil {
+			t.Errorf("run %d: %v", run, diff)
+		}
+
+		size, err := q.GetClosureSize(ctx, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != 4096 {
+			t.Errorf("run %d: closure size = %d, want 4096", run, size)
+		}
+
+		queried := false
+		for _, c := range e.ran {
+			if strings.HasPrefix(c, "nix") {
+				queried = true
+			}
+		}
+		if wantQueried := run == 0; queried != wantQueried {
+			t.Errorf("run %d: queried the store = %v, want %v (ran %v)", run, queried, wantQueried, e.ran)
+		}
+	}
+}
+
+func TestCachedQuerierWithoutMachineID(t *testing.T) {
+	const link = "/nix/var/nix/profiles/system-1-link"
+	outputs := map[string]string{
+		"readlink -f " + link:                    "/nix/store/aaaa-nixos-system\n",
+		"nix-store --query --requisites " + link: "/nix/store/bbbb-gzip-1.13\n",
+	}
+	cache := NewCache(t.TempDir())
+
+	for range 2 {
+		e := &scriptedExecutor{outputs: outputs}
+		if _, err := NewCachedQuerier(e, cache).QueryPackages(context.Background(), link); err != nil {
+			t.Fatal(err)
+		}
+		if e.ran[len(e.ran)-1] != "nix-store --query --requisites "+link {
+			t.Errorf("expected the store to be queried every time, ran %v", e.ran)
+		}
+	}
+}
+
+func TestCachedQuerierResolvesOnce(t *testing.T) {
+	const (
+		link  = "/nix/var/nix/profiles/system-1-link"
+		store = "/nix/store/aaaa-nixos-system-host-24.11"
+	)
+	e := &scriptedExecutor{outputs: map[string]string{
+		"cat /etc/machine-id":                   "0123456789abcdef\n",
+		"readlink -f " + link:                   store + "\n",
+		"nix --version":                         "nix (Nix) 2.24.9\n",
+		pathInfoCmd + "--closure-size " + link:  `{"` + store + `": {"closureSize": 4096}}`,
+		pathInfoCmd + "--closure-size " + store: `{"` + store + `": {"closureSize": 4096}}`,
+	}}
+	q := NewCachedQuerier(e, NewCache(t.TempDir()))
+
+	for _, path := range []string{link, link, store} {
+		if _, err := q.GetClosureSize(context.Background(), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var readlinks []string
+	for _, c := range e.ran {
+		if strings.HasPrefix(c, "readlink") {
+			readlinks = append(readlinks, c)
+		}
+	}
+	if diff := deep.Equal(readlinks, []string{"readlink -f " + link}); diff != nil {
+		t.Errorf("expected the link to be resolved once and the store path not at all: %v", diff)
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-2 * cacheMaxAge)
+
+	write := func(rel string, mtime time.Time) {
+		t.Helper()
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("0123456789abcdef/aaaa-hello.packages.json", now)
+	write("v1/0123456789abcdef/aaaa-hello.packages.json", now)
+	write(cacheFormat+"/host-a/aaaa-hello.packages.json", now)
+	write(cacheFormat+"/host-a/bbbb-zlib.packages.json", old)
+	write(cacheFormat+"/host-b/cccc-gzip.packages.json", old)
+
+	if err := NewCache(dir).Prune(now.Add(-cacheMaxAge)); err != nil {
+		t.Fatal(err)
+	}
+
+	var left []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && path != dir {
+			rel, _ := filepath.Rel(dir, path)
+			left = append(left, rel)
+		}
+		return nil
+	})
+	want := []string{
+		cacheFormat,
+		filepath.Join(cacheFormat, "host-a"),
+		filepath.Join(cacheFormat, "host-a", "aaaa-hello.packages.json"),
+	}
+	if diff := deep.Equal(left, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCachePruneIfDue(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(dir)
+	now := time.Now()
+
+	c.pruneIfDue(now)
+	if _, err := os.Stat(filepath.Join(dir, pruneStamp)); err != nil {
+		t.Fatalf("expected a prune stamp: %s", err)
+	}
+
+	// Within the interval nothing is pruned, not even other formats
+	stale := filepath.Join(dir, "v1")
+	if err := os.Mkdir(stale, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c.pruneIfDue(now.Add(time.Hour))
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("pruned again within the interval: %s", err)
+	}
+
+	c.pruneIfDue(now.Add(pruneInterval + time.Hour))
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the old format to be pruned after the interval, got %v", err)
+	}
+}
+
+func TestToStorePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/nix/store/aaaa-nixos-system", "/nix/store/aaaa-nixos-system"},
+		{"/nix/store/aaaa-microvm-run/share/microvm/system", "/nix/store/aaaa-microvm-run"},
+		{"/nix/store/", ""},
+		{"/run/current-system", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := toStorePath(tt.in); got != tt.want {
+			t.Errorf("toStorePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMachineID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0123456789abcdef\n", "0123456789abcdef"},
+		{"", ""},
+		{"../../etc\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseMachineID(tt.in); got != tt.want {
+			t.Errorf("parseMachineID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
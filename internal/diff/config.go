@@ -0,0 +1,295 @@
+package diff
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxTextDiffSize is the largest file, in bytes, a text diff is shown for.
+const maxTextDiffSize = 8192
+
+// unitsDir is where NixOS links its systemd units, relative to etc/.
+const unitsDir = "systemd/system"
+
+// maxLinkRounds bounds how deep symlinks to directories are followed below
+// etc/, which also stops a symlink loop.
+const maxLinkRounds = 8
+
+var kernelModuleRe = regexp.MustCompile(`\.ko(\.(xz|zst|gz))?$`)
+
+// FileQuerier is implemented by StoreQueriers that can inspect the files of
+// a generation, which is needed to compare configuration-level changes.
+type FileQuerier interface {
+	// LinkTargets returns what every file below dir links to, keyed by path
+	// relative to dir. Symlinks to directories are walked, and files that
+	// are no symlinks get their SHA-256. A missing dir has no files.
+	LinkTargets(ctx context.Context, dir string) (map[string]string, error)
+	// ListFiles returns every file below dir, following symlinks, relative
+	// to dir. A missing dir has no files.
+	ListFiles(ctx context.Context, dir string) ([]string, error)
+	// ReadFile returns at most limit bytes of path.
+	ReadFile(ctx context.Context, path string, limit int) ([]byte, error)
+}
+
+// FileChange is an added, removed or changed file. Diff is a unified diff of
+// a changed text file, when requested and the file is small enough.
+type FileChange struct {
+	Path string     `json:"path"`
+	Type ChangeType `json:"type"`
+	Diff string     `json:"diff,omitempty"`
+}
+
+// ConfigReport holds the configuration-level changes between two NixOS
+// toplevels. Kernel modules and firmware are compared by name only.
+type ConfigReport struct {
+	Units         []FileChange `json:"units"`
+	Etc           []FileChange `json:"etc"`
+	KernelModules []FileChange `json:"kernelModules"`
+	Firmware      []FileChange `json:"firmware"`
+}
+
+// IsEmpty reports whether no configuration-level change was found.
+func (r *ConfigReport) IsEmpty() bool {
+	return len(r.Units) == 0 && len(r.Etc) == 0 && len(r.KernelModules) == 0 && len(r.Firmware) == 0
+}
+
+type configSection struct {
+	title   string
+	changes []FileChange
+}
+
+// configSections returns the sections of c in the order they are rendered.
+func configSections(c *ConfigReport) []configSection {
+	return []configSection{
+		{"Systemd units", c.Units},
+		{"Configuration files", c.Etc},
+		{"Kernel modules", c.KernelModules},
+		{"Firmware", c.Firmware},
+	}
+}
+
+// ErrNoConfig is returned by CalculateConfigReport for generations that are
+// not NixOS toplevels.
+var ErrNoConfig = errors.New("not a NixOS toplevel")
+
+// CalculateConfigReport compares the etc/ tree, systemd units, kernel modules
+// and firmware of two NixOS toplevels. Files of etc/ are compared by the store
+// path they link to, so no file is read unless texts is set. With texts set, changed files no larger
+// than maxTextDiffSize get a unified diff.
+func CalculateConfigReport(ctx context.Context, from, to *Generation, texts bool) (*ConfigReport, error) {
+	fq, ok := from.Querier.(FileQuerier)
+	if !ok {
+		return nil, fmt.Errorf("querier of %s cannot inspect files", from.Path)
+	}
+	tq, ok := to.Querier.(FileQuerier)
+	if !ok {
+		return nil, fmt.Errorf("querier of %s cannot inspect files", to.Path)
+	}
+
+	beforeEtc, err := fq.LinkTargets(ctx, filepath.Join(from.Path, "etc"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list etc of from: %w", err)
+	}
+	afterEtc, err := tq.LinkTargets(ctx, filepath.Join(to.Path, "etc"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list etc of to: %w", err)
+	}
+	if len(beforeEtc) == 0 || len(afterEtc) == 0 {
+		return nil, ErrNoConfig
+	}
+
+	beforeUnits, beforeEtc := splitUnits(beforeEtc)
+	afterUnits, afterEtc := splitUnits(afterEtc)
+
+	report := &ConfigReport{
+		Units: compareFiles(beforeUnits, afterUnits),
+		Etc:   compareFiles(beforeEtc, afterEtc),
+	}
+
+	if texts {
+		for _, set := range []struct {
+			changes []FileChange
+			dir     string
+		}{
+			{report.Units, filepath.Join("etc", unitsDir)},
+			{report.Etc, "etc"},
+		} {
+			for i, c := range set.changes {
+				if c.Type != Changed {
+					continue
+				}
+				set.changes[i].Diff = textDiff(ctx, fq, tq,
+					filepath.Join(from.Path, set.dir, c.Path),
+					filepath.Join(to.Path, set.dir, c.Path),
+					c.Path)
+			}
+		}
+	}
+
+	for _, tree := range []struct {
+		out  *[]FileChange
+		dir  string
+		keys func([]string) map[string]string
+	}{
+		{&report.KernelModules, "kernel-modules/lib/modules", moduleNames},
+		{&report.Firmware, "firmware/lib/firmware", fileNames},
+	} {
+		before, err := fq.ListFiles(ctx, filepath.Join(from.Path, tree.dir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s of from: %w", tree.dir, err)
+		}
+		after, err := tq.ListFiles(ctx, filepath.Join(to.Path, tree.dir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s of to: %w", tree.dir, err)
+		}
+		*tree.out = compareFiles(tree.keys(before), tree.keys(after))
+	}
+
+	return report, nil
+}
+
+// splitUnits separates the systemd units from the rest of etc/.
+func splitUnits(etc map[string]string) (units, rest map[string]string) {
+	units = map[string]string{}
+	rest = map[string]string{}
+	for p, h := range etc {
+		if u, ok := strings.CutPrefix(p, unitsDir+"/"); ok {
+			units[u] = h
+		} else {
+			rest[p] = h
+		}
+	}
+	return units, rest
+}
+
+// moduleNames keys kernel modules by name, leaving out the kernel version
+// directory so a kernel upgrade does not report every module as changed.
+func moduleNames(files []string) map[string]string {
+	out := map[string]string{}
+	for _, f := range files {
+		if !kernelModuleRe.MatchString(f) {
+			continue
+		}
+		out[kernelModuleRe.ReplaceAllString(filepath.Base(f), "")] = ""
+	}
+	return out
+}
+
+func fileNames(files []string) map[string]string {
+	out := map[string]string{}
+	for _, f := range files {
+		out[f] = ""
+	}
+	return out
+}
+
+// compareFiles compares two sets of files keyed by path, whose values are
+// link targets or content hashes (or empty when only names are compared).
+func compareFiles(before, after map[string]string) []FileChange {
+	var changes []FileChange
+	for p, h := range before {
+		other, ok := after[p]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: p, Type: Removed})
+		case other != h:
+			changes = append(changes, FileChange{Path: p, Type: Changed})
+		}
+	}
+	for p := range after {
+		if _, ok := before[p]; !ok {
+			changes = append(changes, FileChange{Path: p, Type: Added})
+		}
+	}
+	slices.SortFunc(changes, func(a, b FileChange) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return changes
+}
+
+// textDiff returns a unified diff of two small text files, or nothing when
+// either cannot be read, is too large or is binary.
+func textDiff(ctx context.Context, fq, tq FileQuerier, from, to, name string) string {
+	a, err := fq.ReadFile(ctx, from, maxTextDiffSize+1)
+	if err != nil || len(a) > maxTextDiffSize || bytes.IndexByte(a, 0) >= 0 {
+		return ""
+	}
+	b, err := tq.ReadFile(ctx, to, maxTextDiffSize+1)
+	if err != nil || len(b) > maxTextDiffSize || bytes.IndexByte(b, 0) >= 0 {
+		return ""
+	}
+	return unifiedDiff("a/"+name, "b/"+name, string(a), string(b))
+}
+
+// parseHashes parses sha256sum output into hashes keyed by path relative to
+// root.
+func parseHashes(out, root string) map[string]string {
+	hashes := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		hash, path, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		if rel, ok := relativeTo(path, root); ok {
+			hashes[rel] = hash
+		}
+	}
+	return hashes
+}
+
+// parseLinks parses the output of find -printf %Y,%l, -print0 below root. It
+// returns the targets of symlinks that are not to directories, and files
+// that are no symlinks, both relative to root, and the symlinks to
+// directories to walk next. Store paths cannot contain a comma, so a link
+// target ends at the first one.
+func parseLinks(out, root string) (links map[string]string, files, dirs []string) {
+	links = map[string]string{}
+	for _, entry := range strings.Split(out, "\x00") {
+		kind, rest, ok := strings.Cut(entry, ",")
+		if !ok {
+			continue
+		}
+		target, path, ok := strings.Cut(rest, ",")
+		if !ok {
+			continue
+		}
+		rel, ok := relativeTo(path, root)
+		if !ok {
+			continue
+		}
+		switch {
+		case kind == "d":
+			if target != "" {
+				dirs = append(dirs, path)
+			}
+		case target != "":
+			links[rel] = target
+		case kind == "f":
+			files = append(files, rel)
+		}
+	}
+	return links, files, dirs
+}
+
+// parseFileList parses find output into paths relative to root.
+func parseFileList(out, root string) []string {
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if rel, ok := relativeTo(line, root); ok {
+			files = append(files, rel)
+		}
+	}
+	return files
+}
+
+func relativeTo(path, root string) (string, bool) {
+	rel, ok := strings.CutPrefix(path, strings.TrimSuffix(root, "/")+"/")
+	return rel, ok && rel != ""
+}
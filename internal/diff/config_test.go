@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// fileQuerier serves files from memory, keyed by absolute path. The content
+// doubles as the link target.
+type fileQuerier struct {
+	countingQuerier
+	files map[string]string
+}
+
+func (q *fileQuerier) LinkTargets(ctx context.Context, dir string) (map[string]string, error) {
+	out := map[string]string{}
+	for p, c := range q.files {
+		if rel, ok := relativeTo(p, dir); ok {
+			out[rel] = c
+		}
+	}
+	return out, nil
+}
+
+func (q *fileQuerier) ListFiles(ctx context.Context, dir string) ([]string, error) {
+	var out []string
+	for p := range q.files {
+		if rel, ok := relativeTo(p, dir); ok {
+			out = append(out, rel)
+		}
+	}
+	return out, nil
+}
+
+func (q *fileQuerier) ReadFile(ctx context.Context, path string, limit int) ([]byte, error) {
+	c, ok := q.files[path]
+	if !ok {
+		return nil, errors.New("no such file")
+	}
+	return []byte(c[:min(len(c), limit)]), nil
+}
+
+func TestCalculateConfigReport(t *testing.T) {
+	from := &Generation{Path: "/from", Querier: &fileQuerier{files: map[string]string{
+		"/from/etc/hosts":                                            "127.0.0.1 localhost\n",
+		"/from/etc/ssh/sshd_config":                                  "PermitRootLogin yes\n",
+		"/from/etc/systemd/system/sshd.service":                      "[Service]\nExecStart=sshd\n",
+		"/from/etc/systemd/system/old.service":                       "[Service]\n",
+		"/from/kernel-modules/lib/modules/6.6.1/kernel/e1000e.ko.xz": "",
+		"/from/kernel-modules/lib/modules/6.6.1/kernel/btusb.ko.xz":  "",
+		"/from/firmware/lib/firmware/iwlwifi-1.ucode":                "",
+	}}}
+	to := &Generation{Path: "/to", Querier: &fileQuerier{files: map[string]string{
+		"/to/etc/hosts":                                            "127.0.0.1 localhost\n",
+		"/to/etc/ssh/sshd_config":                                  "PermitRootLogin no\n",
+		"/to/etc/systemd/system/sshd.service":                      "[Service]\nExecStart=sshd -D\n",
+		"/to/etc/systemd/system/new.timer":                         "[Timer]\n",
+		"/to/kernel-modules/lib/modules/6.6.2/kernel/e1000e.ko.xz": "",
+		"/to/kernel-modules/lib/modules/6.6.2/kernel/wireguard.ko": "",
+		"/to/firmware/lib/firmware/iwlwifi-1.ucode":                "",
+	}}}
+
+	got, err := CalculateConfigReport(context.Background(), from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &ConfigReport{
+		Units: []FileChange{
+			{Path: "new.timer", Type: Added},
+			{Path: "old.service", Type: Removed},
+			{Path: "sshd.service", Type: Changed, Diff: "--- a/sshd.service\n+++ b/sshd.service\n@@ -1,2 +1,2 @@\n [Service]\n-ExecStart=sshd\n+ExecStart=sshd -D\n"},
+		},
+		Etc: []FileChange{
+			{Path: "ssh/sshd_config", Type: Changed, Diff: "--- a/ssh/sshd_config\n+++ b/ssh/sshd_config\n@@ -1,1 +1,1 @@\n-PermitRootLogin yes\n+PermitRootLogin no\n"},
+		},
+		KernelModules: []FileChange{
+			{Path: "btusb", Type: Removed},
+			{Path: "wireguard", Type: Added},
+		},
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCalculateConfigReportNotNixOS(t *testing.T) {
+	from := &Generation{Path: "/from", Querier: &fileQuerier{files: map[string]string{"/from/home-files/.bashrc": ""}}}
+	to := &Generation{Path: "/to", Querier: &fileQuerier{files: map[string]string{"/to/home-files/.bashrc": ""}}}
+
+	if _, err := CalculateConfigReport(context.Background(), from, to, false); !errors.Is(err, ErrNoConfig) {
+		t.Errorf("expected ErrNoConfig, got %v", err)
+	}
+}
+
+func TestParseHashes(t *testing.T) {
+	out := strings.Join([]string{
+		"0a1b  /nix/store/abc-etc/etc/hosts",
+		"2c3d  /nix/store/abc-etc/etc/ssh/ssh config",
+		"",
+		"4e5f  /elsewhere/file",
+	}, "\n")
+
+	want := map[string]string{
+		"hosts":          "0a1b",
+		"ssh/ssh config": "2c3d",
+	}
+	if diff := deep.Equal(parseHashes(out, "/nix/store/abc-etc/etc/"), want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	out := strings.Join([]string{
+		"f,/nix/store/aaaa-hosts,/nix/store/abc-etc/etc/hosts",
+		"d,,/nix/store/abc-etc/etc/ssh",
+		"f,/nix/store/bbbb-sshd.conf,/nix/store/abc-etc/etc/ssh/sshd_config",
+		"d,/nix/store/cccc-system-units,/nix/store/abc-etc/etc/systemd/system",
+		"N,/nix/store/dddd-gone,/nix/store/abc-etc/etc/dangling",
+		"f,,/nix/store/abc-etc/etc/sudoers.mode",
+		"f,/nix/store/eeee-file,/elsewhere/file",
+		"",
+	}, "\x00")
+
+	links, files, dirs := parseLinks(out, "/nix/store/abc-etc/etc")
+
+	wantLinks := map[string]string{
+		"hosts":           "/nix/store/aaaa-hosts",
+		"ssh/sshd_config": "/nix/store/bbbb-sshd.conf",
+		"dangling":        "/nix/store/dddd-gone",
+	}
+	if diff := deep.Equal(links, wantLinks); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(files, []string{"sudoers.mode"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(dirs, []string{"/nix/store/abc-etc/etc/systemd/system"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestModuleNames(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want map[string]string
+	}{
+		{
+			name: "compressed and plain modules",
+			in:   []string{"6.6.1/kernel/net/wireguard.ko.xz", "6.6.1/extra/zfs.ko", "6.6.1/kernel/fs/ext4.ko.zst"},
+			want: map[string]string{"wireguard": "", "zfs": "", "ext4": ""},
+		},
+		{
+			name: "metadata files are skipped",
+			in:   []string{"6.6.1/modules.dep", "6.6.1/modules.alias"},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(moduleNames(tt.in), tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "context is limited",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\n4\n5\n6\n7\nX\n",
+			want: "--- a\n+++ b\n@@ -5,4 +5,4 @@\n 5\n 6\n 7\n-8\n+X\n",
+		},
+		{
+			name: "distant changes make separate hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:    "X\n2\n3\n4\n5\n6\n7\n8\n9\nY\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+X\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+Y\n",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "new\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("a", "b", tt.a, tt.b); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,17 +3,24 @@ package diff
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"slices"
 	"strings"
 )
 
 // Generation represents a path to a generation and an executor that
-// can query all nix paths in its closure.
+// can query all nix paths in its closure. Roots are paths relative to Path
+// whose direct references are the user-facing packages, e.g. sw of a NixOS
+// toplevel. Changes to any other package are reported as dependency changes.
+// Without roots every change is treated as user-facing.
 type Generation struct {
 	Path    string
 	Querier StoreQuerier
+	Roots   []string
 }
 
 type PackageName string
@@ -22,7 +29,11 @@ type Version string
 type Package struct {
 	Name    PackageName
 	Version Version
-	Path    string
+	// Output is the derivation output, empty for the default output.
+	Output string
+	Path   string
+	// Size is the NAR size of Path, zero when unknown.
+	Size int64
 }
 
 type ChangeType int
@@ -31,21 +42,105 @@ const (
 	Changed ChangeType = iota
 	Added
 	Removed
+	// Rebuilt packages kept their versions but got new store paths, e.g.
+	// after a dependency bump, patch or flag change.
+	Rebuilt
+	// OutputsChanged packages kept their versions but gained or lost
+	// outputs, e.g. when a package is split into "out" and "lib".
+	OutputsChanged
 )
 
+func (t ChangeType) String() string {
+	switch t {
+	case Changed:
+		return "changed"
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Rebuilt:
+		return "rebuilt"
+	case OutputsChanged:
+		return "outputs"
+	default:
+		return "unknown"
+	}
+}
+
+func (t ChangeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 type Change struct {
-	Name   PackageName
-	Before []Version
-	After  []Version
-	Type   ChangeType
+	Name       PackageName `json:"name"`
+	Before     []Version   `json:"before"`
+	After      []Version   `json:"after"`
+	Type       ChangeType  `json:"type"`
+	Bump       Bump        `json:"bump"`
+	SizeBefore int64       `json:"sizeBefore"`
+	SizeAfter  int64       `json:"sizeAfter"`
+	// Dependency is set for packages that are not referenced directly by the
+	// roots of either generation.
+	Dependency bool `json:"dependency"`
+	// OutputsAdded and OutputsRemoved name the outputs gained and lost by
+	// an OutputsChanged package, with "out" for the default output.
+	OutputsAdded   []string `json:"outputsAdded,omitempty"`
+	OutputsRemoved []string `json:"outputsRemoved,omitempty"`
+}
+
+// SizeChange is the change in the summed NAR size of all store paths of a
+// package, whether or not its version changed.
+type SizeChange struct {
+	Name   PackageName `json:"name"`
+	Before int64       `json:"before"`
+	After  int64       `json:"after"`
+}
+
+func (c SizeChange) Delta() int64 {
+	return c.After - c.Before
 }
 
 type Report struct {
-	Changes     []Change
-	NumBefore   int
-	NumAfter    int
-	BytesBefore int64
-	BytesAfter  int64
+	Changes     []Change     `json:"changes"`
+	SizeChanges []SizeChange `json:"sizeChanges"`
+	NumBefore   int          `json:"numBefore"`
+	NumAfter    int          `json:"numAfter"`
+	BytesBefore int64        `json:"bytesBefore"`
+	BytesAfter  int64        `json:"bytesAfter"`
+	// Config holds configuration-level changes, only set for NixOS
+	// toplevels.
+	Config *ConfigReport `json:"config,omitempty"`
+	// Inputs holds the pinned inputs that changed, only set when both
+	// generations recorded them.
+	Inputs []InputChange `json:"inputs,omitempty"`
+}
+
+// TopGrowers returns up to n packages whose size grew the most.
+func (r Report) TopGrowers(n int) []SizeChange {
+	var out []SizeChange
+	for _, c := range r.SizeChanges {
+		if len(out) == n {
+			break
+		}
+		if c.Delta() > 0 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// TopShrinkers returns up to n packages whose size shrank the most.
+func (r Report) TopShrinkers(n int) []SizeChange {
+	var out []SizeChange
+	for _, c := range r.SizeChanges {
+		if len(out) == n {
+			break
+		}
+		if c.Delta() < 0 {
+			out = append(out, c)
+		}
+	}
+	return out
 }
 
 // CalculateReport computes the diff between two generations.
@@ -72,30 +167,97 @@ func CalculateReport(ctx context.Context, from, to *Generation) (Report, error)
 		return Report{}, fmt.Errorf("failed to get closure size for to: %w", err)
 	}
 
+	// Query per-path sizes
+	beforeSizes, err := from.Querier.GetPathSizes(ctx, from.Path)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to get path sizes for from: %w", err)
+	}
+
+	afterSizes, err := to.Querier.GetPathSizes(ctx, to.Path)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to get path sizes for to: %w", err)
+	}
+
+	// Query user-facing packages
+	beforeRoots, err := from.Querier.QueryRoots(ctx, from.Path, from.Roots)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to query roots of from: %w", err)
+	}
+
+	afterRoots, err := to.Querier.QueryRoots(ctx, to.Path, to.Roots)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to query roots of to: %w", err)
+	}
+
 	// Calculate pure diff
-	report := calculatePackageDiff(before, after)
+	report := calculatePackageDiff(withSizes(before, beforeSizes), withSizes(after, afterSizes))
 	report.BytesBefore = beforeSize
 	report.BytesAfter = afterSize
+	markDependencies(report.Changes, append(beforeRoots, afterRoots...))
 
 	return report, nil
 }
 
+// markDependencies flags the changes to packages that are not among roots.
+// Nothing is flagged when there are no roots, so generations without any
+// are reported as before.
+func markDependencies(changes []Change, roots []Package) {
+	if len(roots) == 0 {
+		return
+	}
+	direct := make(map[PackageName]bool, len(roots))
+	for _, p := range roots {
+		direct[p.Name] = true
+	}
+	for i := range changes {
+		changes[i].Dependency = !direct[changes[i].Name]
+	}
+}
+
+// withSizes returns a copy of pkgs with their NAR sizes filled in from sizes,
+// which is keyed by store path.
+func withSizes(pkgs []Package, sizes map[string]int64) []Package {
+	out := make([]Package, len(pkgs))
+	for i, p := range pkgs {
+		p.Size = sizes[p.Path]
+		out[i] = p
+	}
+	return out
+}
+
 func calculatePackageDiff(before, after []Package) Report {
-	// Index by name -> set of versions
+	// Index by name -> set of versions, name -> set of store paths,
+	// name -> set of outputs and name -> summed size
 	beforeIdx := make(map[PackageName]map[Version]struct{})
 	afterIdx := make(map[PackageName]map[Version]struct{})
+	beforePaths := make(map[PackageName]map[string]struct{})
+	afterPaths := make(map[PackageName]map[string]struct{})
+	beforeOutputs := make(map[PackageName]map[string]struct{})
+	afterOutputs := make(map[PackageName]map[string]struct{})
+	beforeSize := make(map[PackageName]int64)
+	afterSize := make(map[PackageName]int64)
 
 	for _, p := range before {
 		if _, ok := beforeIdx[p.Name]; !ok {
 			beforeIdx[p.Name] = make(map[Version]struct{})
+			beforePaths[p.Name] = make(map[string]struct{})
+			beforeOutputs[p.Name] = make(map[string]struct{})
 		}
 		beforeIdx[p.Name][p.Version] = struct{}{}
+		beforePaths[p.Name][p.Path] = struct{}{}
+		beforeOutputs[p.Name][outputName(p.Output)] = struct{}{}
+		beforeSize[p.Name] += p.Size
 	}
 	for _, p := range after {
 		if _, ok := afterIdx[p.Name]; !ok {
 			afterIdx[p.Name] = make(map[Version]struct{})
+			afterPaths[p.Name] = make(map[string]struct{})
+			afterOutputs[p.Name] = make(map[string]struct{})
 		}
 		afterIdx[p.Name][p.Version] = struct{}{}
+		afterPaths[p.Name][p.Path] = struct{}{}
+		afterOutputs[p.Name][outputName(p.Output)] = struct{}{}
+		afterSize[p.Name] += p.Size
 	}
 
 	var changes []Change
@@ -115,6 +277,23 @@ func calculatePackageDiff(before, after []Package) Report {
 				Before: setToSlice(vers),
 				After:  setToSlice(other),
 				Type:   Changed,
+				Bump:   classifyChange(setToSlice(vers), setToSlice(other)),
+			})
+		} else if !maps.Equal(beforeOutputs[name], afterOutputs[name]) {
+			changes = append(changes, Change{
+				Name:           name,
+				Before:         setToSlice(vers),
+				After:          setToSlice(other),
+				Type:           OutputsChanged,
+				OutputsAdded:   setDifference(afterOutputs[name], beforeOutputs[name]),
+				OutputsRemoved: setDifference(beforeOutputs[name], afterOutputs[name]),
+			})
+		} else if !maps.Equal(beforePaths[name], afterPaths[name]) {
+			changes = append(changes, Change{
+				Name:   name,
+				Before: setToSlice(vers),
+				After:  setToSlice(other),
+				Type:   Rebuilt,
 			})
 		}
 	}
@@ -136,11 +315,48 @@ func calculatePackageDiff(before, after []Package) Report {
 		return cmp.Compare(strings.ToLower(string(a.Name)), strings.ToLower(string(b.Name)))
 	})
 
+	for i := range changes {
+		changes[i].SizeBefore = beforeSize[changes[i].Name]
+		changes[i].SizeAfter = afterSize[changes[i].Name]
+	}
+
 	return Report{
-		Changes:   changes,
-		NumBefore: len(beforeIdx),
-		NumAfter:  len(afterIdx),
+		Changes:     changes,
+		SizeChanges: sizeChanges(beforeSize, afterSize),
+		NumBefore:   len(beforeIdx),
+		NumAfter:    len(afterIdx),
+	}
+}
+
+// sizeChanges returns every package whose size changed, largest change first.
+// Packages rebuilt without a version change are included, as they can account
+// for much of the growth of a closure.
+func sizeChanges(before, after map[PackageName]int64) []SizeChange {
+	var out []SizeChange
+	for name, b := range before {
+		if a := after[name]; a != b {
+			out = append(out, SizeChange{Name: name, Before: b, After: a})
+		}
 	}
+	for name, a := range after {
+		if _, ok := before[name]; !ok && a != 0 {
+			out = append(out, SizeChange{Name: name, After: a})
+		}
+	}
+
+	abs := func(n int64) int64 {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	slices.SortFunc(out, func(a, b SizeChange) int {
+		if c := cmp.Compare(abs(b.Delta()), abs(a.Delta())); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return out
 }
 
 func setToSlice(m map[Version]struct{}) []Version {
@@ -152,15 +368,70 @@ func setToSlice(m map[Version]struct{}) []Version {
 	return s
 }
 
+// setDifference returns the sorted elements of a that are not in b.
+func setDifference(a, b map[string]struct{}) []string {
+	var out []string
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			out = append(out, k)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// outputName names the default output "out", which store paths leave out.
+func outputName(output string) string {
+	if output == "" {
+		return "out"
+	}
+	return output
+}
+
+// Output selects how a report is rendered by Execute. Path is only used for
+// the machine-readable formats. Why lists packages whose reference chain from
+// the new generation is printed after the report. Config adds the
+// configuration-level changes of NixOS toplevels to the report, and Texts
+// unified diffs of their small changed files.
+type Output struct {
+	Format Format
+	Path   string
+	Why    []string
+	Config bool
+	Texts  bool
+}
+
 // Execute a diff between two generations and use the default terminal
-// renderer to print the output to terminal output.
-func Execute(from, to *Generation) error {
+// renderer to print the output to terminal output. When out selects another
+// format, the report is also rendered in it to out.Path, or to stdout when no
+// path is given.
+func Execute(from, to *Generation, out Output) error {
 	// Calculate diff
 	report, err := CalculateReport(context.Background(), from, to)
 	if err != nil {
 		return err
 	}
 
+	// Compare configuration, failing to do so only loses that section
+	if out.Config {
+		config, err := CalculateConfigReport(context.Background(), from, to, out.Texts)
+		switch {
+		case err == nil:
+			report.Config = config
+		case !errors.Is(err, ErrNoConfig):
+			fmt.Fprintf(os.Stderr, "Could not compare configuration: %s\n", err)
+		}
+	}
+
+	// Compare pinned inputs, failing to do so only loses that section
+	inputs, err := CalculateInputChanges(context.Background(), from, to)
+	switch {
+	case err == nil:
+		report.Inputs = inputs
+	case !errors.Is(err, ErrNoInputs):
+		fmt.Fprintf(os.Stderr, "Could not compare inputs: %s\n", err)
+	}
+
 	// Create a terminal renderer
 	renderer := NewTerminalRenderer()
 
@@ -169,5 +440,46 @@ func Execute(from, to *Generation) error {
 		return fmt.Errorf("render failed: %w", err)
 	}
 
-	return nil
+	for _, pkg := range out.Why {
+		printWhy(os.Stderr, to, PackageName(pkg))
+	}
+
+	if out.Format == "" || out.Format == FormatTerminal {
+		return nil
+	}
+
+	return writeReport(report, out)
+}
+
+// printWhy explains why pkg is in the closure of gen. Failing to do so is not
+// fatal, the report has already been printed.
+func printWhy(w io.Writer, gen *Generation, pkg PackageName) {
+	chain, err := gen.Querier.WhyDepends(context.Background(), gen.Path, pkg)
+	if err != nil {
+		fmt.Fprintf(w, "Could not explain %s: %s\n", pkg, err)
+		return
+	}
+	fmt.Fprintf(w, "Why %s is in the closure:\n", pkg)
+	fmt.Fprint(w, FormatWhy(chain))
+}
+
+func writeReport(report Report, out Output) error {
+	renderer, err := NewRenderer(out.Format)
+	if err != nil {
+		return err
+	}
+
+	if out.Path == "" {
+		return renderer.Render(os.Stdout, report)
+	}
+
+	f, err := os.Create(out.Path)
+	if err != nil {
+		return fmt.Errorf("failed to create diff output: %w", err)
+	}
+	if err := renderer.Render(f, report); err != nil {
+		f.Close()
+		return fmt.Errorf("render failed: %w", err)
+	}
+	return f.Close()
 }
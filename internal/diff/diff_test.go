@@ -31,7 +31,9 @@ func changesEqual(a, b []Change) bool {
 		return x.Name == y.Name &&
 			x.Type == y.Type &&
 			slices.Equal(x.Before, y.Before) &&
-			slices.Equal(x.After, y.After)
+			slices.Equal(x.After, y.After) &&
+			slices.Equal(x.OutputsAdded, y.OutputsAdded) &&
+			slices.Equal(x.OutputsRemoved, y.OutputsRemoved)
 	})
 }
 
@@ -82,6 +84,51 @@ func TestCalculatePackageDiff(t *testing.T) {
 				NumAfter:  2,
 			},
 		},
+		{
+			name: "rebuilt without version change",
+			before: []Package{
+				{Name: "glibc", Version: "2.40", Path: "/nix/store/aaa-glibc-2.40"},
+				{Name: "glibc", Version: "2.40-bin", Path: "/nix/store/aaa-glibc-2.40-bin"},
+				{Name: "bash", Version: "5.2", Path: "/nix/store/aaa-bash-5.2"},
+			},
+			after: []Package{
+				{Name: "glibc", Version: "2.40", Path: "/nix/store/bbb-glibc-2.40"},
+				{Name: "glibc", Version: "2.40-bin", Path: "/nix/store/bbb-glibc-2.40-bin"},
+				{Name: "bash", Version: "5.2", Path: "/nix/store/aaa-bash-5.2"},
+			},
+			want: Report{
+				Changes: []Change{
+					{Name: "glibc", Before: []Version{"2.40", "2.40-bin"}, After: []Version{"2.40", "2.40-bin"}, Type: Rebuilt},
+				},
+				NumBefore: 2,
+				NumAfter:  2,
+			},
+		},
+		{
+			name: "outputs gained and lost without version change",
+			before: []Package{
+				{Name: "glibc", Version: "2.40", Path: "/nix/store/aaa-glibc-2.40"},
+				{Name: "glibc", Version: "2.40", Output: "bin", Path: "/nix/store/aaa-glibc-2.40-bin"},
+				{Name: "curl", Version: "8.9.1", Path: "/nix/store/aaa-curl-8.9.1"},
+				{Name: "curl", Version: "8.9.1", Output: "man", Path: "/nix/store/aaa-curl-8.9.1-man"},
+			},
+			after: []Package{
+				{Name: "glibc", Version: "2.40", Path: "/nix/store/aaa-glibc-2.40"},
+				{Name: "glibc", Version: "2.40", Output: "bin", Path: "/nix/store/aaa-glibc-2.40-bin"},
+				{Name: "glibc", Version: "2.40", Output: "dev", Path: "/nix/store/aaa-glibc-2.40-dev"},
+				{Name: "curl", Version: "8.9.1", Output: "bin", Path: "/nix/store/bbb-curl-8.9.1-bin"},
+			},
+			want: Report{
+				Changes: []Change{
+					{Name: "curl", Before: []Version{"8.9.1"}, After: []Version{"8.9.1"}, Type: OutputsChanged,
+						OutputsAdded: []string{"bin"}, OutputsRemoved: []string{"man", "out"}},
+					{Name: "glibc", Before: []Version{"2.40"}, After: []Version{"2.40"}, Type: OutputsChanged,
+						OutputsAdded: []string{"dev"}},
+				},
+				NumBefore: 2,
+				NumAfter:  2,
+			},
+		},
 		{
 			name:   "empty before and after",
 			before: []Package{},
@@ -182,3 +229,103 @@ func TestSetToSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculatePackageDiffSizes(t *testing.T) {
+	before := withSizes([]Package{
+		{Name: "gzip", Version: "1.13", Path: "/nix/store/a-gzip-1.13"},
+		{Name: "gzip", Version: "1.13-lib", Path: "/nix/store/a-gzip-1.13-lib"},
+		{Name: "glibc", Version: "2.40", Path: "/nix/store/a-glibc-2.40"},
+		{Name: "perl", Version: "5.38", Path: "/nix/store/a-perl-5.38"},
+	}, map[string]int64{
+		"/nix/store/a-gzip-1.13":     100,
+		"/nix/store/a-gzip-1.13-lib": 50,
+		"/nix/store/a-glibc-2.40":    1000,
+		"/nix/store/a-perl-5.38":     300,
+	})
+	after := withSizes([]Package{
+		{Name: "gzip", Version: "1.14", Path: "/nix/store/b-gzip-1.14"},
+		{Name: "gzip", Version: "1.14-lib", Path: "/nix/store/b-gzip-1.14-lib"},
+		// Rebuilt without a version change.
+		{Name: "glibc", Version: "2.40", Path: "/nix/store/b-glibc-2.40"},
+		{Name: "jq", Version: "1.7", Path: "/nix/store/b-jq-1.7"},
+	}, map[string]int64{
+		"/nix/store/b-gzip-1.14":     120,
+		"/nix/store/b-gzip-1.14-lib": 50,
+		"/nix/store/b-glibc-2.40":    1500,
+		"/nix/store/b-jq-1.7":        40,
+	})
+
+	got := calculatePackageDiff(before, after)
+
+	sizes := map[PackageName][2]int64{}
+	for _, c := range got.Changes {
+		sizes[c.Name] = [2]int64{c.SizeBefore, c.SizeAfter}
+	}
+	want := map[PackageName][2]int64{
+		"glibc": {1000, 1500},
+		"gzip":  {150, 170},
+		"jq":    {0, 40},
+		"perl":  {300, 0},
+	}
+	if diff := deep.Equal(sizes, want); diff != nil {
+		t.Error(diff)
+	}
+
+	wantSizes := []SizeChange{
+		{Name: "glibc", Before: 1000, After: 1500},
+		{Name: "perl", Before: 300, After: 0},
+		{Name: "jq", Before: 0, After: 40},
+		{Name: "gzip", Before: 150, After: 170},
+	}
+	if diff := deep.Equal(got.SizeChanges, wantSizes); diff != nil {
+		t.Error(diff)
+	}
+
+	if diff := deep.Equal(got.TopGrowers(2), []SizeChange{wantSizes[0], wantSizes[2]}); diff != nil {
+		t.Errorf("TopGrowers: %v", diff)
+	}
+	if diff := deep.Equal(got.TopShrinkers(2), []SizeChange{wantSizes[1]}); diff != nil {
+		t.Errorf("TopShrinkers: %v", diff)
+	}
+}
+
+func TestMarkDependencies(t *testing.T) {
+	tests := []struct {
+		name  string
+		roots []Package
+		want  []bool
+	}{
+		{
+			name:  "no roots",
+			roots: nil,
+			want:  []bool{false, false, false},
+		},
+		{
+			name: "roots of either side",
+			roots: []Package{
+				{Name: "firefox", Version: "130.0"},
+				{Name: "htop", Version: "3.3.0"},
+			},
+			want: []bool{false, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := []Change{
+				{Name: "firefox", Type: Changed},
+				{Name: "nss", Type: Changed},
+				{Name: "htop", Type: Added},
+			}
+			markDependencies(changes, tt.roots)
+
+			got := make([]bool, len(changes))
+			for i, c := range changes {
+				got[i] = c.Dependency
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
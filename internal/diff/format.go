@@ -0,0 +1,52 @@
+package diff
+
+import "fmt"
+
+// Format selects a ReportRenderer.
+type Format string
+
+const (
+	FormatTerminal Format = "terminal"
+	FormatJSON     Format = "json"
+	FormatMarkdown Format = "markdown"
+)
+
+// ParseFormat validates a --diff-format value. An empty string selects the
+// terminal renderer.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatTerminal, nil
+	case FormatTerminal, FormatJSON, FormatMarkdown:
+		return f, nil
+	case "md":
+		return FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("unknown diff format %q (expected terminal, json or markdown)", s)
+}
+
+// ParseOutput validates a --diff-format and --diff-output pair. Terminal
+// output is meant for humans and is never written to a file.
+func ParseOutput(format, path string) (Output, error) {
+	f, err := ParseFormat(format)
+	if err != nil {
+		return Output{}, err
+	}
+	if path != "" && f == FormatTerminal {
+		return Output{}, fmt.Errorf("--diff-output requires --diff-format json or markdown")
+	}
+	return Output{Format: f, Path: path}, nil
+}
+
+// NewRenderer returns the ReportRenderer for f.
+func NewRenderer(f Format) (ReportRenderer, error) {
+	switch f {
+	case "", FormatTerminal:
+		return NewTerminalRenderer(), nil
+	case FormatJSON:
+		return NewJSONRenderer(), nil
+	case FormatMarkdown:
+		return NewMarkdownRenderer(), nil
+	}
+	return nil, fmt.Errorf("unknown diff format %q", f)
+}
@@ -0,0 +1,34 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		format  string
+		path    string
+		want    Output
+		wantErr bool
+	}{
+		{"", "", Output{Format: FormatTerminal}, false},
+		{"terminal", "", Output{Format: FormatTerminal}, false},
+		{"json", "", Output{Format: FormatJSON}, false},
+		{"md", "diff.md", Output{Format: FormatMarkdown, Path: "diff.md"}, false},
+		{"markdown", "diff.md", Output{Format: FormatMarkdown, Path: "diff.md"}, false},
+		{"terminal", "diff.txt", Output{}, true},
+		{"html", "", Output{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOutput(tt.format, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOutput(%q, %q) error = %v, wantErr %v", tt.format, tt.path, err, tt.wantErr)
+			continue
+		}
+		if diff := deep.Equal(got, tt.want); diff != nil {
+			t.Errorf("ParseOutput(%q, %q): %v", tt.format, tt.path, diff)
+		}
+	}
+}
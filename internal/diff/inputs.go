@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// inputsFile is where the nilla modules record the pinned inputs of a
+// generation.
+const inputsFile = "nilla-inputs.json"
+
+// maxInputsSize is the largest inputs file read.
+const maxInputsSize = 1 << 20
+
+// Repository is the npins description of where a Git pin comes from.
+type Repository struct {
+	Type     string `json:"type"`
+	Owner    string `json:"owner,omitempty"`
+	Repo     string `json:"repo,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Server   string `json:"server,omitempty"`
+	RepoPath string `json:"repo_path,omitempty"`
+}
+
+// Input is a pinned input as recorded in a generation. LastModified is only
+// known for inputs that carry it, npins does not record commit dates.
+type Input struct {
+	Type         string      `json:"type,omitempty"`
+	Repository   *Repository `json:"repository,omitempty"`
+	Branch       string      `json:"branch,omitempty"`
+	Revision     string      `json:"revision,omitempty"`
+	Version      string      `json:"version,omitempty"`
+	URL          string      `json:"url,omitempty"`
+	LastModified int64       `json:"lastModified,omitempty"`
+}
+
+// ref returns what identifies the pinned state of i to a reader: a release
+// version, a revision or, for channels, the url.
+func (i *Input) ref() string {
+	switch {
+	case i.Version != "":
+		return i.Version
+	case i.Revision != "":
+		return i.Revision
+	}
+	return i.URL
+}
+
+// date returns the day i was last modified, or an empty string when unknown.
+func (i *Input) date() string {
+	if i.LastModified == 0 {
+		return ""
+	}
+	return time.Unix(i.LastModified, 0).UTC().Format(time.DateOnly)
+}
+
+// inputDate is how renderers show the date of an input. Pins fetched as
+// tarballs, which includes most npins pins, carry no date.
+func inputDate(date string) string {
+	if date == "" {
+		return "date unknown"
+	}
+	return date
+}
+
+// InputChange is a pinned input that was added, removed or moved to another
+// revision. CompareURL links to the changes between both revisions when the
+// input is hosted on a known forge.
+type InputChange struct {
+	Name       string     `json:"name"`
+	Type       ChangeType `json:"type"`
+	Before     string     `json:"before,omitempty"`
+	After      string     `json:"after,omitempty"`
+	DateBefore string     `json:"dateBefore,omitempty"`
+	DateAfter  string     `json:"dateAfter,omitempty"`
+	CompareURL string     `json:"compareUrl,omitempty"`
+}
+
+type inputsLock struct {
+	Version int               `json:"version"`
+	Inputs  map[string]*Input `json:"inputs"`
+}
+
+// ErrNoInputs is returned by CalculateInputChanges when either generation
+// has no inputs recorded, like generations built before they were.
+var ErrNoInputs = errors.New("no inputs recorded")
+
+// CalculateInputChanges compares the pinned inputs recorded in two
+// generations.
+func CalculateInputChanges(ctx context.Context, from, to *Generation) ([]InputChange, error) {
+	fq, ok := from.Querier.(FileQuerier)
+	if !ok {
+		return nil, fmt.Errorf("querier of %s cannot inspect files", from.Path)
+	}
+	tq, ok := to.Querier.(FileQuerier)
+	if !ok {
+		return nil, fmt.Errorf("querier of %s cannot inspect files", to.Path)
+	}
+
+	before, err := readInputs(ctx, fq, from.Path)
+	if err != nil {
+		return nil, err
+	}
+	after, err := readInputs(ctx, tq, to.Path)
+	if err != nil {
+		return nil, err
+	}
+	return compareInputs(before, after), nil
+}
+
+// readInputs reads the inputs recorded in the generation at path. A file
+// that cannot be read is taken to be missing.
+func readInputs(ctx context.Context, fq FileQuerier, path string) (map[string]*Input, error) {
+	buf, err := fq.ReadFile(ctx, filepath.Join(path, inputsFile), maxInputsSize)
+	if err != nil || len(buf) == 0 {
+		return nil, ErrNoInputs
+	}
+	return parseInputs(buf)
+}
+
+func parseInputs(buf []byte) (map[string]*Input, error) {
+	var lock inputsLock
+	if err := json.Unmarshal(buf, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", inputsFile, err)
+	}
+	if lock.Version != 1 {
+		return nil, fmt.Errorf("unsupported %s version %d", inputsFile, lock.Version)
+	}
+	return lock.Inputs, nil
+}
+
+func compareInputs(before, after map[string]*Input) []InputChange {
+	var changes []InputChange
+	for name, b := range before {
+		a, ok := after[name]
+		switch {
+		case !ok:
+			changes = append(changes, InputChange{Name: name, Type: Removed, Before: b.ref(), DateBefore: b.date()})
+		case a.Revision != b.Revision || a.Version != b.Version || a.URL != b.URL:
+			changes = append(changes, InputChange{
+				Name:       name,
+				Type:       Changed,
+				Before:     b.ref(),
+				After:      a.ref(),
+				DateBefore: b.date(),
+				DateAfter:  a.date(),
+				CompareURL: compareURL(b, a),
+			})
+		}
+	}
+	for name, a := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, InputChange{Name: name, Type: Added, After: a.ref(), DateAfter: a.date()})
+		}
+	}
+	slices.SortFunc(changes, func(a, b InputChange) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return changes
+}
+
+// compareURL links to the commits between two revisions of the same
+// repository on GitHub, GitLab or Forgejo, or returns an empty string.
+func compareURL(before, after *Input) string {
+	r := after.Repository
+	if r == nil || before.Repository == nil || *before.Repository != *r ||
+		before.Revision == "" || after.Revision == "" {
+		return ""
+	}
+	revs := before.Revision + "..." + after.Revision
+
+	switch r.Type {
+	case "GitHub":
+		if r.Owner == "" || r.Repo == "" {
+			return ""
+		}
+		return fmt.Sprintf("https://github.com/%s/%s/compare/%s", r.Owner, r.Repo, revs)
+	case "GitLab":
+		if r.RepoPath == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s/%s/-/compare/%s", serverURL(r.Server, "https://gitlab.com"), r.RepoPath, revs)
+	case "Forgejo":
+		if r.Server == "" || r.Owner == "" || r.Repo == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s/%s/%s/compare/%s", serverURL(r.Server, ""), r.Owner, r.Repo, revs)
+	}
+	return ""
+}
+
+func serverURL(server, fallback string) string {
+	if server == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(server, "/")
+}
+
+// shortRef shortens Git revisions for display, leaving versions and urls as
+// they are.
+func shortRef(ref string) string {
+	if len(ref) == 40 && strings.Trim(ref, "0123456789abcdef") == "" {
+		return ref[:12]
+	}
+	return ref
+}
@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+const (
+	nixpkgsBefore = "6e99f2a27d600612004fbd2c3282d614bfee6421"
+	nixpkgsAfter  = "a1d92660c6b3b7c26fb883500a80ea9d33321be2"
+)
+
+func TestCalculateInputChanges(t *testing.T) {
+	from := &Generation{Path: "/from", Querier: &fileQuerier{files: map[string]string{
+		"/from/nilla-inputs.json": `{"version": 1, "inputs": {
+			"nixpkgs": {"type": "Git", "repository": {"type": "GitHub", "owner": "NixOS", "repo": "nixpkgs"}, "branch": "nixos-unstable", "revision": "` + nixpkgsBefore + `", "url": "https://github.com/NixOS/nixpkgs/archive/` + nixpkgsBefore + `.tar.gz"},
+			"home-manager": {"type": "Git", "repository": {"type": "GitHub", "owner": "nix-community", "repo": "home-manager"}, "branch": "master", "revision": "1111111111111111111111111111111111111111"},
+			"nilla": {"type": "GitRelease", "repository": {"type": "GitHub", "owner": "nilla-nix", "repo": "nilla"}, "version": "v0.1.0", "revision": "2222222222222222222222222222222222222222"},
+			"old": {"type": "Channel", "url": "https://releases.nixos.org/nixos/24.05/nixos-24.05.1/nixexprs.tar.xz"}
+		}}`,
+	}}}
+	to := &Generation{Path: "/to", Querier: &fileQuerier{files: map[string]string{
+		"/to/nilla-inputs.json": `{"version": 1, "inputs": {
+			"nixpkgs": {"type": "Git", "repository": {"type": "GitHub", "owner": "NixOS", "repo": "nixpkgs"}, "branch": "nixos-unstable", "revision": "` + nixpkgsAfter + `", "url": "https://github.com/NixOS/nixpkgs/archive/` + nixpkgsAfter + `.tar.gz", "lastModified": 1725753600},
+			"home-manager": {"type": "Git", "repository": {"type": "GitHub", "owner": "nix-community", "repo": "home-manager"}, "branch": "master", "revision": "1111111111111111111111111111111111111111"},
+			"nilla": {"type": "GitRelease", "repository": {"type": "GitHub", "owner": "nilla-nix", "repo": "nilla"}, "version": "v0.2.0", "revision": "3333333333333333333333333333333333333333"},
+			"new": {"type": "Git", "repository": {"type": "Git", "url": "https://example.org/new.git"}, "revision": "4444444444444444444444444444444444444444"}
+		}}`,
+	}}}
+
+	got, err := CalculateInputChanges(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []InputChange{
+		{Name: "new", Type: Added, After: "4444444444444444444444444444444444444444"},
+		{
+			Name:       "nilla",
+			Type:       Changed,
+			Before:     "v0.1.0",
+			After:      "v0.2.0",
+			CompareURL: "https://github.com/nilla-nix/nilla/compare/2222222222222222222222222222222222222222...3333333333333333333333333333333333333333",
+		},
+		{
+			Name:       "nixpkgs",
+			Type:       Changed,
+			Before:     nixpkgsBefore,
+			After:      nixpkgsAfter,
+			DateAfter:  "2024-09-08",
+			CompareURL: "https://github.com/NixOS/nixpkgs/compare/" + nixpkgsBefore + "..." + nixpkgsAfter,
+		},
+		{Name: "old", Type: Removed, Before: "https://releases.nixos.org/nixos/24.05/nixos-24.05.1/nixexprs.tar.xz"},
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCalculateInputChangesNotRecorded(t *testing.T) {
+	from := &Generation{Path: "/from", Querier: &fileQuerier{}}
+	to := &Generation{Path: "/to", Querier: &fileQuerier{files: map[string]string{
+		"/to/nilla-inputs.json": `{"version": 1, "inputs": {}}`,
+	}}}
+
+	if _, err := CalculateInputChanges(context.Background(), from, to); !errors.Is(err, ErrNoInputs) {
+		t.Errorf("expected ErrNoInputs, got %v", err)
+	}
+}
+
+func TestCompareURL(t *testing.T) {
+	pin := func(r Repository, rev string) *Input {
+		return &Input{Repository: &r, Revision: rev}
+	}
+
+	tests := []struct {
+		name   string
+		before *Input
+		after  *Input
+		want   string
+	}{
+		{
+			name:   "github",
+			before: pin(Repository{Type: "GitHub", Owner: "o", Repo: "r"}, "a"),
+			after:  pin(Repository{Type: "GitHub", Owner: "o", Repo: "r"}, "b"),
+			want:   "https://github.com/o/r/compare/a...b",
+		},
+		{
+			name:   "gitlab",
+			before: pin(Repository{Type: "GitLab", RepoPath: "g/p", Server: "https://gitlab.example.org/"}, "a"),
+			after:  pin(Repository{Type: "GitLab", RepoPath: "g/p", Server: "https://gitlab.example.org/"}, "b"),
+			want:   "https://gitlab.example.org/g/p/-/compare/a...b",
+		},
+		{
+			name:   "forgejo",
+			before: pin(Repository{Type: "Forgejo", Server: "https://codeberg.org/", Owner: "o", Repo: "r"}, "a"),
+			after:  pin(Repository{Type: "Forgejo", Server: "https://codeberg.org/", Owner: "o", Repo: "r"}, "b"),
+			want:   "https://codeberg.org/o/r/compare/a...b",
+		},
+		{
+			name:   "plain git",
+			before: pin(Repository{Type: "Git", URL: "https://example.org/r.git"}, "a"),
+			after:  pin(Repository{Type: "Git", URL: "https://example.org/r.git"}, "b"),
+		},
+		{
+			name:   "moved repository",
+			before: pin(Repository{Type: "GitHub", Owner: "o", Repo: "r"}, "a"),
+			after:  pin(Repository{Type: "GitHub", Owner: "fork", Repo: "r"}, "b"),
+		},
+		{
+			name:   "channel",
+			before: &Input{URL: "https://releases.nixos.org/a"},
+			after:  &Input{URL: "https://releases.nixos.org/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareURL(tt.before, tt.after); got != tt.want {
+				t.Errorf("compareURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderInputs(t *testing.T) {
+	r := Report{
+		Inputs: []InputChange{
+			{
+				Name:       "nixpkgs",
+				Type:       Changed,
+				Before:     nixpkgsBefore,
+				After:      nixpkgsAfter,
+				DateAfter:  "2024-09-08",
+				CompareURL: "https://github.com/NixOS/nixpkgs/compare/" + nixpkgsBefore + "..." + nixpkgsAfter,
+			},
+		},
+	}
+
+	var term bytes.Buffer
+	if err := NewTerminalRenderer().Render(&term, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Inputs:",
+		"6e99f2a27d60 (date unknown)",
+		"a1d92660c6b3 (2024-09-08)",
+		"https://github.com/NixOS/nixpkgs/compare/",
+	} {
+		if !strings.Contains(term.String(), want) {
+			t.Errorf("terminal output missing %q:\n%s", want, term.String())
+		}
+	}
+
+	var md bytes.Buffer
+	if err := NewMarkdownRenderer().Render(&md, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"### Inputs",
+		"| nixpkgs | `6e99f2a27d60` (date unknown) | `a1d92660c6b3` (2024-09-08) | [compare](https://github.com/NixOS/nixpkgs/compare/",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown output missing %q:\n%s", want, md.String())
+		}
+	}
+}
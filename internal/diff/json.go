@@ -0,0 +1,24 @@
+package diff
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonRenderer struct{}
+
+// NewJSONRenderer returns a renderer that writes the full report as indented
+// JSON.
+func NewJSONRenderer() ReportRenderer {
+	return &jsonRenderer{}
+}
+
+func (j *jsonRenderer) Render(w io.Writer, r Report) error {
+	// Always emit an array, consumers should not have to handle null.
+	if r.Changes == nil {
+		r.Changes = []Change{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
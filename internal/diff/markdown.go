@@ -0,0 +1,227 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type markdownRenderer struct{}
+
+// NewMarkdownRenderer returns a renderer that writes GitHub-flavoured Markdown
+// tables, suitable for merge request comments and chat.
+func NewMarkdownRenderer() ReportRenderer {
+	return &markdownRenderer{}
+}
+
+func (m *markdownRenderer) Render(w io.Writer, r Report) error {
+	var direct, deps, rebuilt []Change
+	for _, c := range r.Changes {
+		switch {
+		case c.Type == Rebuilt:
+			rebuilt = append(rebuilt, c)
+		case c.Dependency:
+			deps = append(deps, c)
+		default:
+			direct = append(direct, c)
+		}
+	}
+
+	if len(r.Inputs) > 0 {
+		m.renderInputs(w, r.Inputs)
+	}
+
+	if len(direct)+len(deps) == 0 {
+		fmt.Fprintln(w, "No version changes.")
+		fmt.Fprintln(w)
+	}
+
+	m.renderGroup(w, direct, changeTitles)
+	m.renderGroup(w, deps, dependencyTitles)
+
+	if len(rebuilt) > 0 {
+		m.renderRebuilt(w, rebuilt)
+	}
+
+	growers := r.TopGrowers(topSizeChanges)
+	shrinkers := r.TopShrinkers(topSizeChanges)
+	if len(growers) > 0 || len(shrinkers) > 0 {
+		fmt.Fprintln(w, "### Largest size changes")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Package | Before | After | Change |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- |")
+		for _, c := range append(growers, shrinkers...) {
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n",
+				markdownCell(string(c.Name)), formatSize(c.Before), formatSize(c.After), formatSizeDelta(c.Before, c.After))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if r.Config != nil {
+		m.renderConfig(w, r.Config)
+	}
+
+	fmt.Fprintf(w, "**Closure size:** %d → %d (disk usage %s)\n",
+		r.NumBefore, r.NumAfter, formatSizeDelta(r.BytesBefore, r.BytesAfter))
+	return nil
+}
+
+func (m *markdownRenderer) renderGroup(w io.Writer, changes []Change, titles groupTitles) {
+	var changed, outputs, added, removed []Change
+	for _, c := range changes {
+		switch c.Type {
+		case Changed:
+			changed = append(changed, c)
+		case OutputsChanged:
+			outputs = append(outputs, c)
+		case Added:
+			added = append(added, c)
+		case Removed:
+			removed = append(removed, c)
+		}
+	}
+
+	if len(changed) > 0 {
+		fmt.Fprintf(w, "### %s\n\n", titles.version)
+		fmt.Fprintf(w, "%s.\n\n", bumpSummary(changed))
+		fmt.Fprintln(w, "| Package | Before | After | Update | Size |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+		for _, c := range changed {
+			size := ""
+			if c.SizeBefore != 0 || c.SizeAfter != 0 {
+				size = formatSizeDelta(c.SizeBefore, c.SizeAfter)
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n",
+				markdownCell(string(c.Name)), markdownVersions(c.Before), markdownVersions(c.After), markdownBump(c.Bump), size)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(outputs) > 0 {
+		fmt.Fprintf(w, "### %s\n\n", titles.outputs)
+		fmt.Fprintln(w, "| Package | Version | Added outputs | Removed outputs |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- |")
+		for _, c := range outputs {
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", markdownCell(string(c.Name)), markdownVersions(c.After),
+				markdownCell(strings.Join(c.OutputsAdded, ", ")), markdownCell(strings.Join(c.OutputsRemoved, ", ")))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(added) > 0 {
+		m.renderList(w, titles.added, added, func(c Change) ([]Version, int64) { return c.After, c.SizeAfter })
+	}
+	if len(removed) > 0 {
+		m.renderList(w, titles.removed, removed, func(c Change) ([]Version, int64) { return c.Before, c.SizeBefore })
+	}
+}
+
+func (m *markdownRenderer) renderList(w io.Writer, title string, changes []Change, side func(Change) ([]Version, int64)) {
+	fmt.Fprintf(w, "### %s\n\n", title)
+	fmt.Fprintln(w, "| Package | Version | Size |")
+	fmt.Fprintln(w, "| --- | --- | --- |")
+	for _, c := range changes {
+		vers, size := side(c)
+		sizeStr := ""
+		if size != 0 {
+			sizeStr = formatSize(size)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s |\n", markdownCell(string(c.Name)), markdownVersions(vers), sizeStr)
+	}
+	fmt.Fprintln(w)
+}
+
+// renderRebuilt lists the rebuilt packages in a collapsed section, as a mass
+// rebuild can name hundreds of them.
+func (m *markdownRenderer) renderRebuilt(w io.Writer, rebuilt []Change) {
+	fmt.Fprintln(w, "### Rebuilt packages")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "<details>")
+	fmt.Fprintf(w, "<summary>%d packages rebuilt without a version change</summary>\n\n", len(rebuilt))
+	fmt.Fprintln(w, "| Package | Version | Size |")
+	fmt.Fprintln(w, "| --- | --- | --- |")
+	for _, c := range rebuilt {
+		size := ""
+		if c.SizeBefore != 0 || c.SizeAfter != 0 {
+			size = formatSizeDelta(c.SizeBefore, c.SizeAfter)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s |\n", markdownCell(string(c.Name)), markdownVersions(c.After), size)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "</details>")
+	fmt.Fprintln(w)
+}
+
+func (m *markdownRenderer) renderInputs(w io.Writer, inputs []InputChange) {
+	fmt.Fprintln(w, "### Inputs")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Input | Before | After | Changes |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+	for _, in := range inputs {
+		link := ""
+		if in.CompareURL != "" {
+			link = fmt.Sprintf("[compare](%s)", in.CompareURL)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", markdownCell(in.Name),
+			markdownInputRef(in.Before, in.DateBefore), markdownInputRef(in.After, in.DateAfter), link)
+	}
+	fmt.Fprintln(w)
+}
+
+func markdownInputRef(ref, date string) string {
+	if ref == "" {
+		return "*none*"
+	}
+	s := "`" + strings.ReplaceAll(shortRef(ref), "`", "") + "` (" + inputDate(date) + ")"
+	return markdownCell(s)
+}
+
+func (m *markdownRenderer) renderConfig(w io.Writer, c *ConfigReport) {
+	for _, sec := range configSections(c) {
+		if len(sec.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "### %s\n\n", sec.title)
+		for _, fc := range sec.changes {
+			fmt.Fprintf(w, "- %s `%s`\n", fc.Type, strings.ReplaceAll(fc.Path, "`", ""))
+			if fc.Diff != "" {
+				fmt.Fprintf(w, "\n  ```diff\n")
+				for _, line := range splitDiffLines(fc.Diff) {
+					fmt.Fprintf(w, "  %s\n", line)
+				}
+				fmt.Fprintf(w, "  ```\n\n")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func markdownVersions(vers []Version) string {
+	if len(vers) == 0 {
+		return "*none*"
+	}
+	parts := make([]string, len(vers))
+	for i, v := range vers {
+		if v == "" {
+			parts[i] = "*none*"
+			continue
+		}
+		parts[i] = "`" + strings.ReplaceAll(string(v), "`", "") + "`"
+	}
+	return markdownCell(strings.Join(parts, ", "))
+}
+
+// markdownCell escapes the characters that would break a table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, `|`, `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// markdownBump renders a bump class, emphasising the risky ones.
+func markdownBump(b Bump) string {
+	switch b {
+	case BumpDowngrade, BumpMajor:
+		return "**" + b.String() + "**"
+	case BumpNone:
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"context"
+	"sync"
+)
+
+// memoQuerier wraps a StoreQuerier and remembers results per store path for
+// its own lifetime. Walking a range of generations queries every generation
+// twice (once as the newer and once as the older side), which this halves.
+type memoQuerier struct {
+	inner StoreQuerier
+
+	mu        sync.Mutex
+	packages  map[string][]Package
+	sizes     map[string]int64
+	pathSizes map[string]map[string]int64
+}
+
+// NewMemoQuerier returns a StoreQuerier that caches the results of q in memory.
+func NewMemoQuerier(q StoreQuerier) StoreQuerier {
+	return &memoQuerier{
+		inner:     q,
+		packages:  map[string][]Package{},
+		sizes:     map[string]int64{},
+		pathSizes: map[string]map[string]int64{},
+	}
+}
+
+func (q *memoQuerier) QueryPackages(ctx context.Context, path string) ([]Package, error) {
+	q.mu.Lock()
+	pkgs, ok := q.packages[path]
+	q.mu.Unlock()
+	if ok {
+		return pkgs, nil
+	}
+
+	pkgs, err := q.inner.QueryPackages(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.packages[path] = pkgs
+	q.mu.Unlock()
+	return pkgs, nil
+}
+
+func (q *memoQuerier) GetClosureSize(ctx context.Context, path string) (int64, error) {
+	q.mu.Lock()
+	size, ok := q.sizes[path]
+	q.mu.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	size, err := q.inner.GetClosureSize(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	q.sizes[path] = size
+	q.mu.Unlock()
+	return size, nil
+}
+
+func (q *memoQuerier) GetPathSizes(ctx context.Context, path string) (map[string]int64, error) {
+	q.mu.Lock()
+	sizes, ok := q.pathSizes[path]
+	q.mu.Unlock()
+	if ok {
+		return sizes, nil
+	}
+
+	sizes, err := q.inner.GetPathSizes(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.pathSizes[path] = sizes
+	q.mu.Unlock()
+	return sizes, nil
+}
+
+// WhyDepends is not cached, it is only run on request.
+func (q *memoQuerier) WhyDepends(ctx context.Context, path string, pkg PackageName) ([]string, error) {
+	return q.inner.WhyDepends(ctx, path, pkg)
+}
+
+// QueryRoots is not cached, it only queries the direct references of roots.
+func (q *memoQuerier) QueryRoots(ctx context.Context, path string, roots []string) ([]Package, error) {
+	return q.inner.QueryRoots(ctx, path, roots)
+}
@@ -0,0 +1,59 @@
+package diff
+
+import (
+	"context"
+	"testing"
+)
+
+type countingQuerier struct {
+	packages, sizes, pathSizes int
+}
+
+func (q *countingQuerier) QueryPackages(ctx context.Context, path string) ([]Package, error) {
+	q.packages++
+	return []Package{{Name: "hello", Version: "2.12", Path: path}}, nil
+}
+
+func (q *countingQuerier) GetClosureSize(ctx context.Context, path string) (int64, error) {
+	q.sizes++
+	return 42, nil
+}
+
+func (q *countingQuerier) GetPathSizes(ctx context.Context, path string) (map[string]int64, error) {
+	q.pathSizes++
+	return map[string]int64{path: 42}, nil
+}
+
+func (q *countingQuerier) WhyDepends(ctx context.Context, path string, pkg PackageName) ([]string, error) {
+	return []string{path}, nil
+}
+
+func (q *countingQuerier) QueryRoots(ctx context.Context, path string, roots []string) ([]Package, error) {
+	return nil, nil
+}
+
+func TestMemoQuerier(t *testing.T) {
+	inner := &countingQuerier{}
+	q := NewMemoQuerier(inner)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := q.QueryPackages(ctx, "/nix/var/nix/profiles/system-1-link"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.GetClosureSize(ctx, "/nix/var/nix/profiles/system-1-link"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.GetPathSizes(ctx, "/nix/var/nix/profiles/system-1-link"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := q.QueryPackages(ctx, "/nix/var/nix/profiles/system-2-link"); err != nil {
+		t.Fatal(err)
+	}
+
+	if inner.packages != 2 || inner.sizes != 1 || inner.pathSizes != 1 {
+		t.Errorf("got %d package, %d size and %d path size queries, want 2, 1 and 1",
+			inner.packages, inner.sizes, inner.pathSizes)
+	}
+}
@@ -4,19 +4,30 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"regexp"
+	"maps"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"charm.land/log/v2"
 	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/nix"
 	"github.com/valyala/fastjson"
 )
 
-var storePathRegex = regexp.MustCompile(`^/nix/store/[a-z0-9]+-(.+?)(?:-([0-9].*?))?(?:\.drv)?$`)
-
 // StoreQuerier abstracts Nix store operations.
 type StoreQuerier interface {
 	QueryPackages(ctx context.Context, generationPath string) ([]Package, error)
 	GetClosureSize(ctx context.Context, generationPath string) (int64, error)
+	// GetPathSizes returns the NAR size of every store path in the closure of
+	// generationPath.
+	GetPathSizes(ctx context.Context, generationPath string) (map[string]int64, error)
+	// WhyDepends returns the shortest reference chain from generationPath to
+	// a store path of pkg.
+	WhyDepends(ctx context.Context, generationPath string, pkg PackageName) ([]string, error)
+	// QueryRoots returns the packages directly referenced by roots, which are
+	// relative to generationPath. Roots that do not exist are skipped.
+	QueryRoots(ctx context.Context, generationPath string, roots []string) ([]Package, error)
 }
 
 type executorQuerier struct {
@@ -29,11 +40,37 @@ func NewExecutorQuerier(e exec.Executor) StoreQuerier {
 }
 
 func (q *executorQuerier) QueryPackages(ctx context.Context, path string) ([]Package, error) {
-	paths, err := q.resolveClosurePaths(ctx, path)
+	reqs, err := q.queryRequisites(path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("query requisites: %w", err)
+	}
+	return packagesFromPaths(splitLines(reqs)), nil
+}
+
+func (q *executorQuerier) QueryRoots(ctx context.Context, path string, roots []string) ([]Package, error) {
+	var paths []string
+	for _, root := range roots {
+		rootPath := path + "/" + root
+		exists, err := q.exec.PathExists(rootPath)
+		if err != nil {
+			return nil, fmt.Errorf("check path exists: %w", err)
+		}
+		if !exists {
+			continue
+		}
+
+		refs, err := q.queryReferences(rootPath)
+		if err != nil {
+			return nil, fmt.Errorf("query references of %s: %w", root, err)
+		}
+		paths = append(paths, splitLines(refs)...)
 	}
+	return packagesFromPaths(paths), nil
+}
 
+// packagesFromPaths parses store paths into packages, skipping duplicates and
+// paths that are not packages.
+func packagesFromPaths(paths []string) []Package {
 	var packages []Package
 	seen := make(map[string]struct{})
 
@@ -52,51 +89,81 @@ func (q *executorQuerier) QueryPackages(ctx context.Context, path string) ([]Pac
 		}
 	}
 
-	return packages, nil
+	return packages
 }
 
 func (q *executorQuerier) GetClosureSize(ctx context.Context, path string) (int64, error) {
-	buf := &bytes.Buffer{}
-	cmd, err := q.exec.Command("nix", "path-info", "--json", "--closure-size", path)
+	out, err := q.runPathInfo(ctx, "--closure-size", path)
 	if err != nil {
-		return 0, fmt.Errorf("create command: %w", err)
+		return 0, err
 	}
-	cmd.SetStdout(buf)
+	return decodeClosureSize(out, q.pathInfoLayout(ctx))
+}
 
-	if err := cmd.Run(); err != nil {
-		return 0, fmt.Errorf("nix path-info failed: %w", err)
+func (q *executorQuerier) GetPathSizes(ctx context.Context, path string) (map[string]int64, error) {
+	out, err := q.runPathInfo(ctx, "--recursive", path)
+	if err != nil {
+		return nil, err
 	}
-
-	return decodeClosureSize(buf.Bytes())
+	return decodeNarSizes(out, q.pathInfoLayout(ctx))
 }
 
-func (q *executorQuerier) resolveClosurePaths(ctx context.Context, path string) ([]string, error) {
-	swPath := path + "/sw"
-	swExists, err := q.exec.PathExists(swPath)
-	if err != nil {
-		return nil, fmt.Errorf("check path exists: %w", err)
+func (q *executorQuerier) LinkTargets(ctx context.Context, dir string) (map[string]string, error) {
+	exists, err := q.exec.PathExists(dir)
+	if err != nil || !exists {
+		return map[string]string{}, err
 	}
 
-	var allPaths []string
+	// find does not follow symlinks, so it cannot fail on a dangling one.
+	// Symlinks into directories are walked in the next round instead, as
+	// NixOS links whole directories such as systemd/system into etc/.
+	targets := map[string]string{}
+	var regular []string
+	roots := []string{dir}
+	for round := 0; len(roots) > 0; round++ {
+		if round == maxLinkRounds {
+			return nil, fmt.Errorf("list links: directory symlinks below %s nest too deep", dir)
+		}
+		args := append([]string{"-H"}, roots...)
+		out, err := q.runFind(append(args, "-mindepth", "1", "-printf", "%Y,%l,", "-print0")...)
+		if err != nil {
+			return nil, fmt.Errorf("list links: %w", err)
+		}
+		links, files, dirs := parseLinks(string(out), dir)
+		maps.Copy(targets, links)
+		regular = append(regular, files...)
+		roots = dirs
+	}
 
-	if swExists {
-		// Try /sw first; if query fails, fall back to base path
-		refs, err := q.queryReferences(swPath)
-		if err == nil {
-			reqs, _ := q.queryRequisites(path)
-			allPaths = append(allPaths, splitLines(refs)...)
-			allPaths = append(allPaths, splitLines(reqs)...)
-			return allPaths, nil
+	// Files that are no symlinks are few, hash them instead
+	if len(regular) > 0 {
+		paths := make([]string, len(regular))
+		for i, f := range regular {
+			paths[i] = filepath.Join(dir, f)
+		}
+		out, err := q.runCommand("sha256sum", paths...)
+		if err != nil {
+			return nil, fmt.Errorf("hash files: %w", err)
 		}
+		maps.Copy(targets, parseHashes(string(out), dir))
 	}
+	return targets, nil
+}
 
-	// Fallback: query base path directly
-	reqs, err := q.queryRequisites(path)
+func (q *executorQuerier) ListFiles(ctx context.Context, dir string) ([]string, error) {
+	exists, err := q.exec.PathExists(dir)
+	if err != nil || !exists {
+		return nil, err
+	}
+	out, err := q.runFind("-L", dir, "-type", "f")
 	if err != nil {
-		return nil, fmt.Errorf("query requisites: %w", err)
+		return nil, fmt.Errorf("list files: %w", err)
 	}
-	allPaths = append(allPaths, splitLines(reqs)...)
-	return allPaths, nil
+	return parseFileList(string(out), dir), nil
+}
+
+func (q *executorQuerier) ReadFile(ctx context.Context, path string, limit int) ([]byte, error) {
+	return q.runCommand("head", "-c", strconv.Itoa(limit), path)
 }
 
 func (q *executorQuerier) queryReferences(path string) ([]byte, error) {
@@ -107,9 +174,38 @@ func (q *executorQuerier) queryRequisites(path string) ([]byte, error) {
 	return q.runNixStore("--query", "--requisites", path)
 }
 
+// runPathInfo runs nix path-info --json through nix.Command, which enables
+// the nix-command feature and checks the probed version.
+func (q *executorQuerier) runPathInfo(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := nix.Command("path-info").
+		Executor(q.exec).
+		Args(append([]string{"--json"}, args...)).
+		Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("nix path-info failed: %w", err)
+	}
+	return out, nil
+}
+
+// pathInfoLayout returns the nix path-info --json layout of the host's Nix,
+// which picks the decoder of its output, or PathInfoUnknown to go by the
+// shape of the output when the version cannot be probed.
+func (q *executorQuerier) pathInfoLayout(ctx context.Context) nix.PathInfoLayout {
+	info, err := nix.Probe(ctx, q.exec)
+	if err != nil {
+		log.Debugf("Detecting nix path-info layout from its output: %s", err)
+		return nix.PathInfoUnknown
+	}
+	return info.PathInfoLayout()
+}
+
 func (q *executorQuerier) runNixStore(args ...string) ([]byte, error) {
+	return q.runCommand("nix-store", args...)
+}
+
+func (q *executorQuerier) runCommand(name string, args ...string) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	cmd, err := q.exec.Command("nix-store", args...)
+	cmd, err := q.exec.Command(name, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -120,20 +216,22 @@ func (q *executorQuerier) runNixStore(args ...string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func parsePackageFromPath(path string) *Package {
-	matches := storePathRegex.FindStringSubmatch(path)
-	if len(matches) < 2 {
-		return nil
-	}
-	ver := ""
-	if len(matches) > 2 {
-		ver = matches[2]
+// runFind runs find, keeping what it printed when it fails part way, e.g. on
+// an unreadable directory, as the rest of the tree was still walked.
+func (q *executorQuerier) runFind(args ...string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	cmd, err := q.exec.Command("find", args...)
+	if err != nil {
+		return nil, err
 	}
-	return &Package{
-		Name:    PackageName(matches[1]),
-		Version: Version(ver),
-		Path:    path,
+	cmd.SetStdout(buf)
+	if err := cmd.Run(); err != nil {
+		if buf.Len() == 0 {
+			return nil, err
+		}
+		log.Debugf("find %s: %s", strings.Join(args, " "), err)
 	}
+	return buf.Bytes(), nil
 }
 
 func splitLines(b []byte) []string {
@@ -143,37 +241,90 @@ func splitLines(b []byte) []string {
 	return strings.Split(strings.TrimSpace(string(b)), "\n")
 }
 
-func decodeClosureSize(buf []byte) (int64, error) {
+// pathInfo is the entry of a single store path in nix path-info output.
+type pathInfo struct {
+	path string
+	info *fastjson.Value
+}
+
+// parsePathInfo parses nix path-info --json output, which is an array of
+// objects with a "path" key in older Nix versions and Lix, and an object keyed
+// by store path in newer ones. The layout of the probed version picks the
+// decoder. When the version is unknown, or the output has the other shape, as
+// from a fork or backport that does not match its version, the shape of the
+// output picks it instead.
+func parsePathInfo(buf []byte, layout nix.PathInfoLayout) ([]pathInfo, error) {
 	val, err := fastjson.ParseBytes(buf)
 	if err != nil {
-		return 0, fmt.Errorf("parse json: %w", err)
+		return nil, fmt.Errorf("parse json: %w", err)
 	}
 
+	shape := nix.PathInfoUnknown
 	switch val.Type() {
 	case fastjson.TypeArray:
-		arr := val.GetArray()
-		if len(arr) == 0 {
-			return 0, nil
+		shape = nix.PathInfoArray
+	case fastjson.TypeObject:
+		shape = nix.PathInfoObject
+	}
+	if layout != shape {
+		if layout != nix.PathInfoUnknown {
+			log.Debugf("nix path-info returned an %s, not the layout expected from its version", val.Type())
 		}
-		return arr[0].GetInt64("closureSize"), nil
+		layout = shape
+	}
 
-	case fastjson.TypeObject:
-		obj := val.GetObject()
-		var key string
-		obj.Visit(func(k []byte, v *fastjson.Value) {
-			if key == "" {
-				key = string(k)
-			}
-		})
-		if key == "" {
-			return 0, nil
+	switch layout {
+	case nix.PathInfoArray:
+		return decodePathInfoArray(val), nil
+	case nix.PathInfoObject:
+		return decodePathInfoObject(val), nil
+	}
+	return nil, fmt.Errorf("unexpected nix path-info output: %s", val.Type())
+}
+
+// decodePathInfoArray decodes the array layout, in output order.
+func decodePathInfoArray(val *fastjson.Value) []pathInfo {
+	var infos []pathInfo
+	for _, v := range val.GetArray() {
+		if v.Type() == fastjson.TypeObject {
+			infos = append(infos, pathInfo{path: string(v.GetStringBytes("path")), info: v})
 		}
-		gen := obj.Get(key)
-		if gen == nil {
-			return 0, nil
+	}
+	return infos
+}
+
+// decodePathInfoObject decodes the object layout, in output order.
+func decodePathInfoObject(val *fastjson.Value) []pathInfo {
+	var infos []pathInfo
+	val.GetObject().Visit(func(k []byte, v *fastjson.Value) {
+		if v.Type() == fastjson.TypeObject {
+			infos = append(infos, pathInfo{path: string(k), info: v})
 		}
-		return gen.GetInt64("closureSize"), nil
+	})
+	return infos
+}
+
+func decodeClosureSize(buf []byte, layout nix.PathInfoLayout) (int64, error) {
+	infos, err := parsePathInfo(buf, layout)
+	if err != nil || len(infos) == 0 {
+		return 0, err
 	}
+	return infos[0].info.GetInt64("closureSize"), nil
+}
 
-	return 0, nil
+// decodeNarSizes decodes the NAR size of every path in nix path-info --json
+// output.
+func decodeNarSizes(buf []byte, layout nix.PathInfoLayout) (map[string]int64, error) {
+	infos, err := parsePathInfo(buf, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := map[string]int64{}
+	for _, i := range infos {
+		if i.path != "" {
+			sizes[i.path] = i.info.GetInt64("narSize")
+		}
+	}
+	return sizes, nil
 }
@@ -3,74 +3,10 @@ package diff
 import (
 	"testing"
 
+	"github.com/arnarg/nilla-utils/internal/nix"
 	"github.com/go-test/deep"
 )
 
-func TestParsePackageFromPath(t *testing.T) {
-	tests := []struct {
-		name string
-		in   string
-		want *Package
-	}{
-		{
-			name: "package with simple version",
-			in:   "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13",
-			want: &Package{
-				Name:    "gzip",
-				Version: "1.13",
-				Path:    "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13",
-			},
-		},
-		{
-			name: "package with output suffix",
-			in:   "/nix/store/3bl0g75vyjgg8gnggwiavbwdxyg6gv20-gnutar-1.35-info",
-			want: &Package{
-				Name:    "gnutar",
-				Version: "1.35-info",
-				Path:    "/nix/store/3bl0g75vyjgg8gnggwiavbwdxyg6gv20-gnutar-1.35-info",
-			},
-		},
-		{
-			name: "package without version",
-			in:   "/nix/store/i6fl7i35dacvxqpzya6h78nacciwryfh-nixos-rebuild",
-			want: &Package{
-				Name:    "nixos-rebuild",
-				Version: "",
-				Path:    "/nix/store/i6fl7i35dacvxqpzya6h78nacciwryfh-nixos-rebuild",
-			},
-		},
-		{
-			name: "package with .drv suffix",
-			in:   "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13.drv",
-			want: &Package{
-				Name:    "gzip",
-				Version: "1.13",
-				Path:    "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13.drv",
-			},
-		},
-		{
-			name: "invalid path",
-			in:   "/not/a/nix/store/path",
-			want: nil,
-		},
-		{
-			name: "empty string",
-			in:   "",
-			want: nil,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parsePackageFromPath(tt.in)
-
-			if diff := deep.Equal(got, tt.want); diff != nil {
-				t.Error(diff)
-			}
-		})
-	}
-}
-
 func TestSplitLines(t *testing.T) {
 	tests := []struct {
 		name string
@@ -119,6 +55,7 @@ func TestDecodeClosureSize(t *testing.T) {
 	tests := []struct {
 		name    string
 		in      []byte
+		layout  nix.PathInfoLayout
 		want    int64
 		wantErr bool
 	}{
@@ -148,11 +85,40 @@ func TestDecodeClosureSize(t *testing.T) {
 			want:    0,
 			wantErr: true,
 		},
+		{
+			name:    "neither array nor object",
+			in:      []byte(`42`),
+			wantErr: true,
+		},
+		{
+			name:   "expected array format",
+			in:     []byte(`[{"closureSize": 12345}]`),
+			layout: nix.PathInfoArray,
+			want:   12345,
+		},
+		{
+			name:   "expected object format",
+			in:     []byte(`{"/nix/store/xxx": {"closureSize": 67890}}`),
+			layout: nix.PathInfoObject,
+			want:   67890,
+		},
+		{
+			name:   "object format despite array hint",
+			in:     []byte(`{"/nix/store/xxx": {"closureSize": 67890}}`),
+			layout: nix.PathInfoArray,
+			want:   67890,
+		},
+		{
+			name:   "array format despite object hint",
+			in:     []byte(`[{"closureSize": 12345}]`),
+			layout: nix.PathInfoObject,
+			want:   12345,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := decodeClosureSize(tt.in)
+			got, err := decodeClosureSize(tt.in, tt.layout)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("decodeClosureSize() error = %v, wantErr %v", err, tt.wantErr)
@@ -165,3 +131,51 @@ func TestDecodeClosureSize(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeNarSizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    map[string]int64
+		wantErr bool
+	}{
+		{
+			name: "array format",
+			in:   []byte(`[{"path": "/nix/store/a-foo", "narSize": 10}, {"path": "/nix/store/b-bar", "narSize": 20}]`),
+			want: map[string]int64{"/nix/store/a-foo": 10, "/nix/store/b-bar": 20},
+		},
+		{
+			name: "object format",
+			in:   []byte(`{"/nix/store/a-foo": {"narSize": 10}, "/nix/store/b-bar": null}`),
+			want: map[string]int64{"/nix/store/a-foo": 10},
+		},
+		{
+			name: "empty array",
+			in:   []byte(`[]`),
+			want: map[string]int64{},
+		},
+		{
+			name:    "invalid json",
+			in:      []byte(`not json`),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeNarSizes(tt.in, nix.PathInfoUnknown)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeNarSizes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
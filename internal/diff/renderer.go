@@ -17,8 +17,15 @@ var (
 	colorRemoved = lipgloss.Color("1")
 	colorAdded   = lipgloss.Color("2")
 	colorPackage = lipgloss.Color("10")
+	colorMajor   = lipgloss.Color("5")
 )
 
+// topSizeChanges is how many of the largest growers and shrinkers are shown.
+const topSizeChanges = 5
+
+// topRebuilt is how many rebuilt packages are named in the terminal output.
+const topRebuilt = 10
+
 // Renderer handles output formatting.
 type ReportRenderer interface {
 	Render(w io.Writer, report Report) error
@@ -31,57 +38,202 @@ func NewTerminalRenderer() ReportRenderer {
 }
 
 func (t *terminalRenderer) Render(w io.Writer, r Report) error {
-	if len(r.Changes) == 0 {
-		fmt.Fprintln(w, "No version changes.")
-		t.renderStats(w, r)
-		return nil
-	}
-
-	// Split into categories
-	var changed, added, removed []Change
+	// Split into user-facing changes, dependency changes and rebuilds
+	var direct, deps, rebuilt []Change
 	for _, c := range r.Changes {
-		switch c.Type {
-		case Changed:
-			changed = append(changed, c)
-		case Added:
-			added = append(added, c)
-		case Removed:
-			removed = append(removed, c)
+		switch {
+		case c.Type == Rebuilt:
+			rebuilt = append(rebuilt, c)
+		case c.Dependency:
+			deps = append(deps, c)
+		default:
+			direct = append(direct, c)
 		}
 	}
 
 	// Calculate column widths
-	total := len(r.Changes)
+	total := len(direct) + len(deps)
 	numWidth := len(strconv.Itoa(total))
 	nameWidth := 0
 	for _, c := range r.Changes {
-		if len(c.Name) > nameWidth {
+		if c.Type != Rebuilt && len(c.Name) > nameWidth {
 			nameWidth = len(c.Name)
 		}
 	}
 
 	// Render sections
+	t.renderInputs(w, r.Inputs)
+	if total == 0 {
+		fmt.Fprintln(w, "No version changes.")
+	}
+	num := t.renderGroup(w, direct, changeTitles, 0, numWidth, nameWidth)
+	t.renderGroup(w, deps, dependencyTitles, num, numWidth, nameWidth)
+
+	t.renderRebuilt(w, rebuilt)
+	t.renderSizeChanges(w, r)
+	t.renderConfig(w, r.Config)
+	t.renderStats(w, r)
+	return nil
+}
+
+// groupTitles are the section titles of a group of changes.
+type groupTitles struct {
+	version, outputs, added, removed string
+}
+
+var (
+	changeTitles = groupTitles{
+		"Version changes", "Output changes", "Added packages", "Removed packages",
+	}
+	dependencyTitles = groupTitles{
+		"Dependency version changes", "Dependency output changes", "Added dependencies", "Removed dependencies",
+	}
+)
+
+// renderGroup renders changes split by type, numbering them from offset+1,
+// and returns the number of the last change rendered.
+func (t *terminalRenderer) renderGroup(w io.Writer, changes []Change, titles groupTitles, offset, numWidth, nameWidth int) int {
+	var changed, outputs, added, removed []Change
+	for _, c := range changes {
+		switch c.Type {
+		case Changed:
+			changed = append(changed, c)
+		case OutputsChanged:
+			outputs = append(outputs, c)
+		case Added:
+			added = append(added, c)
+		case Removed:
+			removed = append(removed, c)
+		}
+	}
+
 	if len(changed) > 0 {
-		fmt.Fprintln(w, "Version changes:")
+		fmt.Fprintf(w, "%s (%s):\n", titles.version, bumpSummary(changed))
 		for i, c := range changed {
-			t.renderChanged(w, i+1, c, numWidth, nameWidth)
+			t.renderChanged(w, offset+i+1, c, numWidth, nameWidth)
 		}
+		offset += len(changed)
+	}
+	if len(outputs) > 0 {
+		fmt.Fprintln(w, titles.outputs+":")
+		for i, c := range outputs {
+			t.renderOutputs(w, offset+i+1, c, numWidth, nameWidth)
+		}
+		offset += len(outputs)
 	}
 	if len(added) > 0 {
-		fmt.Fprintln(w, "Added packages:")
+		fmt.Fprintln(w, titles.added+":")
 		for i, c := range added {
-			t.renderAdded(w, i+1+len(changed), c, numWidth, nameWidth)
+			t.renderAdded(w, offset+i+1, c, numWidth, nameWidth)
 		}
+		offset += len(added)
 	}
 	if len(removed) > 0 {
-		fmt.Fprintln(w, "Removed packages:")
+		fmt.Fprintln(w, titles.removed+":")
 		for i, c := range removed {
-			t.renderRemoved(w, i+1+len(changed)+len(added), c, numWidth, nameWidth)
+			t.renderRemoved(w, offset+i+1, c, numWidth, nameWidth)
 		}
+		offset += len(removed)
 	}
+	return offset
+}
 
-	t.renderStats(w, r)
-	return nil
+// renderRebuilt summarises the packages rebuilt without a version change on
+// a single line, listing the first few by name. The full list is part of the
+// JSON and Markdown output.
+func (t *terminalRenderer) renderRebuilt(w io.Writer, rebuilt []Change) {
+	if len(rebuilt) == 0 {
+		return
+	}
+
+	names := make([]string, 0, topRebuilt)
+	for _, c := range rebuilt[:min(len(rebuilt), topRebuilt)] {
+		names = append(names, lipgloss.NewStyle().Foreground(colorPackage).Render(string(c.Name)))
+	}
+	list := strings.Join(names, ", ")
+	if more := len(rebuilt) - topRebuilt; more > 0 {
+		list += lipgloss.NewStyle().Foreground(colorMuted).Render(fmt.Sprintf(" and %d more", more))
+	}
+
+	fmt.Fprintf(w, "Rebuilt without version change (%d):\n  %s\n", len(rebuilt), list)
+}
+
+// renderInputs lists the pinned inputs that changed, with a link to the
+// commits in between when there is one.
+func (t *terminalRenderer) renderInputs(w io.Writer, inputs []InputChange) {
+	if len(inputs) == 0 {
+		return
+	}
+
+	nameWidth := 0
+	for _, in := range inputs {
+		nameWidth = max(nameWidth, len(in.Name))
+	}
+
+	fmt.Fprintln(w, "Inputs:")
+	for _, in := range inputs {
+		name := lipgloss.NewStyle().Width(nameWidth).Foreground(colorPackage).Render(in.Name)
+		var line string
+		switch in.Type {
+		case Added:
+			line = lipgloss.NewStyle().Foreground(colorAdded).Render(t.inputRef(in.After, in.DateAfter))
+		case Removed:
+			line = lipgloss.NewStyle().Foreground(colorRemoved).Render(t.inputRef(in.Before, in.DateBefore))
+		default:
+			line = lipgloss.NewStyle().Foreground(colorRemoved).Render(t.inputRef(in.Before, in.DateBefore)) +
+				" -> " + lipgloss.NewStyle().Foreground(colorAdded).Render(t.inputRef(in.After, in.DateAfter))
+		}
+		fmt.Fprintf(w, "  %s %s  %s\n", t.fileMarker(in.Type), name, line)
+		if in.CompareURL != "" {
+			fmt.Fprintf(w, "    %s\n", lipgloss.NewStyle().Foreground(colorMuted).Render(in.CompareURL))
+		}
+	}
+}
+
+func (t *terminalRenderer) inputRef(ref, date string) string {
+	return fmt.Sprintf("%s (%s)", shortRef(ref), inputDate(date))
+}
+
+// renderConfig lists the changed units, files, kernel modules and firmware,
+// with the unified diff of a file indented below it when there is one.
+func (t *terminalRenderer) renderConfig(w io.Writer, c *ConfigReport) {
+	if c == nil {
+		return
+	}
+	for _, sec := range configSections(c) {
+		if len(sec.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", sec.title)
+		for _, fc := range sec.changes {
+			fmt.Fprintf(w, "  %s %s\n", t.fileMarker(fc.Type), fc.Path)
+			for _, line := range splitDiffLines(fc.Diff) {
+				fmt.Fprintf(w, "      %s\n", t.diffLine(line))
+			}
+		}
+	}
+}
+
+func (t *terminalRenderer) fileMarker(ct ChangeType) string {
+	switch ct {
+	case Added:
+		return lipgloss.NewStyle().Foreground(colorAdded).Render("+")
+	case Removed:
+		return lipgloss.NewStyle().Foreground(colorRemoved).Render("-")
+	}
+	return lipgloss.NewStyle().Foreground(colorPrefix).Render("~")
+}
+
+func (t *terminalRenderer) diffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+		return lipgloss.NewStyle().Foreground(colorMuted).Render(line)
+	case strings.HasPrefix(line, "+"):
+		return lipgloss.NewStyle().Foreground(colorAdded).Render(line)
+	case strings.HasPrefix(line, "-"):
+		return lipgloss.NewStyle().Foreground(colorRemoved).Render(line)
+	}
+	return line
 }
 
 func (t *terminalRenderer) renderChanged(w io.Writer, num int, c Change, numWidth, nameWidth int) {
@@ -92,31 +244,92 @@ func (t *terminalRenderer) renderChanged(w io.Writer, num int, c Change, numWidt
 	beforeStr := t.formatVersions(c.Before, prefixLen, colorRemoved)
 	afterStr := t.formatVersions(c.After, prefixLen, colorAdded)
 
-	fmt.Fprintf(w, "#%s  %s  %s -> %s\n", paddedNum, styledName, beforeStr, afterStr)
+	fmt.Fprintf(w, "#%s  %s  %s -> %s%s%s\n", paddedNum, styledName, beforeStr, afterStr, t.bumpTag(c.Bump),
+		t.sizeNote(c.SizeBefore != 0 || c.SizeAfter != 0, formatSizeDelta(c.SizeBefore, c.SizeAfter)))
+}
+
+// bumpTag flags the risky version changes, downgrades and major bumps.
+func (t *terminalRenderer) bumpTag(b Bump) string {
+	switch b {
+	case BumpDowngrade:
+		return "  " + lipgloss.NewStyle().Foreground(colorRemoved).Bold(true).Render("[downgrade]")
+	case BumpMajor:
+		return "  " + lipgloss.NewStyle().Foreground(colorMajor).Bold(true).Render("[major]")
+	}
+	return ""
+}
+
+// renderOutputs renders a package that gained or lost outputs, e.g.
+// "foo  1.2  +lib -man".
+func (t *terminalRenderer) renderOutputs(w io.Writer, num int, c Change, numWidth, nameWidth int) {
+	paddedNum := fmt.Sprintf("%0*d", numWidth, num)
+	styledName := lipgloss.NewStyle().Width(nameWidth).Foreground(colorPackage).Render(string(c.Name))
+	versions := lipgloss.NewStyle().Foreground(colorPrefix).Render(versionsToString(c.After))
+
+	var parts []string
+	for _, o := range c.OutputsAdded {
+		parts = append(parts, lipgloss.NewStyle().Foreground(colorAdded).Render("+"+o))
+	}
+	for _, o := range c.OutputsRemoved {
+		parts = append(parts, lipgloss.NewStyle().Foreground(colorRemoved).Render("-"+o))
+	}
+	fmt.Fprintf(w, "#%s  %s  %s  %s%s\n", paddedNum, styledName, versions, strings.Join(parts, " "),
+		t.sizeNote(c.SizeBefore != 0 || c.SizeAfter != 0, formatSizeDelta(c.SizeBefore, c.SizeAfter)))
 }
 
 func (t *terminalRenderer) renderAdded(w io.Writer, num int, c Change, numWidth, nameWidth int) {
 	paddedNum := fmt.Sprintf("%0*d", numWidth, num)
 	styledName := lipgloss.NewStyle().Width(nameWidth).Foreground(colorPackage).Render(string(c.Name))
 	versions := lipgloss.NewStyle().Foreground(colorPrefix).Render(versionsToString(c.After))
-	fmt.Fprintf(w, "#%s  %s  %s\n", paddedNum, styledName, versions)
+	fmt.Fprintf(w, "#%s  %s  %s%s\n", paddedNum, styledName, versions, t.sizeNote(c.SizeAfter != 0, formatSize(c.SizeAfter)))
 }
 
 func (t *terminalRenderer) renderRemoved(w io.Writer, num int, c Change, numWidth, nameWidth int) {
 	paddedNum := fmt.Sprintf("%0*d", numWidth, num)
 	styledName := lipgloss.NewStyle().Width(nameWidth).Foreground(colorPackage).Render(string(c.Name))
 	versions := lipgloss.NewStyle().Foreground(colorMuted).Render(versionsToString(c.Before))
-	fmt.Fprintf(w, "#%s  %s  %s\n", paddedNum, styledName, versions)
+	fmt.Fprintf(w, "#%s  %s  %s%s\n", paddedNum, styledName, versions, t.sizeNote(c.SizeBefore != 0, formatSize(c.SizeBefore)))
 }
 
-func (t *terminalRenderer) renderStats(w io.Writer, r Report) {
-	diffVal, negative, unit := util.DiffBytes(r.BytesBefore, r.BytesAfter)
-	prefix := "+"
-	if negative {
-		prefix = "-"
+// sizeNote renders a muted size annotation, or nothing when the size is
+// unknown.
+func (t *terminalRenderer) sizeNote(known bool, size string) string {
+	if !known {
+		return ""
+	}
+	return lipgloss.NewStyle().Foreground(colorMuted).Render(fmt.Sprintf("  (%s)", size))
+}
+
+func (t *terminalRenderer) renderSizeChanges(w io.Writer, r Report) {
+	growers := r.TopGrowers(topSizeChanges)
+	shrinkers := r.TopShrinkers(topSizeChanges)
+	if len(growers) == 0 && len(shrinkers) == 0 {
+		return
+	}
+
+	nameWidth := 0
+	for _, c := range append(growers, shrinkers...) {
+		nameWidth = max(nameWidth, len(c.Name))
+	}
+
+	fmt.Fprintln(w, "Largest size changes:")
+	for _, c := range growers {
+		t.renderSizeChange(w, c, nameWidth, colorRemoved)
+	}
+	for _, c := range shrinkers {
+		t.renderSizeChange(w, c, nameWidth, colorAdded)
 	}
-	fmt.Fprintf(w, "Closure size: %d -> %d (disk usage %s%.2f%s)\n",
-		r.NumBefore, r.NumAfter, prefix, diffVal, unit)
+}
+
+func (t *terminalRenderer) renderSizeChange(w io.Writer, c SizeChange, nameWidth int, clr color.Color) {
+	styledName := lipgloss.NewStyle().Width(nameWidth).Foreground(colorPackage).Render(string(c.Name))
+	delta := lipgloss.NewStyle().Foreground(clr).Render(formatSizeDelta(c.Before, c.After))
+	fmt.Fprintf(w, "  %s  %s\n", styledName, delta)
+}
+
+func (t *terminalRenderer) renderStats(w io.Writer, r Report) {
+	fmt.Fprintf(w, "Closure size: %d -> %d (disk usage %s)\n",
+		r.NumBefore, r.NumAfter, formatSizeDelta(r.BytesBefore, r.BytesAfter))
 }
 
 func (t *terminalRenderer) formatVersions(vers []Version, highlight int, clr color.Color) string {
@@ -188,3 +401,17 @@ func versionsToString(v []Version) string {
 	}
 	return strings.Join(s, ", ")
 }
+
+func formatSize(b int64) string {
+	size, unit := util.ConvertBytes(b)
+	return fmt.Sprintf("%.2f%s", size, unit)
+}
+
+func formatSizeDelta(before, after int64) string {
+	diffVal, negative, unit := util.DiffBytes(before, after)
+	prefix := "+"
+	if negative {
+		prefix = "-"
+	}
+	return fmt.Sprintf("%s%.2f%s", prefix, diffVal, unit)
+}
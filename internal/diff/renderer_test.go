@@ -1,6 +1,10 @@
 package diff
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -128,3 +132,231 @@ func TestVersionsToString(t *testing.T) {
 		})
 	}
 }
+
+func sampleReport() Report {
+	return Report{
+		Changes: []Change{
+			{Name: "bash", Before: []Version{"5.2"}, After: []Version{"5.3"}, Type: Changed, Bump: BumpMinor, SizeBefore: 1024, SizeAfter: 3072},
+			{Name: "zlib", Before: []Version{"1.3"}, After: []Version{"1.2"}, Type: Changed, Bump: BumpDowngrade},
+			{Name: "jq", After: []Version{"1.7"}, Type: Added, SizeAfter: 2048},
+			{Name: "perl|x", Before: []Version{"5.38"}, Type: Removed, SizeBefore: 1024},
+		},
+		SizeChanges: []SizeChange{
+			{Name: "bash", Before: 1024, After: 3072},
+			{Name: "jq", After: 2048},
+			{Name: "perl|x", Before: 1024},
+		},
+		NumBefore:   10,
+		NumAfter:    10,
+		BytesBefore: 1024,
+		BytesAfter:  2048,
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewJSONRenderer().Render(&buf, sampleReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Changes []struct {
+			Name       string   `json:"name"`
+			Type       string   `json:"type"`
+			Before     []string `json:"before"`
+			After      []string `json:"after"`
+			SizeBefore int64    `json:"sizeBefore"`
+			SizeAfter  int64    `json:"sizeAfter"`
+		} `json:"changes"`
+		BytesBefore int64 `json:"bytesBefore"`
+		BytesAfter  int64 `json:"bytesAfter"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, buf.String())
+	}
+	if len(got.Changes) != 4 {
+		t.Fatalf("expected 4 changes, got %d", len(got.Changes))
+	}
+	if c := got.Changes[0]; c.Type != "changed" || c.Before[0] != "5.2" || c.After[0] != "5.3" {
+		t.Errorf("change 0 = %+v", c)
+	}
+	if got.Changes[2].Type != "added" || got.Changes[3].Type != "removed" {
+		t.Errorf("unexpected change types: %+v", got.Changes)
+	}
+	if c := got.Changes[0]; c.SizeBefore != 1024 || c.SizeAfter != 3072 {
+		t.Errorf("change 0 sizes = %d -> %d", c.SizeBefore, c.SizeAfter)
+	}
+	if got.BytesBefore != 1024 || got.BytesAfter != 2048 {
+		t.Errorf("bytes = %d -> %d", got.BytesBefore, got.BytesAfter)
+	}
+}
+
+func TestJSONRendererEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewJSONRenderer().Render(&buf, Report{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"changes": []`) {
+		t.Errorf("expected empty changes array, got:\n%s", buf.String())
+	}
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewMarkdownRenderer().Render(&buf, sampleReport()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"### Version changes",
+		"1 downgrade, 1 minor.",
+		"| bash | `5.2` | `5.3` | minor | +2.00KiB |",
+		"| zlib | `1.3` | `1.2` | **downgrade** |  |",
+		"### Added packages",
+		"| jq | `1.7` | 2.00KiB |",
+		"### Removed packages",
+		`| perl\|x | ` + "`5.38` | 1.00KiB |",
+		"### Largest size changes",
+		"| bash | 1.00KiB | 3.00KiB | +2.00KiB |",
+		"**Closure size:** 10 → 10",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("markdown output contains ANSI escapes:\n%s", out)
+	}
+}
+
+func TestTerminalRendererSizes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewTerminalRenderer().Render(&buf, sampleReport()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"Version changes (1 downgrade, 1 minor):",
+		"[downgrade]",
+		"(+2.00KiB)", "(2.00KiB)", "(1.00KiB)",
+		"Largest size changes:",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderRebuilt(t *testing.T) {
+	r := Report{NumBefore: 12, NumAfter: 12}
+	for i := range 12 {
+		name := PackageName(fmt.Sprintf("pkg%02d", i))
+		r.Changes = append(r.Changes, Change{Name: name, Before: []Version{"1.0"}, After: []Version{"1.0"}, Type: Rebuilt})
+	}
+
+	var term bytes.Buffer
+	if err := NewTerminalRenderer().Render(&term, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"No version changes.",
+		"Rebuilt without version change (12):",
+		"pkg09",
+		"and 2 more",
+	} {
+		if !strings.Contains(term.String(), want) {
+			t.Errorf("terminal output missing %q:\n%s", want, term.String())
+		}
+	}
+	if strings.Contains(term.String(), "pkg10") {
+		t.Errorf("terminal output lists more than %d rebuilt packages:\n%s", topRebuilt, term.String())
+	}
+
+	var md bytes.Buffer
+	if err := NewMarkdownRenderer().Render(&md, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<summary>12 packages rebuilt without a version change</summary>",
+		"| pkg11 | `1.0` |  |",
+		"</details>",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown output missing %q:\n%s", want, md.String())
+		}
+	}
+}
+
+func TestRenderOutputs(t *testing.T) {
+	r := Report{NumBefore: 1, NumAfter: 1, Changes: []Change{{
+		Name: "curl", Before: []Version{"8.9.1"}, After: []Version{"8.9.1"}, Type: OutputsChanged,
+		OutputsAdded: []string{"bin"}, OutputsRemoved: []string{"man"},
+	}}}
+
+	var term bytes.Buffer
+	if err := NewTerminalRenderer().Render(&term, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Output changes:", "curl", "+bin", "-man"} {
+		if !strings.Contains(term.String(), want) {
+			t.Errorf("terminal output missing %q:\n%s", want, term.String())
+		}
+	}
+	if strings.Contains(term.String(), "Rebuilt") {
+		t.Errorf("output changes reported as a rebuild:\n%s", term.String())
+	}
+
+	var md bytes.Buffer
+	if err := NewMarkdownRenderer().Render(&md, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := "| curl | `8.9.1` | bin | man |"; !strings.Contains(md.String(), want) {
+		t.Errorf("markdown output missing %q:\n%s", want, md.String())
+	}
+}
+
+func TestRenderDependencies(t *testing.T) {
+	r := Report{
+		Changes: []Change{
+			{Name: "firefox", Before: []Version{"129.0"}, After: []Version{"130.0"}, Type: Changed, Bump: BumpMajor},
+			{Name: "nss", Before: []Version{"3.101"}, After: []Version{"3.103"}, Type: Changed, Bump: BumpMinor, Dependency: true},
+			{Name: "libjxl", After: []Version{"0.10.3"}, Type: Added, Dependency: true},
+		},
+	}
+
+	var term bytes.Buffer
+	if err := NewTerminalRenderer().Render(&term, r); err != nil {
+		t.Fatal(err)
+	}
+	out := term.String()
+	for _, want := range []string{
+		"Version changes (1 major):",
+		"Dependency version changes (1 minor):",
+		"Added dependencies:",
+		"#3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("terminal output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "firefox") > strings.Index(out, "nss") {
+		t.Errorf("user-facing changes should come before dependencies:\n%s", out)
+	}
+
+	var md bytes.Buffer
+	if err := NewMarkdownRenderer().Render(&md, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"### Version changes",
+		"### Dependency version changes",
+		"| nss | `3.101` | `3.103` | minor |  |",
+		"### Added dependencies",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown output missing %q:\n%s", want, md.String())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// outputNames are the derivation outputs recognised at the end of a store path
+// name. The default output "out" has no suffix.
+var outputNames = []string{
+	"bin", "data", "debug", "dev", "devdoc", "dist", "doc", "drivers", "firmware",
+	"include", "info", "lib", "lib32", "locales", "man", "modules", "out",
+	"py", "python", "share", "static", "terminfo",
+}
+
+// storePathName is a store path name split into its package name, version and
+// output.
+type storePathName struct {
+	name    string
+	version string
+	output  string
+}
+
+// parseStorePathName splits the name part of a store path (after the hash)
+// like builtins.parseDrvName: the version starts at the first dash-separated
+// component beginning with a digit. On top of that it
+//   - keeps components like "100dpi" in the name when a version follows,
+//   - starts the version at "unstable" when a date follows it, and
+//   - splits a trailing output name such as "-dev" or "-man" off the version.
+//
+// Names without a version keep their outputs, since "glibc-locales" could just
+// as well be a package name.
+func parseStorePathName(s string) storePathName {
+	s = strings.TrimSuffix(s, ".drv")
+
+	parts := strings.Split(s, "-")
+	start := len(parts)
+	for i := 1; i < len(parts); i++ {
+		if isVersionStart(parts, i) {
+			start = i
+			break
+		}
+	}
+
+	if start == len(parts) {
+		return storePathName{name: s}
+	}
+
+	res := storePathName{
+		name:    strings.Join(parts[:start], "-"),
+		version: strings.Join(parts[start:], "-"),
+	}
+
+	// Split off the output, keeping at least one version component
+	if last := len(parts) - 1; last > start && slices.Contains(outputNames, parts[last]) {
+		res.version = strings.Join(parts[start:last], "-")
+		res.output = parts[last]
+	}
+	return res
+}
+
+// isVersionStart reports whether the version of a name split into parts on
+// dashes starts at parts[i].
+func isVersionStart(parts []string, i int) bool {
+	p := parts[i]
+	if p == "" {
+		return false
+	}
+
+	// "unstable-2024-05-01"
+	if p == "unstable" {
+		return i+1 < len(parts) && startsWithDigit(parts[i+1])
+	}
+
+	if !startsWithDigit(p) {
+		return false
+	}
+
+	// "font-adobe-100dpi-1.0.4", "gst-plugins-3d-1.2": digits followed only
+	// by letters are part of the name when a version still follows.
+	if isDigitsThenLetters(p) {
+		for _, q := range parts[i+1:] {
+			if startsWithDigit(q) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// isDigitsThenLetters matches components like "100dpi" and "3d", but not
+// versions with a dot or a trailing number like "2.0", "9.8p1" or "2024a1".
+func isDigitsThenLetters(s string) bool {
+	i := 0
+	for i < len(s) && unicode.IsDigit(rune(s[i])) {
+		i++
+	}
+	if i == 0 || i == len(s) {
+		return false
+	}
+	for _, r := range s[i:] {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePackageFromPath(path string) *Package {
+	rest, ok := strings.CutPrefix(path, "/nix/store/")
+	if !ok {
+		return nil
+	}
+	hash, name, ok := strings.Cut(rest, "-")
+	if !ok || hash == "" || name == "" || strings.Contains(rest, "/") {
+		return nil
+	}
+
+	parsed := parseStorePathName(name)
+	return &Package{
+		Name:    PackageName(parsed.name),
+		Version: Version(parsed.version),
+		Output:  parsed.output,
+		Path:    path,
+	}
+}
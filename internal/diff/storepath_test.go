@@ -0,0 +1,202 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseStorePathName(t *testing.T) {
+	tests := []struct {
+		in      string
+		name    string
+		version string
+		output  string
+	}{
+		// Plain name and version
+		{"gzip-1.13", "gzip", "1.13", ""},
+		{"bash-5.2p32", "bash", "5.2p32", ""},
+		{"openssh-9.8p1", "openssh", "9.8p1", ""},
+		{"coreutils-9.5", "coreutils", "9.5", ""},
+		{"tzdata-2024a", "tzdata", "2024a", ""},
+		{"vim-9.1.0707", "vim", "9.1.0707", ""},
+		{"git-2.46.0", "git", "2.46.0", ""},
+		{"w3m-0.5.3+git20230121", "w3m", "0.5.3+git20230121", ""},
+		{"nss-cacert-3.101.1", "nss-cacert", "3.101.1", ""},
+		{"util-linux-minimal-2.39.4", "util-linux-minimal", "2.39.4", ""},
+		{"xorg-server-21.1.13", "xorg-server", "21.1.13", ""},
+		{"systemd-256.4", "systemd", "256.4", ""},
+		{"linux-6.6.47", "linux", "6.6.47", ""},
+		{"nixos-system-laptop-24.11.20240901.6e99f2a", "nixos-system-laptop", "24.11.20240901.6e99f2a", ""},
+
+		// Outputs
+		{"gnutar-1.35-info", "gnutar", "1.35", "info"},
+		{"gzip-1.13-man", "gzip", "1.13", "man"},
+		{"openssl-3.0.14-bin", "openssl", "3.0.14", "bin"},
+		{"openssl-3.0.14-dev", "openssl", "3.0.14", "dev"},
+		{"ncurses-6.4-dev", "ncurses", "6.4", "dev"},
+		{"glibc-2.39-52-bin", "glibc", "2.39-52", "bin"},
+		{"glibc-2.39-52", "glibc", "2.39-52", ""},
+		{"util-linux-2.39.4-lib", "util-linux", "2.39.4", "lib"},
+		{"systemd-minimal-libs-256.4", "systemd-minimal-libs", "256.4", ""},
+		{"mesa-24.1.7-drivers", "mesa", "24.1.7", "drivers"},
+		{"python3-3.12.5-debug", "python3", "3.12.5", "debug"},
+		{"ghc-9.6.6-doc", "ghc", "9.6.6", "doc"},
+		{"linux-6.6.47-modules", "linux", "6.6.47", "modules"},
+		{"libxcrypt-4.4.36-man", "libxcrypt", "4.4.36", "man"},
+		{"gcc-13.3.0-lib", "gcc", "13.3.0", "lib"},
+
+		// Names containing digits
+		{"python3.12-requests-2.32.3", "python3.12-requests", "2.32.3", ""},
+		{"python3.12-requests-2.32.3-dist", "python3.12-requests", "2.32.3", "dist"},
+		{"perl5.38.2-JSON-4.10", "perl5.38.2-JSON", "4.10", ""},
+		{"gtk+3-3.24.43", "gtk+3", "3.24.43", ""},
+		{"gtk4-4.14.5", "gtk4", "4.14.5", ""},
+		{"libx11-1.8.9", "libx11", "1.8.9", ""},
+		{"font-adobe-100dpi-1.0.4", "font-adobe-100dpi", "1.0.4", ""},
+		{"font-bh-lucidatypewriter-75dpi-1.0.4", "font-bh-lucidatypewriter-75dpi", "1.0.4", ""},
+		{"i3-4.23", "i3", "4.23", ""},
+		{"7zz-24.08", "7zz", "24.08", ""},
+		{"x264-0-unstable-2024-01-13", "x264", "0-unstable-2024-01-13", ""},
+		{"lib32-glibc-2.39-52", "lib32-glibc", "2.39-52", ""},
+		{"qt6-base-6.7.2", "qt6-base", "6.7.2", ""},
+		{"sqlite-3.46.0-bin", "sqlite", "3.46.0", "bin"},
+
+		// Wrappers and unwrapped variants keep their suffix in the name
+		{"firefox-unwrapped-130.0", "firefox-unwrapped", "130.0", ""},
+		{"firefox-130.0", "firefox", "130.0", ""},
+		{"neovim-unwrapped-0.10.1", "neovim-unwrapped", "0.10.1", ""},
+		{"gcc-wrapper-13.3.0", "gcc-wrapper", "13.3.0", ""},
+		{"clang-wrapper-18.1.8", "clang-wrapper", "18.1.8", ""},
+		{"binutils-wrapper-2.42", "binutils-wrapper", "2.42", ""},
+
+		// Unstable snapshots
+		{"nix-index-unstable-2024-04-11", "nix-index", "unstable-2024-04-11", ""},
+		{"neofetch-unstable-2021-12-10", "neofetch", "unstable-2021-12-10", ""},
+		{"unstable-thing", "unstable-thing", "", ""},
+		{"foo-unstable", "foo-unstable", "", ""},
+
+		// No version
+		{"nixos-rebuild", "nixos-rebuild", "", ""},
+		{"system-path", "system-path", "", ""},
+		{"etc", "etc", "", ""},
+		{"glibc-locales", "glibc-locales", "", ""},
+		{"hm_fontconfigconf.d10hmfonts.conf", "hm_fontconfigconf.d10hmfonts.conf", "", ""},
+		{"home-manager-files", "home-manager-files", "", ""},
+		{"unit-sshd.service", "unit-sshd.service", "", ""},
+
+		// Derivations
+		{"gzip-1.13.drv", "gzip", "1.13", ""},
+		{"hello-2.12.1.drv", "hello", "2.12.1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := parseStorePathName(tt.in)
+			want := storePathName{name: tt.name, version: tt.version, output: tt.output}
+			if got != want {
+				t.Errorf("parseStorePathName(%q) = %+v, want %+v", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestParsePackageFromPath(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *Package
+	}{
+		{
+			name: "package with simple version",
+			in:   "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13",
+			want: &Package{
+				Name:    "gzip",
+				Version: "1.13",
+				Path:    "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13",
+			},
+		},
+		{
+			name: "package with output suffix",
+			in:   "/nix/store/3bl0g75vyjgg8gnggwiavbwdxyg6gv20-gnutar-1.35-info",
+			want: &Package{
+				Name:    "gnutar",
+				Version: "1.35",
+				Output:  "info",
+				Path:    "/nix/store/3bl0g75vyjgg8gnggwiavbwdxyg6gv20-gnutar-1.35-info",
+			},
+		},
+		{
+			name: "package without version",
+			in:   "/nix/store/i6fl7i35dacvxqpzya6h78nacciwryfh-nixos-rebuild",
+			want: &Package{
+				Name:    "nixos-rebuild",
+				Version: "",
+				Path:    "/nix/store/i6fl7i35dacvxqpzya6h78nacciwryfh-nixos-rebuild",
+			},
+		},
+		{
+			name: "package with .drv suffix",
+			in:   "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13.drv",
+			want: &Package{
+				Name:    "gzip",
+				Version: "1.13",
+				Path:    "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13.drv",
+			},
+		},
+		{
+			name: "path inside a store path",
+			in:   "/nix/store/nc394xps4al1r99ziabqvajbkrhxr5b7-gzip-1.13/bin/gzip",
+			want: nil,
+		},
+		{
+			name: "invalid path",
+			in:   "/not/a/nix/store/path",
+			want: nil,
+		},
+		{
+			name: "empty string",
+			in:   "",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parsePackageFromPath(tt.in)
+
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCalculatePackageDiffGroupsOutputs(t *testing.T) {
+	parse := func(paths ...string) []Package {
+		var pkgs []Package
+		for _, p := range paths {
+			pkgs = append(pkgs, *parsePackageFromPath(p))
+		}
+		return pkgs
+	}
+
+	before := parse(
+		"/nix/store/aaaa-openssl-3.0.13",
+		"/nix/store/aaaa-openssl-3.0.13-bin",
+		"/nix/store/aaaa-openssl-3.0.13-dev",
+	)
+	after := parse(
+		"/nix/store/bbbb-openssl-3.0.14",
+		"/nix/store/bbbb-openssl-3.0.14-bin",
+		"/nix/store/bbbb-openssl-3.0.14-dev",
+	)
+
+	got := calculatePackageDiff(before, after).Changes
+	want := []Change{
+		{Name: "openssl", Before: []Version{"3.0.13"}, After: []Version{"3.0.14"}, Type: Changed, Bump: BumpPatch},
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,235 @@
+package diff
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Bump classifies a version change.
+type Bump int
+
+const (
+	// BumpNone is used for added and removed packages, and for changes
+	// between equivalent versions such as "1.2" and "1.2.0".
+	BumpNone Bump = iota
+	BumpMajor
+	BumpMinor
+	BumpPatch
+	BumpDowngrade
+	BumpUnparseable
+	// BumpSnapshot is a move to a newer dated snapshot, such as
+	// "unstable-2023-12-30" to "unstable-2024-01-02". The date components
+	// say nothing about the size of the change.
+	BumpSnapshot
+)
+
+func (b Bump) String() string {
+	switch b {
+	case BumpMajor:
+		return "major"
+	case BumpMinor:
+		return "minor"
+	case BumpPatch:
+		return "patch"
+	case BumpDowngrade:
+		return "downgrade"
+	case BumpUnparseable:
+		return "unparseable"
+	case BumpSnapshot:
+		return "snapshot"
+	default:
+		return "none"
+	}
+}
+
+func (b Bump) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+var (
+	// Output names at the end of versions that were not parsed from a store
+	// path.
+	outputSuffixRe = regexp.MustCompile(`-(` + strings.Join(outputNames, "|") + `)$`)
+	// Dated snapshots: "unstable-2024-05-01", "0-unstable-2024-05-01" and
+	// "2024-05-01".
+	dateVersionRe = regexp.MustCompile(`^(?:[0-9.]+-)?(?:unstable-)?(\d{4})-(\d{2})-(\d{2})$`)
+	releaseRe     = regexp.MustCompile(`^v?(\d+(?:\.\d+)*)(.*)$`)
+	// Pre-releases: "-rc1", "beta.2", "rc" and "a1". A bare "a" or "b" is a
+	// post-release letter ("1.1.1a"), so those need a number.
+	preReleaseRe = regexp.MustCompile(`^[-.]?(?:(alpha|beta|pre|rc)\.?(\d*)|(a|b)(\d+))$`)
+)
+
+// preRanks orders pre-release tags, all of which sort before the release.
+var preRanks = map[string]int{"a": 1, "alpha": 1, "b": 2, "beta": 2, "pre": 3, "rc": 4}
+
+// parsedVersion is a Nix version string split into its numeric release,
+// optional pre-release and any remaining suffix (e.g. "p1" in "9.8p1").
+// Dated snapshots have the date as their release.
+type parsedVersion struct {
+	nums     []int
+	preRank  int // 0 for releases
+	preNum   int
+	rest     string
+	snapshot bool
+}
+
+func parseVersion(v Version) (parsedVersion, bool) {
+	s := outputSuffixRe.ReplaceAllString(string(v), "")
+
+	if m := dateVersionRe.FindStringSubmatch(s); m != nil {
+		return parsedVersion{nums: atois(m[1:]), snapshot: true}, true
+	}
+
+	m := releaseRe.FindStringSubmatch(s)
+	if m == nil {
+		return parsedVersion{}, false
+	}
+	pv := parsedVersion{nums: atois(strings.Split(m[1], "."))}
+
+	if pm := preReleaseRe.FindStringSubmatch(m[2]); pm != nil {
+		tag, num := pm[1], pm[2]
+		if tag == "" {
+			tag, num = pm[3], pm[4]
+		}
+		pv.preRank = preRanks[tag]
+		pv.preNum, _ = strconv.Atoi(num)
+		return pv, true
+	}
+	pv.rest = m[2]
+	return pv, true
+}
+
+func atois(parts []string) []int {
+	out := make([]int, len(parts))
+	for i, p := range parts {
+		out[i], _ = strconv.Atoi(p)
+	}
+	return out
+}
+
+// compareVersions compares a and b, returning the ordering and the index of
+// the first differing release component (-1 when the releases are equal).
+func compareVersions(a, b parsedVersion) (int, int) {
+	for i := range max(len(a.nums), len(b.nums)) {
+		var x, y int
+		if i < len(a.nums) {
+			x = a.nums[i]
+		}
+		if i < len(b.nums) {
+			y = b.nums[i]
+		}
+		if c := cmp.Compare(x, y); c != 0 {
+			return c, i
+		}
+	}
+
+	// A release sorts after all of its pre-releases.
+	rank := func(p parsedVersion) int {
+		if p.preRank == 0 {
+			return len(preRanks) + 1
+		}
+		return p.preRank
+	}
+	if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+		return c, -1
+	}
+	if c := cmp.Compare(a.preNum, b.preNum); c != 0 {
+		return c, -1
+	}
+	return cmp.Compare(a.rest, b.rest), -1
+}
+
+// CompareVersions orders two versions the way version changes are classified,
+// ignoring output suffixes. ok is false when either cannot be parsed.
+func CompareVersions(a, b Version) (c int, ok bool) {
+	pa, ok := parseVersion(a)
+	if !ok {
+		return 0, false
+	}
+	pb, ok := parseVersion(b)
+	if !ok {
+		return 0, false
+	}
+	c, _ = compareVersions(pa, pb)
+	return c, true
+}
+
+// classifyChange classifies the change from the newest version in before to
+// the newest version in after, ignoring output suffixes.
+func classifyChange(before, after []Version) Bump {
+	from, ok := newestVersion(before)
+	if !ok {
+		return BumpUnparseable
+	}
+	to, ok := newestVersion(after)
+	if !ok {
+		return BumpUnparseable
+	}
+
+	c, idx := compareVersions(from, to)
+	switch {
+	case c == 0:
+		return BumpNone
+	case c > 0:
+		return BumpDowngrade
+	case from.snapshot && to.snapshot:
+		return BumpSnapshot
+	case idx == 0:
+		return BumpMajor
+	case idx == 1:
+		return BumpMinor
+	}
+	return BumpPatch
+}
+
+// newestVersion returns the highest parseable version of vers. Empty
+// versions are skipped; any other unparseable one makes the set unparseable.
+func newestVersion(vers []Version) (parsedVersion, bool) {
+	var parsed []parsedVersion
+	for _, v := range vers {
+		if v == "" {
+			continue
+		}
+		pv, ok := parseVersion(v)
+		if !ok {
+			return parsedVersion{}, false
+		}
+		parsed = append(parsed, pv)
+	}
+	if len(parsed) == 0 {
+		return parsedVersion{}, false
+	}
+	return slices.MaxFunc(parsed, func(a, b parsedVersion) int {
+		c, _ := compareVersions(a, b)
+		return c
+	}), true
+}
+
+// bumpOrder is the order classes are summarised in, riskiest first.
+var bumpOrder = []Bump{BumpDowngrade, BumpMajor, BumpMinor, BumpPatch, BumpSnapshot, BumpUnparseable, BumpNone}
+
+// bumpSummary counts the changed packages per class, e.g. "1 major, 3 patch".
+func bumpSummary(changes []Change) string {
+	counts := map[Bump]int{}
+	for _, c := range changes {
+		if c.Type == Changed {
+			counts[c.Bump]++
+		}
+	}
+
+	var parts []string
+	for _, b := range bumpOrder {
+		if n := counts[b]; n > 0 {
+			label := b.String()
+			if b == BumpNone {
+				label = "equivalent"
+			}
+			parts = append(parts, fmt.Sprintf("%d %s", n, label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,57 @@
+package diff
+
+import "testing"
+
+func TestClassifyChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []Version
+		after  []Version
+		want   Bump
+	}{
+		{"patch", []Version{"1.2.3"}, []Version{"1.2.4"}, BumpPatch},
+		{"minor", []Version{"1.2.3"}, []Version{"1.3.0"}, BumpMinor},
+		{"major", []Version{"1.2.3"}, []Version{"2.0"}, BumpMajor},
+		{"downgrade", []Version{"1.3"}, []Version{"1.2.9"}, BumpDowngrade},
+		{"numeric not lexical", []Version{"1.9"}, []Version{"1.10"}, BumpMinor},
+		{"trailing zero is equal", []Version{"1.2"}, []Version{"1.2.0", "1.2.0-man"}, BumpNone},
+		{"outputs ignored", []Version{"1.13", "1.13-lib"}, []Version{"1.14", "1.14-lib", "1.14-man"}, BumpMinor},
+		{"release after rc", []Version{"2.0-rc1"}, []Version{"2.0"}, BumpPatch},
+		{"rc after release is a downgrade", []Version{"2.0"}, []Version{"2.0rc2"}, BumpDowngrade},
+		{"rc ordering", []Version{"2.0-beta3"}, []Version{"2.0-rc1"}, BumpPatch},
+		{"letter suffix", []Version{"9.7p1"}, []Version{"9.8p1"}, BumpMinor},
+		{"post release suffix", []Version{"1.1.1v"}, []Version{"1.1.1w"}, BumpPatch},
+		{"post release letter", []Version{"1.1.1"}, []Version{"1.1.1a"}, BumpPatch},
+		{"alpha with number", []Version{"2.0a1"}, []Version{"2.0"}, BumpPatch},
+		{"beta after release is a downgrade", []Version{"2.0"}, []Version{"2.0b2"}, BumpDowngrade},
+		{"unstable dates", []Version{"unstable-2024-05-01"}, []Version{"unstable-2024-06-11"}, BumpSnapshot},
+		{"date rollover", []Version{"unstable-2023-12-30"}, []Version{"unstable-2024-01-02"}, BumpSnapshot},
+		{"0-unstable dates", []Version{"0-unstable-2024-05-01"}, []Version{"0-unstable-2023-12-30"}, BumpDowngrade},
+		{"plain dates", []Version{"2023-12-30"}, []Version{"2024-01-02"}, BumpSnapshot},
+		{"empty versions skipped", []Version{"", "257.7"}, []Version{"", "257.8"}, BumpMinor},
+		{"only empty", []Version{""}, []Version{"1.0"}, BumpUnparseable},
+		{"not a version", []Version{"git"}, []Version{"1.0"}, BumpUnparseable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyChange(tt.before, tt.after); got != tt.want {
+				t.Errorf("classifyChange(%v, %v) = %s, want %s", tt.before, tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBumpSummary(t *testing.T) {
+	changes := []Change{
+		{Name: "a", Type: Changed, Bump: BumpPatch},
+		{Name: "b", Type: Changed, Bump: BumpPatch},
+		{Name: "c", Type: Changed, Bump: BumpMajor},
+		{Name: "d", Type: Changed, Bump: BumpDowngrade},
+		{Name: "e", Type: Added},
+	}
+	want := "1 downgrade, 1 major, 2 patch"
+	if got := bumpSummary(changes); got != want {
+		t.Errorf("bumpSummary() = %q, want %q", got, want)
+	}
+}
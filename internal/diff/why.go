@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/nix"
+)
+
+// WhyDepends returns the shortest chain of store paths through which the
+// closure of path references a store path of pkg, starting with the store
+// path of path itself and ending with the package.
+func (q *executorQuerier) WhyDepends(ctx context.Context, path string, pkg PackageName) ([]string, error) {
+	out, err := q.runPathInfo(ctx, "--recursive", path)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := decodeReferences(out, q.pathInfoLayout(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	root := closureRoot(refs)
+	if root == "" {
+		return nil, fmt.Errorf("could not find the root of the closure of %s", path)
+	}
+
+	chain := shortestChain(refs, root, func(p string) bool {
+		parsed := parsePackageFromPath(p)
+		return parsed != nil && parsed.Name == pkg
+	})
+	if chain == nil {
+		return nil, fmt.Errorf("%s is not in the closure of %s", pkg, path)
+	}
+	return chain, nil
+}
+
+// decodeReferences decodes the references of every path in nix path-info
+// --json output.
+func decodeReferences(buf []byte, layout nix.PathInfoLayout) (map[string][]string, error) {
+	infos, err := parsePathInfo(buf, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[string][]string{}
+	for _, i := range infos {
+		if i.path == "" {
+			continue
+		}
+		var out []string
+		for _, r := range i.info.GetArray("references") {
+			ref := string(r.GetStringBytes())
+			if !strings.HasPrefix(ref, "/") {
+				ref = "/nix/store/" + ref
+			}
+			if ref != i.path {
+				out = append(out, ref)
+			}
+		}
+		slices.Sort(out)
+		refs[i.path] = out
+	}
+	return refs, nil
+}
+
+// closureRoot returns the path of a closure that no other path references.
+// Everything else in a closure is reachable from its root, so there is
+// exactly one.
+func closureRoot(refs map[string][]string) string {
+	referenced := map[string]bool{}
+	for _, rs := range refs {
+		for _, r := range rs {
+			referenced[r] = true
+		}
+	}
+	for p := range refs {
+		if !referenced[p] {
+			return p
+		}
+	}
+	return ""
+}
+
+// shortestChain does a breadth-first search from root and returns the first
+// chain that reaches a path matching target, or nil when none does.
+func shortestChain(refs map[string][]string, root string, target func(string) bool) []string {
+	parent := map[string]string{root: ""}
+	queue := []string{root}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		if target(p) {
+			var chain []string
+			for ; p != ""; p = parent[p] {
+				chain = append(chain, p)
+			}
+			slices.Reverse(chain)
+			return chain
+		}
+
+		for _, r := range refs[p] {
+			if _, seen := parent[r]; !seen {
+				parent[r] = p
+				queue = append(queue, r)
+			}
+		}
+	}
+	return nil
+}
+
+// FormatWhy renders a reference chain returned by WhyDepends as a tree.
+func FormatWhy(chain []string) string {
+	var b strings.Builder
+	for i, p := range chain {
+		if i == 0 {
+			fmt.Fprintln(&b, p)
+			continue
+		}
+		fmt.Fprintf(&b, "%s└─ %s\n", strings.Repeat("   ", i-1), p)
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/nix"
+	"github.com/go-test/deep"
+)
+
+func TestDecodeReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want map[string][]string
+	}{
+		{
+			name: "array format",
+			in: []byte(`[
+				{"path": "/nix/store/a-root", "references": ["/nix/store/b-lib", "/nix/store/a-root"]},
+				{"path": "/nix/store/b-lib", "references": []}
+			]`),
+			want: map[string][]string{
+				"/nix/store/a-root": {"/nix/store/b-lib"},
+				"/nix/store/b-lib":  nil,
+			},
+		},
+		{
+			name: "object format with base names",
+			in: []byte(`{
+				"/nix/store/a-root": {"references": ["c-lib", "b-lib"]},
+				"/nix/store/b-lib": {"references": []},
+				"/nix/store/c-lib": null
+			}`),
+			want: map[string][]string{
+				"/nix/store/a-root": {"/nix/store/b-lib", "/nix/store/c-lib"},
+				"/nix/store/b-lib":  nil,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeReferences(tt.in, nix.PathInfoUnknown)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestShortestChain(t *testing.T) {
+	refs := map[string][]string{
+		"/nix/store/a-nixos-system":     {"/nix/store/b-etc", "/nix/store/c-system-path"},
+		"/nix/store/b-etc":              {"/nix/store/d-unit-script"},
+		"/nix/store/c-system-path":      {"/nix/store/e-openssl-3.0.14"},
+		"/nix/store/d-unit-script":      {"/nix/store/f-curl-8.9.0"},
+		"/nix/store/f-curl-8.9.0":       {"/nix/store/e-openssl-3.0.14"},
+		"/nix/store/e-openssl-3.0.14":   nil,
+		"/nix/store/g-unreachable-1.0":  nil,
+		"/nix/store/h-also-unreachable": {"/nix/store/g-unreachable-1.0"},
+	}
+	byName := func(name PackageName) func(string) bool {
+		return func(p string) bool {
+			parsed := parsePackageFromPath(p)
+			return parsed != nil && parsed.Name == name
+		}
+	}
+
+	got := shortestChain(refs, "/nix/store/a-nixos-system", byName("openssl"))
+	want := []string{"/nix/store/a-nixos-system", "/nix/store/c-system-path", "/nix/store/e-openssl-3.0.14"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+
+	got = shortestChain(refs, "/nix/store/a-nixos-system", byName("curl"))
+	want = []string{"/nix/store/a-nixos-system", "/nix/store/b-etc", "/nix/store/d-unit-script", "/nix/store/f-curl-8.9.0"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+
+	if got := shortestChain(refs, "/nix/store/a-nixos-system", byName("unreachable")); got != nil {
+		t.Errorf("expected no chain, got %v", got)
+	}
+}
+
+func TestClosureRoot(t *testing.T) {
+	refs := map[string][]string{
+		"/nix/store/a-root": {"/nix/store/b-lib", "/nix/store/c-bin"},
+		"/nix/store/b-lib":  nil,
+		"/nix/store/c-bin":  {"/nix/store/b-lib"},
+	}
+	if got := closureRoot(refs); got != "/nix/store/a-root" {
+		t.Errorf("closureRoot() = %q", got)
+	}
+}
+
+func TestFormatWhy(t *testing.T) {
+	got := FormatWhy([]string{"/nix/store/a", "/nix/store/b", "/nix/store/c"})
+	want := "/nix/store/a\n└─ /nix/store/b\n   └─ /nix/store/c\n"
+	if got != want {
+		t.Errorf("FormatWhy() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/arnarg/nilla-utils/internal/askpass"
+	"golang.org/x/term"
+)
+
+// sudoAttempts is how many times a sudo password is asked for before giving
+// up on a host.
+const sudoAttempts = 3
+
+// promptMu serializes the password prompts of all captured hosts, which run
+// concurrently but share the terminal.
+var promptMu sync.Mutex
+
+// capturedHost is a Host whose commands never use the terminal, so that it
+// can run alongside other hosts.
+type capturedHost struct {
+	Host
+	key   string
+	cache *askpass.PasswordCache
+	out   *lockedWriter
+
+	mu       sync.Mutex
+	checked  bool
+	needed   bool
+	password string
+}
+
+// NewCapturedHost wraps h so that commands run alongside other hosts do not
+// fight over the terminal. Output commands would write to the terminal goes
+// to out instead, and they never read from it. sudo runs without a pty: the
+// password of key is taken from cache, and asked for under a lock shared by
+// all captured hosts, once sudo turns out to need one.
+func NewCapturedHost(h Host, key string, cache *askpass.PasswordCache, out io.Writer) Host {
+	return &capturedHost{Host: h, key: key, cache: cache, out: &lockedWriter{w: out}}
+}
+
+// Terminal returns where output of commands run on e that is meant for the
+// user goes: the writer of a captured host, or os.Stderr.
+func Terminal(e Executor) io.Writer {
+	if h, ok := e.(*capturedHost); ok {
+		return h.out
+	}
+	return os.Stderr
+}
+
+func (h *capturedHost) Command(name string, args ...string) (Command, error) {
+	return h.CommandContext(context.Background(), name, args...)
+}
+
+func (h *capturedHost) CommandContext(ctx context.Context, name string, args ...string) (Command, error) {
+	var stdin io.Reader
+	if name == "sudo" {
+		password, needed, err := h.sudoPassword(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if needed {
+			args = append([]string{"-S", "--prompt="}, args...)
+			stdin = strings.NewReader(password + "\n")
+		} else {
+			args = append([]string{"-n"}, args...)
+		}
+	}
+
+	c, err := h.Host.CommandContext(ctx, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	if stdin != nil {
+		c.SetStdin(stdin)
+	}
+	return &capturedCommand{Command: c, out: h.out}, nil
+}
+
+// sudoPassword finds out whether sudo needs a password on the host and, if
+// so, returns one sudo accepted.
+func (h *capturedHost) sudoPassword(ctx context.Context) (string, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.checked {
+		return h.password, h.needed, nil
+	}
+
+	if _, err := h.run(ctx, nil, "sudo", "-n", "true"); err == nil {
+		h.checked = true
+		return "", false, nil
+	}
+
+	var lastErr error
+	for range sudoAttempts {
+		password, err := h.askPassword()
+		if err != nil {
+			return "", false, err
+		}
+		msg, err := h.run(ctx, strings.NewReader(password+"\n"), "sudo", "-S", "--prompt=", "-v")
+		if err == nil {
+			h.checked, h.needed, h.password = true, true, password
+			return password, true, nil
+		}
+		lastErr = fmt.Errorf("sudo: %w: %s", err, strings.TrimSpace(msg))
+		h.cache.Delete(h.key)
+	}
+	return "", false, lastErr
+}
+
+// askPassword returns the cached password of the host, prompting for it on
+// the terminal when there is none.
+func (h *capturedHost) askPassword() (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	if password, ok := h.cache.Get(h.key); ok {
+		return password, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "[sudo] password for %s: ", h.key)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read sudo password: %w", err)
+	}
+	h.cache.Set(h.key, string(password))
+	return string(password), nil
+}
+
+// run runs a command on the wrapped host, returning what it wrote to stderr.
+func (h *capturedHost) run(ctx context.Context, stdin io.Reader, name string, args ...string) (string, error) {
+	c, err := h.Host.CommandContext(ctx, name, args...)
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	if stdin != nil {
+		c.SetStdin(stdin)
+	}
+	c.SetStderr(&stderr)
+	err = c.Run()
+	return stderr.String(), err
+}
+
+// capturedCommand redirects the terminal streams given to a command of a
+// captured host.
+type capturedCommand struct {
+	Command
+	out io.Writer
+}
+
+func (c *capturedCommand) SetStdin(r io.Reader) {
+	if r != os.Stdin {
+		c.Command.SetStdin(r)
+	}
+}
+
+func (c *capturedCommand) SetStdout(w io.Writer) {
+	c.Command.SetStdout(c.redirect(w))
+}
+
+func (c *capturedCommand) SetStderr(w io.Writer) {
+	c.Command.SetStderr(c.redirect(w))
+}
+
+func (c *capturedCommand) redirect(w io.Writer) io.Writer {
+	if w == os.Stdout || w == os.Stderr {
+		return c.out
+	}
+	return w
+}
+
+// lockedWriter serializes writes, as SSH sessions copy stdout and stderr
+// from separate goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
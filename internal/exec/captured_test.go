@@ -0,0 +1,127 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/askpass"
+)
+
+// sudoHost answers sudo like a host where it needs a password, and records
+// every command run.
+type sudoHost struct {
+	Host
+	password string
+	ran      []string
+}
+
+func (h *sudoHost) CommandContext(_ context.Context, name string, args ...string) (Command, error) {
+	return &sudoCommand{host: h, line: strings.Join(append([]string{name}, args...), " ")}, nil
+}
+
+type sudoCommand struct {
+	host   *sudoHost
+	line   string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (c *sudoCommand) Run() error {
+	var in string
+	if c.stdin != nil {
+		b, _ := io.ReadAll(c.stdin)
+		in = string(b)
+	}
+	c.host.ran = append(c.host.ran, c.line)
+
+	switch {
+	case c.line == "sudo -n true":
+		return errors.New("a password is required")
+	case strings.HasPrefix(c.line, "sudo -S") && in != c.host.password+"\n":
+		if c.stderr != nil {
+			io.WriteString(c.stderr, "Sorry, try again.\n")
+		}
+		return errors.New("incorrect password")
+	}
+	if c.stdout != nil {
+		io.WriteString(c.stdout, c.line+"\n")
+	}
+	return nil
+}
+
+func (c *sudoCommand) Start() error          { return c.Run() }
+func (c *sudoCommand) Wait() error           { return nil }
+func (c *sudoCommand) SetStdin(r io.Reader)  { c.stdin = r }
+func (c *sudoCommand) SetStdout(w io.Writer) { c.stdout = w }
+func (c *sudoCommand) SetStderr(w io.Writer) { c.stderr = w }
+func (c *sudoCommand) StdinPipe() (io.WriteCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *sudoCommand) StdoutPipe() (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *sudoCommand) StderrPipe() (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestCapturedHost(t *testing.T) {
+	inner := &sudoHost{password: "hunter2"}
+	cache := askpass.NewPasswordCache()
+	cache.Set("admin@web", "hunter2")
+
+	var out bytes.Buffer
+	h := NewCapturedHost(inner, "admin@web", cache, &out)
+
+	for _, args := range [][]string{{"rm", "/nix/var/nix/profiles/system-1-link"}, {"nix", "store", "gc"}} {
+		c, err := h.CommandContext(context.Background(), "sudo", args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetStdin(os.Stdin)
+		c.SetStdout(os.Stdout)
+		if err := c.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"sudo -n true",
+		"sudo -S --prompt= -v",
+		"sudo -S --prompt= rm /nix/var/nix/profiles/system-1-link",
+		"sudo -S --prompt= nix store gc",
+	}
+	if !slices.Equal(inner.ran, want) {
+		t.Errorf("ran %q, want %q", inner.ran, want)
+	}
+	if want := "sudo -S --prompt= rm /nix/var/nix/profiles/system-1-link\nsudo -S --prompt= nix store gc\n"; out.String() != want {
+		t.Errorf("captured output = %q, want %q", out.String(), want)
+	}
+	if Terminal(h) == io.Writer(os.Stderr) || Terminal(inner) != io.Writer(os.Stderr) {
+		t.Error("expected only the captured host to have its own terminal writer")
+	}
+}
+
+func TestCapturedHostWrongPassword(t *testing.T) {
+	inner := &sudoHost{password: "hunter2"}
+	cache := askpass.NewPasswordCache()
+	cache.Set("admin@web", "wrong")
+
+	// With stdin not a terminal, the prompt after the rejected cached
+	// password fails instead of blocking.
+	h := NewCapturedHost(inner, "admin@web", cache, io.Discard)
+	if _, err := h.CommandContext(context.Background(), "sudo", "true"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, ok := cache.Get("admin@web"); ok {
+		t.Error("expected the rejected password to be dropped from the cache")
+	}
+}
@@ -0,0 +1,127 @@
+package gencmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/diff"
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+// Column is an opt-in column of generation metadata that is not part of the
+// System's default table.
+type Column string
+
+const (
+	ColumnRevision        Column = "revision"
+	ColumnLabel           Column = "label"
+	ColumnNixpkgs         Column = "nixpkgs"
+	ColumnSize            Column = "size"
+	ColumnSpecialisations Column = "specialisations"
+)
+
+var allColumns = []Column{
+	ColumnRevision,
+	ColumnLabel,
+	ColumnNixpkgs,
+	ColumnSize,
+	ColumnSpecialisations,
+}
+
+// ParseColumns validates --columns values, preserving order and dropping
+// duplicates.
+func ParseColumns(names []string) ([]Column, error) {
+	var cols []Column
+	for _, n := range names {
+		c := Column(strings.TrimSpace(n))
+		if c == "" {
+			continue
+		}
+		if !slices.Contains(allColumns, c) {
+			return nil, fmt.Errorf("unknown column %q (expected one of revision, label, nixpkgs, size, specialisations)", n)
+		}
+		if !slices.Contains(cols, c) {
+			cols = append(cols, c)
+		}
+	}
+	return cols, nil
+}
+
+func (c Column) header() string {
+	switch c {
+	case ColumnRevision:
+		return "Configuration revision"
+	case ColumnLabel:
+		return "Label"
+	case ColumnNixpkgs:
+		return "Nixpkgs revision"
+	case ColumnSize:
+		return "Closure size"
+	case ColumnSpecialisations:
+		return "Specialisations"
+	}
+	return string(c)
+}
+
+func (c Column) cell(g generation.Generation) string {
+	switch c {
+	case ColumnRevision:
+		return g.ConfigurationRevision
+	case ColumnLabel:
+		return g.Label
+	case ColumnNixpkgs:
+		return g.NixpkgsRevision
+	case ColumnSize:
+		return formatBytes(g.ClosureSize)
+	case ColumnSpecialisations:
+		return strings.Join(g.Specialisations, ", ")
+	}
+	return ""
+}
+
+func withColumns(headers []string, cols []Column) []string {
+	out := append([]string(nil), headers...)
+	for _, c := range cols {
+		out = append(out, c.header())
+	}
+	return out
+}
+
+func rowWithColumns(row []string, g generation.Generation, cols []Column) []string {
+	out := append([]string(nil), row...)
+	for _, c := range cols {
+		out = append(out, c.cell(g))
+	}
+	return out
+}
+
+// describe loads the metadata needed by cols into gens. The closure size is
+// only queried when its column is requested since it walks the whole closure.
+func describe(ctx context.Context, sys generation.System, h exec.Host, gens []generation.Generation, cols []Column) error {
+	if len(cols) == 0 {
+		return nil
+	}
+
+	needSize := slices.Contains(cols, ColumnSize)
+	needMeta := len(cols) > 1 || !needSize
+	querier := diff.NewCachedQuerier(h, diff.DefaultCache())
+
+	for i := range gens {
+		if needMeta {
+			if err := sys.Describe(ctx, h, &gens[i]); err != nil {
+				return err
+			}
+		}
+		if needSize {
+			size, err := querier.GetClosureSize(ctx, gens[i].Path())
+			if err != nil {
+				return fmt.Errorf("closure size of generation %d: %w", gens[i].ID, err)
+			}
+			gens[i].ClosureSize = size
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package gencmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/generation"
+	"github.com/arnarg/nilla-utils/internal/util"
+)
+
+func TestParseColumns(t *testing.T) {
+	cols, err := ParseColumns([]string{"size", "revision", "size", " label "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{ColumnSize, ColumnRevision, ColumnLabel}
+	if !slices.Equal(cols, want) {
+		t.Errorf("got %v want %v", cols, want)
+	}
+
+	if _, err := ParseColumns([]string{"owner"}); err == nil {
+		t.Error("expected error for unknown column")
+	}
+}
+
+func TestRowWithColumns(t *testing.T) {
+	g := generation.Generation{
+		ID:              4,
+		NixpkgsRevision: "abc123",
+		ClosureSize:     3 * util.GiB / 2,
+		Specialisations: []string{"gaming", "work"},
+	}
+	cols := []Column{ColumnNixpkgs, ColumnSize, ColumnSpecialisations}
+
+	row := rowWithColumns([]string{"4"}, g, cols)
+	want := []string{"4", "abc123", "1.50 GiB", "gaming, work"}
+	if !slices.Equal(row, want) {
+		t.Errorf("got %v want %v", row, want)
+	}
+
+	headers := withColumns([]string{"Generation"}, cols)
+	if len(headers) != 4 || headers[2] != "Closure size" {
+		t.Errorf("headers: got %v", headers)
+	}
+}
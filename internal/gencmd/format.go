@@ -0,0 +1,216 @@
+package gencmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+// Format selects how generation listings and plans are printed.
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatCSV   Format = "csv"
+	FormatTSV   Format = "tsv"
+)
+
+// ParseFormat validates a --format value. An empty string selects the table.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatTable, nil
+	case FormatTable, FormatJSON, FormatCSV, FormatTSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected table, json, csv or tsv)", s)
+}
+
+// record is the structured representation of a single generation in a
+// listing, cleanup plan or rollback plan. Rollback, Keep and KeptBy are only set for
+// the plan they belong to, so they are left out of other outputs. The opt-in
+// metadata is omitted unless it was loaded, and Host unless several hosts are
+// listed together.
+type record struct {
+	Host                  string    `json:"host,omitempty"`
+	ID                    int       `json:"id"`
+	BuildDate             time.Time `json:"buildDate"`
+	Version               string    `json:"version"`
+	KernelVersion         string    `json:"kernelVersion,omitempty"`
+	Path                  string    `json:"path"`
+	ConfigurationRevision string    `json:"configurationRevision,omitempty"`
+	Label                 string    `json:"label,omitempty"`
+	NixpkgsRevision       string    `json:"nixpkgsRevision,omitempty"`
+	ClosureSize           int64     `json:"closureSize,omitempty"`
+	Specialisations       []string  `json:"specialisations,omitempty"`
+	Current               bool      `json:"current"`
+	Pinned                bool      `json:"pinned"`
+	Active                bool      `json:"active,omitempty"`
+	Booted                bool      `json:"booted,omitempty"`
+	Rollback              *bool     `json:"rollback,omitempty"`
+	Keep                  *bool     `json:"keep,omitempty"`
+	KeptBy                []string  `json:"keptBy,omitempty"`
+}
+
+func newRecord(g generation.Generation, current generation.Generation) record {
+	return record{
+		ID:                    g.ID,
+		BuildDate:             g.BuildDate,
+		Version:               g.Version,
+		KernelVersion:         g.KernelVersion,
+		Path:                  g.Path(),
+		ConfigurationRevision: g.ConfigurationRevision,
+		Label:                 g.Label,
+		NixpkgsRevision:       g.NixpkgsRevision,
+		ClosureSize:           g.ClosureSize,
+		Specialisations:       g.Specialisations,
+		Current:               g.ID == current.ID,
+		Pinned:                g.Pinned,
+		Active:                g.Active,
+		Booted:                g.Booted,
+	}
+}
+
+// field returns the raw value of an opt-in column for delimited output.
+func (r record) field(c Column) string {
+	switch c {
+	case ColumnRevision:
+		return r.ConfigurationRevision
+	case ColumnLabel:
+		return r.Label
+	case ColumnNixpkgs:
+		return r.NixpkgsRevision
+	case ColumnSize:
+		return strconv.FormatInt(r.ClosureSize, 10)
+	case ColumnSpecialisations:
+		return strings.Join(r.Specialisations, " ")
+	}
+	return ""
+}
+
+func listRecords(gens []generation.Generation, current generation.Generation) []record {
+	recs := make([]record, 0, len(gens))
+	for _, g := range gens {
+		recs = append(recs, newRecord(g, current))
+	}
+	return recs
+}
+
+func planRecords(actions []action, current generation.Generation) []record {
+	recs := make([]record, 0, len(actions))
+	for _, a := range actions {
+		r := newRecord(a.gen, current)
+		keep := a.keep
+		r.Keep = &keep
+		r.KeptBy = a.reasons
+		recs = append(recs, r)
+	}
+	return recs
+}
+
+func rollbackRecords(gens []generation.Generation, current, target generation.Generation) []record {
+	recs := make([]record, 0, len(gens))
+	for _, g := range gens {
+		r := newRecord(g, current)
+		rb := g.ID == target.ID
+		r.Rollback = &rb
+		recs = append(recs, r)
+	}
+	return recs
+}
+
+// writeRecords prints recs in a structured format. FormatTable is rendered by
+// the callers themselves since the table layout is owned by the System. cols
+// adds the opt-in metadata columns to delimited output.
+func writeRecords(w io.Writer, f Format, cols []Column, recs []record) error {
+	switch f {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(recs)
+	case FormatCSV:
+		return writeDelimited(w, ',', cols, recs)
+	case FormatTSV:
+		return writeDelimited(w, '\t', cols, recs)
+	}
+	return fmt.Errorf("format %q is not a structured format", f)
+}
+
+func writeDelimited(w io.Writer, comma rune, cols []Column, recs []record) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	withHost := slices.ContainsFunc(recs, func(r record) bool { return r.Host != "" })
+
+	var header []string
+	if withHost {
+		header = append(header, "host")
+	}
+	header = append(header, "id", "build_date", "version", "kernel_version", "path")
+	for _, c := range cols {
+		header = append(header, string(c))
+	}
+	header = append(header, "current", "pinned", "active", "booted")
+	withRollback := len(recs) > 0 && recs[0].Rollback != nil
+	withKeep := len(recs) > 0 && recs[0].Keep != nil
+	if withRollback {
+		header = append(header, "rollback")
+	}
+	withKeptBy := slices.ContainsFunc(recs, func(r record) bool { return len(r.KeptBy) > 0 })
+	if withKeep {
+		header = append(header, "keep")
+	}
+	if withKeptBy {
+		header = append(header, "kept_by")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range recs {
+		var row []string
+		if withHost {
+			row = append(row, r.Host)
+		}
+		row = append(row,
+			strconv.Itoa(r.ID),
+			r.BuildDate.Format(time.RFC3339),
+			r.Version,
+			r.KernelVersion,
+			r.Path,
+		)
+		for _, c := range cols {
+			row = append(row, r.field(c))
+		}
+		row = append(row,
+			strconv.FormatBool(r.Current),
+			strconv.FormatBool(r.Pinned),
+			strconv.FormatBool(r.Active),
+			strconv.FormatBool(r.Booted),
+		)
+		if withRollback {
+			row = append(row, strconv.FormatBool(r.Rollback != nil && *r.Rollback))
+		}
+		if withKeep {
+			row = append(row, strconv.FormatBool(r.Keep != nil && *r.Keep))
+		}
+		if withKeptBy {
+			// Reasons such as "within 30d" contain spaces
+			row = append(row, strings.Join(r.KeptBy, ";"))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
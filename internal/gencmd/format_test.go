@@ -0,0 +1,133 @@
+package gencmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{"", FormatTable, false},
+		{"table", FormatTable, false},
+		{"json", FormatJSON, false},
+		{"csv", FormatCSV, false},
+		{"tsv", FormatTSV, false},
+		{"yaml", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRecords_JSONPlan(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	g := []generation.Generation{
+		{ID: 2, BuildDate: date, Version: "24.05", KernelVersion: "6.6.1"},
+		{ID: 1, BuildDate: date, Version: "23.11", KernelVersion: "6.1.0"},
+	}
+	actions := buildPlan(g, generation.Generation{ID: 2}, 1)
+
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, FormatJSON, nil, planRecords(actions, generation.Generation{ID: 2})); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, buf.String())
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	if got[0]["current"] != true || got[0]["keep"] != true {
+		t.Errorf("record 0: %v", got[0])
+	}
+	if got[1]["current"] != false || got[1]["keep"] != false {
+		t.Errorf("record 1: %v", got[1])
+	}
+	if got[0]["buildDate"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("buildDate: got %v", got[0]["buildDate"])
+	}
+	if _, ok := got[0]["rollback"]; ok {
+		t.Errorf("cleanup plan should not carry rollback field: %v", got[0])
+	}
+}
+
+func TestWriteRecords_CSVList(t *testing.T) {
+	g := []generation.Generation{{ID: 3, Version: "24.05"}}
+
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, FormatCSV, nil, listRecords(g, generation.Generation{ID: 3})); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got %q", buf.String())
+	}
+	if lines[0] != "id,build_date,version,kernel_version,path,current,pinned,active,booted" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "3,") || !strings.HasSuffix(lines[1], ",true,false,false,false") {
+		t.Errorf("row: got %q", lines[1])
+	}
+}
+
+func TestWriteRecords_TSVRollback(t *testing.T) {
+	g := []generation.Generation{{ID: 2}, {ID: 1}}
+
+	var buf bytes.Buffer
+	recs := rollbackRecords(g, generation.Generation{ID: 2}, generation.Generation{ID: 1})
+	if err := writeRecords(&buf, FormatTSV, nil, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got := strings.Split(lines[0], "\t"); got[len(got)-1] != "rollback" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], "\tfalse\tfalse\tfalse\tfalse\ttrue") {
+		t.Errorf("rollback row: got %q", lines[2])
+	}
+}
+
+func TestWriteRecords_TSVKeptBy(t *testing.T) {
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	g := []generation.Generation{{ID: 2, BuildDate: now}, {ID: 1, BuildDate: now.AddDate(0, -2, 0)}}
+	actions := buildPlanRetention(g, generation.Generation{ID: 2}, 0, Retention{OlderThan: 30 * 24 * time.Hour}, now)
+
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, FormatTSV, nil, planRecords(actions, generation.Generation{ID: 2})); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got := strings.Split(lines[0], "\t"); got[len(got)-1] != "kept_by" {
+		t.Errorf("header: got %q", lines[0])
+	}
+	if got := strings.Split(lines[1], "\t"); got[len(got)-1] != "current;within 30d" {
+		t.Errorf("kept_by: got %q", got[len(got)-1])
+	}
+}
+
+func TestWriteRecords_TableRejected(t *testing.T) {
+	if err := writeRecords(&bytes.Buffer{}, FormatTable, nil, nil); err == nil {
+		t.Error("expected error for table format")
+	}
+}
@@ -8,10 +8,14 @@ import (
 	"cmp"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"slices"
+	"strings"
+	"time"
 
 	"charm.land/lipgloss/v2"
+	"github.com/arnarg/nilla-utils/internal/diff"
 	"github.com/arnarg/nilla-utils/internal/exec"
 	"github.com/arnarg/nilla-utils/internal/generation"
 	"github.com/arnarg/nilla-utils/internal/tui"
@@ -29,36 +33,63 @@ var (
 			Bold(true).
 			SetString(">").
 			String()
+	activeMarker = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("12")).
+			Bold(true).
+			SetString("+").
+			String()
+	bootedMarker = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("11")).
+			Bold(true).
+			SetString("@").
+			String()
+	pinMarker = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("14")).
+			Bold(true).
+			SetString("^").
+			String()
 	keepStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
 	delStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
 )
 
 type action struct {
-	gen  generation.Generation
-	keep bool
+	gen     generation.Generation
+	keep    bool
+	reasons []string
+}
+
+// ListOptions configures the behaviour of List.
+type ListOptions struct {
+	Format  Format
+	Columns []Column
 }
 
 // CleanOptions configures the behaviour of Clean.
 type CleanOptions struct {
-	Keep    uint
-	KeepSet bool
-	From    *int
-	To      *int
-	Confirm bool
-	SkipGC  bool
+	Keep      uint
+	KeepSet   bool
+	Retention Retention
+	From      *int
+	To        *int
+	Confirm   bool
+	SkipGC    bool
+	Format    Format
 }
 
-// RollbackOptions configures the behaviour of Rollback.
+// RollbackOptions configures the behaviour of Rollback. Boot only changes the
+// boot default instead of activating the target generation.
 type RollbackOptions struct {
 	ID      *int
 	Confirm bool
 	Cleanup bool
+	Boot    bool
 	SkipGC  bool
+	Format  Format
 }
 
 // List prints all generations of sys (on target, or locally when target is
 // empty), marking the current one.
-func List(ctx context.Context, sys generation.System, target string) error {
+func List(ctx context.Context, sys generation.System, target string, opts ListOptions) error {
 	h, err := exec.NewHost(ctx, target, nil)
 	if err != nil {
 		return err
@@ -77,12 +108,25 @@ func List(ctx context.Context, sys generation.System, target string) error {
 
 	sortDesc(generations)
 
+	if err := describe(ctx, sys, h, generations, opts.Columns); err != nil {
+		return err
+	}
+
+	if isStructured(opts.Format) {
+		return writeRecords(os.Stdout, opts.Format, opts.Columns, listRecords(generations, current))
+	}
+
+	tracked := isTracked(generations)
+
 	rows := make([][]string, 0, len(generations))
 	for _, g := range generations {
-		rows = append(rows, withCurrentMarker(sys.Row(g), g.ID == current.ID))
+		rows = append(rows, listRow(sys, g, current, opts.Columns, tracked))
 	}
 
-	fmt.Println(util.RenderTable(sys.Headers(), rows...))
+	fmt.Println(util.RenderTable(withColumns(sys.Headers(), opts.Columns), rows...))
+	if tracked {
+		fmt.Println(stateLegend(generations))
+	}
 	return nil
 }
 
@@ -90,13 +134,10 @@ func List(ctx context.Context, sys generation.System, target string) error {
 // generation links and runs garbage collection. For systems that require local
 // root privileges it self-elevates before opening the host.
 func Clean(ctx context.Context, sys generation.System, target string, opts CleanOptions) error {
-	rangeMode := opts.From != nil || opts.To != nil
-	if rangeMode && opts.KeepSet {
-		return fmt.Errorf("cannot use --keep with --from/--to")
-	}
-	if opts.From != nil && opts.To != nil && *opts.From > *opts.To {
-		return fmt.Errorf("--from cannot be greater than --to")
+	if err := opts.validate(); err != nil {
+		return err
 	}
+	retentionMode := opts.Retention.IsSet()
 
 	// SelfElevate replaces the process, so it must run before NewHost.
 	if target == "" && sys.RequiresLocalRoot() && !util.IsRoot() {
@@ -121,20 +162,36 @@ func Clean(ctx context.Context, sys generation.System, target string, opts Clean
 
 	sortDesc(generations)
 
-	var actions []action
-	if rangeMode {
-		actions = buildPlanRange(generations, current, opts.From, opts.To)
+	actions := opts.plan(generations, current)
+
+	if isStructured(opts.Format) {
+		if err := writeRecords(os.Stdout, opts.Format, nil, planRecords(actions, current)); err != nil {
+			return err
+		}
 	} else {
-		actions = buildPlan(generations, current, opts.Keep)
-	}
+		headers := sys.Headers()
+		if retentionMode {
+			headers = append(headers, "Kept by")
+		}
 
-	rows := make([][]string, 0, len(actions))
-	for _, a := range actions {
-		rows = append(rows, planRow(sys.Row(a.gen), a, a.gen.ID == current.ID))
+		rows := make([][]string, 0, len(actions))
+		for _, a := range actions {
+			rows = append(rows, cleanRow(sys, a, current, retentionMode))
+		}
+
+		printSection("Cleanup Plan")
+		fmt.Fprintln(os.Stderr, util.RenderTable(headers, rows...))
 	}
 
-	printSection("Cleanup Plan")
-	fmt.Fprintln(os.Stderr, util.RenderTable(sys.Headers(), rows...))
+	toDelete := doomed(actions)
+
+	if len(toDelete) > 0 {
+		if r, err := generation.EstimateReclaim(ctx, sys, h, diff.NewCachedQuerier(h, diff.DefaultCache()), toDelete); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not estimate reclaimable space: %s\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Estimated space to reclaim: %s (%d store paths)\n", formatBytes(r.Bytes), r.Paths)
+		}
+	}
 
 	if !opts.Confirm {
 		ok, err := tui.RunConfirm("Do you want to continue?")
@@ -146,30 +203,102 @@ func Clean(ctx context.Context, sys generation.System, target string, opts Clean
 		}
 	}
 
-	var toDelete []generation.Generation
-	for _, a := range actions {
-		if !a.keep {
-			toDelete = append(toDelete, a.gen)
-		}
-	}
-
 	if err := sys.DeleteGenerations(h, toDelete); err != nil {
 		return err
 	}
 
+	if bl, ok := sys.(generation.Bootloader); ok && len(toDelete) > 0 {
+		fmt.Fprintln(os.Stderr)
+		printSection("Updating bootloader")
+		if err := updateBootloader(ctx, os.Stderr, bl, h); err != nil {
+			return err
+		}
+	}
+
 	if opts.SkipGC {
 		return nil
 	}
 
 	fmt.Fprintln(os.Stderr)
 	printSection("Collecting garbage from nix store")
-	return sys.CollectGarbage(ctx, h)
+	stats, err := sys.CollectGarbage(ctx, h)
+	if err != nil {
+		return err
+	}
+	if stats != nil {
+		fmt.Fprintf(os.Stderr, "Freed %s (%d store paths)\n", formatBytes(stats.Freed), stats.Paths)
+	}
+	return nil
+}
+
+func (o CleanOptions) validate() error {
+	rangeMode := o.From != nil || o.To != nil
+	if rangeMode && o.KeepSet {
+		return fmt.Errorf("cannot use --keep with --from/--to")
+	}
+	if rangeMode && o.Retention.IsSet() {
+		return fmt.Errorf("cannot use retention rules with --from/--to")
+	}
+	if o.From != nil && o.To != nil && *o.From > *o.To {
+		return fmt.Errorf("--from cannot be greater than --to")
+	}
+	return checkConfirm(o.Format, o.Confirm)
+}
+
+// checkConfirm refuses structured output without --confirm, as the prompt
+// would be mixed into output meant for another program.
+func checkConfirm(f Format, confirm bool) error {
+	if isStructured(f) && !confirm {
+		return fmt.Errorf("--format %s cannot ask for confirmation, use --confirm", f)
+	}
+	return nil
+}
+
+// plan builds the keep/delete plan selected by o for gens, which must be
+// sorted newest first.
+func (o CleanOptions) plan(gens []generation.Generation, current generation.Generation) []action {
+	switch {
+	case o.From != nil || o.To != nil:
+		return buildPlanRange(gens, current, o.From, o.To)
+	case o.Retention.IsSet():
+		// --keep only adds a "last N" rule when given explicitly, its
+		// default would otherwise keep a generation nobody asked for.
+		var keep uint
+		if o.KeepSet {
+			keep = o.Keep
+		}
+		return buildPlanRetention(gens, current, keep, o.Retention, time.Now())
+	}
+	return buildPlan(gens, current, o.Keep)
+}
+
+// doomed returns the generations actions marks for deletion.
+func doomed(actions []action) []generation.Generation {
+	var gens []generation.Generation
+	for _, a := range actions {
+		if !a.keep {
+			gens = append(gens, a.gen)
+		}
+	}
+	return gens
 }
 
 // Rollback activates an older generation and, unless suppressed, cleans up all
 // generations newer than the target. When no ID is given it rolls back to the
 // previous generation (current - 1).
 func Rollback(ctx context.Context, sys generation.System, target string, opts RollbackOptions) error {
+	bl, hasBootloader := sys.(generation.Bootloader)
+	if opts.Boot && !hasBootloader {
+		return fmt.Errorf("--boot is only supported for systems with a bootloader")
+	}
+	if opts.Boot && opts.Cleanup {
+		// The newer generations include the one that is still running.
+		return fmt.Errorf("cannot use --cleanup with --boot")
+	}
+	if err := checkConfirm(opts.Format, opts.Confirm); err != nil {
+		return err
+	}
+
 	// SelfElevate replaces the process, so it must run before NewHost.
 	if target == "" && sys.RequiresLocalRoot() && !util.IsRoot() {
 		return util.SelfElevate()
@@ -222,9 +351,16 @@ func Rollback(ctx context.Context, sys generation.System, target string, opts Ro
 
 	if !targetFound {
 		// Print generations before erroring
+		if isStructured(opts.Format) {
+			if err := writeRecords(os.Stdout, opts.Format, nil, listRecords(generations, current)); err != nil {
+				return err
+			}
+			return fmt.Errorf("generation %d not found", targetID)
+		}
+
 		rows := make([][]string, 0, len(generations))
 		for _, g := range generations {
-			rows = append(rows, withCurrentMarker(sys.Row(g), g.ID == current.ID))
+			rows = append(rows, withPinMarker(withCurrentMarker(sys.Row(g), g.ID == current.ID), g.Pinned))
 		}
 
 		fmt.Println(util.RenderTable(sys.Headers(), rows...))
@@ -233,13 +369,19 @@ func Rollback(ctx context.Context, sys generation.System, target string, opts Ro
 	}
 
 	// Print rollback plan
-	rows := make([][]string, 0, len(generations))
-	for _, g := range generations {
-		rows = append(rows, withCurrentOrRollbackMarker(sys.Row(g), g.ID == current.ID, g.ID == targetGen.ID))
-	}
+	if isStructured(opts.Format) {
+		if err := writeRecords(os.Stdout, opts.Format, nil, rollbackRecords(generations, current, targetGen)); err != nil {
+			return err
+		}
+	} else {
+		rows := make([][]string, 0, len(generations))
+		for _, g := range generations {
+			rows = append(rows, withPinMarker(withCurrentOrRollbackMarker(sys.Row(g), g.ID == current.ID, g.ID == targetGen.ID), g.Pinned))
+		}
 
-	printSection("Rollback Plan")
-	fmt.Fprintln(os.Stderr, util.RenderTable(sys.Headers(), rows...))
+		printSection("Rollback Plan")
+		fmt.Fprintln(os.Stderr, util.RenderTable(sys.Headers(), rows...))
+	}
 
 	if !opts.Confirm {
 		ok, err := tui.RunConfirm("Do you want to continue?")
@@ -251,6 +393,14 @@ func Rollback(ctx context.Context, sys generation.System, target string, opts Ro
 		}
 	}
 
+	if opts.Boot {
+		if err := bl.SetBootDefault(ctx, h, targetGen); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Generation %d will be booted by default\n", targetGen.ID)
+		return nil
+	}
+
 	if err := sys.Rollback(ctx, h, targetGen); err != nil {
 		return err
 	}
@@ -267,17 +417,113 @@ func Rollback(ctx context.Context, sys generation.System, target string, opts Ro
 		From:    &from,
 		Confirm: opts.Confirm,
 		SkipGC:  opts.SkipGC,
+		Format:  opts.Format,
 	})
 }
 
+// Pin marks generation id of sys as pinned (or unpinned), protecting it from
+// Clean and rollback cleanup.
+func Pin(ctx context.Context, sys generation.System, target string, id int, pinned bool) error {
+	// SelfElevate replaces the process, so it must run before NewHost.
+	if target == "" && sys.RequiresLocalRoot() && !util.IsRoot() {
+		return util.SelfElevate()
+	}
+
+	h, err := exec.NewHost(ctx, target, nil)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	generations, err := sys.List(h)
+	if err != nil {
+		return err
+	}
+
+	idx := slices.IndexFunc(generations, func(g generation.Generation) bool { return g.ID == id })
+	if idx < 0 {
+		return fmt.Errorf("generation %d not found", id)
+	}
+	g := generations[idx]
+
+	switch {
+	case pinned && g.Pinned:
+		fmt.Fprintf(os.Stderr, "Generation %d is already pinned\n", id)
+		return nil
+	case !pinned && !g.Pinned:
+		fmt.Fprintf(os.Stderr, "Generation %d is not pinned\n", id)
+		return nil
+	case pinned:
+		if err := sys.Pin(ctx, h, g); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Pinned generation %d\n", id)
+	default:
+		if err := sys.Unpin(ctx, h, g); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Unpinned generation %d\n", id)
+	}
+	return nil
+}
+
+// updateBootloader regenerates the boot menu and reports the entries that
+// disappeared from it to w. Failing to inspect the entries only skips the
+// report.
+func updateBootloader(ctx context.Context, w io.Writer, bl generation.Bootloader, h exec.Host) error {
+	before, listErr := bl.BootEntries(h)
+
+	if err := bl.UpdateBootloader(ctx, h); err != nil {
+		return err
+	}
+
+	if listErr != nil {
+		fmt.Fprintf(w, "Could not inspect boot entries: %s\n", listErr)
+		return nil
+	}
+	after, err := bl.BootEntries(h)
+	if err != nil {
+		fmt.Fprintf(w, "Could not inspect boot entries: %s\n", err)
+		return nil
+	}
+
+	pruned := prunedEntries(before, after)
+	if len(pruned) == 0 {
+		fmt.Fprintln(w, "No boot entries were pruned")
+		return nil
+	}
+	fmt.Fprintln(w, "Pruned boot entries:")
+	for _, e := range pruned {
+		fmt.Fprintf(w, "  %s\n", delStyle.Render(e))
+	}
+	return nil
+}
+
+// prunedEntries returns the entries of before that are missing from after.
+func prunedEntries(before, after []string) []string {
+	var pruned []string
+	for _, e := range before {
+		if !slices.Contains(after, e) {
+			pruned = append(pruned, e)
+		}
+	}
+	return pruned
+}
+
 // buildPlan mirrors the original keep/current heuristic: keep the newest `keep`
 // generations, always keep the current one, and never delete the current one to
-// satisfy the last remaining slot.
+// satisfy the last remaining slot. Pinned generations are kept on top of that
+// and do not take up a slot.
 func buildPlan(gens []generation.Generation, current generation.Generation, keep uint) []action {
 	remaining := keep
 	foundCurrent := false
 	actions := make([]action, 0, len(gens))
 	for _, g := range gens {
+		if g.Pinned && g.ID != current.ID {
+			actions = append(actions, action{gen: g, keep: true})
+			continue
+		}
+
 		doKeep := remaining > 0
 
 		if g.ID == current.ID {
@@ -291,13 +537,14 @@ func buildPlan(gens []generation.Generation, current generation.Generation, keep
 			remaining -= 1
 		}
 
-		actions = append(actions, action{g, doKeep})
+		actions = append(actions, action{gen: g, keep: doKeep})
 	}
 	return actions
 }
 
 // buildPlanRange marks generations within [from, to] for deletion. A nil bound
-// means unbounded on that side. The current generation is always protected.
+// means unbounded on that side. The current and pinned generations are always
+// protected.
 func buildPlanRange(gens []generation.Generation, current generation.Generation, from, to *int) []action {
 	actions := make([]action, 0, len(gens))
 	for _, g := range gens {
@@ -309,14 +556,20 @@ func buildPlanRange(gens []generation.Generation, current generation.Generation,
 			inRange = false
 		}
 		doKeep := !inRange
-		if g.ID == current.ID {
+		if g.ID == current.ID || g.Pinned {
 			doKeep = true
 		}
-		actions = append(actions, action{g, doKeep})
+		actions = append(actions, action{gen: g, keep: doKeep})
 	}
 	return actions
 }
 
+// isStructured reports whether f is a machine-readable format. The zero value
+// renders as a table.
+func isStructured(f Format) bool {
+	return f != "" && f != FormatTable
+}
+
 func sortDesc(gens []generation.Generation) {
 	slices.SortFunc(gens, func(a, b generation.Generation) int {
 		return cmp.Compare(b.ID, a.ID)
@@ -333,6 +586,30 @@ func withCurrentMarker(row []string, current bool) []string {
 	return cells
 }
 
+func withPinMarker(row []string, pinned bool) []string {
+	if !pinned {
+		return row
+	}
+	cells := append([]string(nil), row...)
+	cells[0] = fmt.Sprintf("%s %s", cells[0], pinMarker)
+	return cells
+}
+
+// withStateMarkers prefixes the first cell with one slot each for the
+// default, active and booted markers.
+func withStateMarkers(row []string, current, active, booted bool) []string {
+	slot := func(set bool, marker string) string {
+		if set {
+			return marker
+		}
+		return " "
+	}
+	cells := append([]string(nil), row...)
+	cells[0] = fmt.Sprintf("%s%s%s %s",
+		slot(current, currentMarker), slot(active, activeMarker), slot(booted, bootedMarker), cells[0])
+	return cells
+}
+
 func withCurrentOrRollbackMarker(row []string, current, desired bool) []string {
 	pre := " "
 	style := lipgloss.NewStyle()
@@ -353,6 +630,46 @@ func withCurrentOrRollbackMarker(row []string, current, desired bool) []string {
 	return cells
 }
 
+// isTracked reports whether the system knows the running and booted
+// generations, in which case each gets a marker next to the one for the
+// profile's default.
+func isTracked(gens []generation.Generation) bool {
+	return slices.ContainsFunc(gens, func(g generation.Generation) bool {
+		return g.Active || g.Booted
+	})
+}
+
+// stateLegend explains the markers of a tracked listing, leaving out the
+// states no generation in gens is in, such as active for a MicroVM.
+func stateLegend(gens []generation.Generation) string {
+	entries := []string{currentMarker + " default"}
+	if slices.ContainsFunc(gens, func(g generation.Generation) bool { return g.Active }) {
+		entries = append(entries, activeMarker+" active")
+	}
+	if slices.ContainsFunc(gens, func(g generation.Generation) bool { return g.Booted }) {
+		entries = append(entries, bootedMarker+" booted")
+	}
+	return strings.Join(entries, "  ")
+}
+
+func listRow(sys generation.System, g, current generation.Generation, cols []Column, tracked bool) []string {
+	row := rowWithColumns(sys.Row(g), g, cols)
+	if tracked {
+		row = withStateMarkers(row, g.ID == current.ID, g.Active, g.Booted)
+	} else {
+		row = withCurrentMarker(row, g.ID == current.ID)
+	}
+	return withPinMarker(row, g.Pinned)
+}
+
+func cleanRow(sys generation.System, a action, current generation.Generation, retention bool) []string {
+	row := sys.Row(a.gen)
+	if retention {
+		row = append(row, strings.Join(a.reasons, ", "))
+	}
+	return planRow(row, a, a.gen.ID == current.ID)
+}
+
 func planRow(row []string, a action, current bool) []string {
 	pre := " "
 	if current {
@@ -367,9 +684,18 @@ func planRow(row []string, a action, current bool) []string {
 		cells[i] = style.SetString(c).String()
 	}
 	cells[0] = fmt.Sprintf("%s %s", pre, cells[0])
-	return cells
+	return withPinMarker(cells, a.gen.Pinned)
+}
+
+func formatBytes(b int64) string {
+	size, unit := util.ConvertBytes(b)
+	return fmt.Sprintf("%.2f %s", size, unit)
 }
 
 func printSection(text string) {
-	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+	fprintSection(os.Stderr, text)
+}
+
+func fprintSection(w io.Writer, text string) {
+	fmt.Fprintf(w, "\033[32m>\033[0m %s\n", text)
 }
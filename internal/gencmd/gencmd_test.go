@@ -83,6 +83,38 @@ func TestBuildPlan_CurrentNeverDeleted(t *testing.T) {
 	}
 }
 
+func TestBuildPlan_PinnedKeptOutsideSlots(t *testing.T) {
+	g := gens(5, 4, 3, 2, 1)
+	g[3].Pinned = true // generation 2
+
+	actions := buildPlan(g, generation.Generation{ID: 5}, 2)
+	if k := keptIDs(actions); !eq(k, 5, 4, 2) {
+		t.Errorf("kept: got %v want [5 4 2]", k)
+	}
+}
+
+func TestBuildPlanRange_PinnedProtected(t *testing.T) {
+	g := gens(5, 4, 3, 2, 1)
+	g[2].Pinned = true // generation 3
+	from, to := 2, 4
+
+	actions := buildPlanRange(g, generation.Generation{ID: 5}, &from, &to)
+	if d := deletedIDs(actions); !eq(d, 4, 2) {
+		t.Errorf("deleted: got %v want [4 2]", d)
+	}
+}
+
+func TestWithPinMarker(t *testing.T) {
+	row := []string{"  5", "2024-01-01"}
+	if out := withPinMarker(row, false); out[0] != "  5" {
+		t.Errorf("unpinned first cell: got %q", out[0])
+	}
+	out := withPinMarker(row, true)
+	if !strings.Contains(out[0], "^") || row[0] != "  5" {
+		t.Errorf("pinned first cell: got %q (original %q)", out[0], row[0])
+	}
+}
+
 func TestWithCurrentMarker(t *testing.T) {
 	row := []string{"5", "2024-01-01", "23.11"}
 	out := withCurrentMarker(row, false)
@@ -151,3 +183,83 @@ func contains(s []int, v int) bool {
 	}
 	return false
 }
+
+func TestPrunedEntries(t *testing.T) {
+	before := []string{"nixos-generation-1", "nixos-generation-2", "nixos-generation-3"}
+	after := []string{"nixos-generation-3"}
+	got := prunedEntries(before, after)
+	if len(got) != 2 || got[0] != "nixos-generation-1" || got[1] != "nixos-generation-2" {
+		t.Errorf("got %v", got)
+	}
+	if got := prunedEntries(after, after); len(got) != 0 {
+		t.Errorf("expected nothing pruned, got %v", got)
+	}
+}
+
+func TestWithStateMarkers(t *testing.T) {
+	row := []string{"5", "2024-01-01"}
+
+	out := withStateMarkers(row, false, false, false)
+	if out[0] != "    5" {
+		t.Errorf("no markers: got %q", out[0])
+	}
+
+	out = withStateMarkers(row, true, false, true)
+	if !strings.Contains(out[0], "*") || strings.Contains(out[0], "+") || !strings.Contains(out[0], "@") {
+		t.Errorf("default and booted: got %q", out[0])
+	}
+	if row[0] != "5" {
+		t.Errorf("original row mutated: %v", row)
+	}
+}
+
+func TestStateLegend(t *testing.T) {
+	tests := []struct {
+		name string
+		gens []generation.Generation
+		want []string
+		omit []string
+	}{
+		{"nixos", []generation.Generation{{ID: 2, Active: true}, {ID: 1, Booted: true}}, []string{"default", "active", "booted"}, nil},
+		{"microvm", []generation.Generation{{ID: 2, Booted: true}, {ID: 1}}, []string{"default", "booted"}, []string{"active"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stateLegend(tt.gens)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("legend %q is missing %q", got, w)
+				}
+			}
+			for _, o := range tt.omit {
+				if strings.Contains(got, o) {
+					t.Errorf("legend %q should not contain %q", got, o)
+				}
+			}
+		})
+	}
+}
+
+func TestCleanOptionsValidate(t *testing.T) {
+	one, two := 1, 2
+	tests := []struct {
+		name    string
+		opts    CleanOptions
+		wantErr bool
+	}{
+		{"defaults", CleanOptions{}, false},
+		{"range", CleanOptions{From: &one, To: &two}, false},
+		{"inverted range", CleanOptions{From: &two, To: &one}, true},
+		{"keep with range", CleanOptions{KeepSet: true, From: &one}, true},
+		{"structured without confirm", CleanOptions{Format: FormatJSON}, true},
+		{"structured with confirm", CleanOptions{Format: FormatCSV, Confirm: true}, false},
+		{"table without confirm", CleanOptions{Format: FormatTable}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package gencmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/askpass"
+	"github.com/arnarg/nilla-utils/internal/diff"
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/generation"
+	"github.com/arnarg/nilla-utils/internal/nix"
+	"github.com/arnarg/nilla-utils/internal/project"
+	"github.com/arnarg/nilla-utils/internal/tui"
+	"github.com/arnarg/nilla-utils/internal/util"
+	"github.com/sourcegraph/conc/pool"
+	"github.com/urfave/cli/v3"
+)
+
+// ParseTargets splits a comma-separated --target value into its hosts,
+// dropping empty entries and duplicates.
+func ParseTargets(s string) []string {
+	var targets []string
+	seen := map[string]bool{}
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// GenerationSystem returns the System selected by --profile, or def when no
+// profile is given.
+func GenerationSystem(cmd *cli.Command, def generation.System) (generation.System, error) {
+	profile := cmd.String("profile")
+	if profile == "" {
+		return def, nil
+	}
+	if !filepath.IsAbs(profile) && !strings.HasPrefix(profile, "~/") {
+		if cmd.String("target") != "" || cmd.Bool("all-targets") {
+			return nil, fmt.Errorf("profile path must be absolute or start with ~/ when using --target")
+		}
+		abs, err := filepath.Abs(profile)
+		if err != nil {
+			return nil, err
+		}
+		profile = abs
+	}
+	return generation.ProfileSystem{Path: profile}, nil
+}
+
+// GenerationTargets returns the hosts selected by a comma-separated --target,
+// or with --all-targets the targets of the systems in attr of the project,
+// which are called name in errors. It is empty for the local machine.
+func GenerationTargets(cmd *cli.Command, attr, name string) ([]string, error) {
+	if !cmd.Bool("all-targets") {
+		return ParseTargets(cmd.String("target")), nil
+	}
+	if cmd.String("target") != "" {
+		return nil, fmt.Errorf("cannot use --all-targets with --target")
+	}
+
+	source, err := project.Resolve(cmd.String("project"))
+	if err != nil {
+		return nil, err
+	}
+	byName, err := nix.TargetsInProject(source.NillaPath, source.FixedOutputStoreEntry(), attr)
+	if err != nil {
+		return nil, err
+	}
+	if len(byName) == 0 {
+		return nil, fmt.Errorf("no %s configurations in project have a target set", name)
+	}
+
+	var targets []string
+	for _, n := range slices.Sorted(maps.Keys(byName)) {
+		if !slices.Contains(targets, byName[n]) {
+			targets = append(targets, byName[n])
+		}
+	}
+	return targets, nil
+}
+
+// SingleTarget returns --target for commands that only work on one host.
+func SingleTarget(cmd *cli.Command) (string, error) {
+	targets := ParseTargets(cmd.String("target"))
+	if len(targets) > 1 {
+		return "", fmt.Errorf("only one --target is supported by this command")
+	}
+	return FirstTarget(targets), nil
+}
+
+// FirstTarget returns the first of targets, or the local machine when there
+// is none.
+func FirstTarget(targets []string) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	return targets[0]
+}
+
+// hostState holds the generations of sys loaded from a single host.
+type hostState struct {
+	target  string
+	h       exec.Host
+	current generation.Generation
+	gens    []generation.Generation
+
+	// out collects the output of commands run on h once it is captured
+	out bytes.Buffer
+}
+
+// loadHosts connects to every target in parallel and loads its generations,
+// sorted newest first. The returned slice is in the order of targets, with nil
+// for hosts that failed. All connections share cache.
+func loadHosts(ctx context.Context, sys generation.System, targets []string, cache *askpass.PasswordCache, cols []Column) ([]*hostState, error) {
+	states := make([]*hostState, len(targets))
+	errs := make([]error, len(targets))
+
+	p := pool.New()
+	for i, target := range targets {
+		p.Go(func() {
+			s, err := loadHost(ctx, sys, target, cache, cols)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target, err)
+				return
+			}
+			states[i] = s
+		})
+	}
+	p.Wait()
+
+	return states, errors.Join(errs...)
+}
+
+func loadHost(ctx context.Context, sys generation.System, target string, cache *askpass.PasswordCache, cols []Column) (*hostState, error) {
+	h, err := exec.NewHost(ctx, target, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := sys.Current(h)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	gens, err := sys.List(h)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	sortDesc(gens)
+
+	if err := describe(ctx, sys, h, gens, cols); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return &hostState{target: target, h: h, current: current, gens: gens}, nil
+}
+
+func closeHosts(states []*hostState) {
+	for _, s := range states {
+		if s != nil {
+			s.h.Close()
+		}
+	}
+}
+
+// ListHosts prints the generations of sys on every target in one table
+// grouped by host. Hosts that cannot be listed are reported in the returned
+// error after the others have been printed.
+func ListHosts(ctx context.Context, sys generation.System, targets []string, opts ListOptions) error {
+	states, loadErr := loadHosts(ctx, sys, targets, askpass.NewPasswordCache(), opts.Columns)
+	defer closeHosts(states)
+
+	if isStructured(opts.Format) {
+		var recs []record
+		for _, s := range states {
+			if s == nil {
+				continue
+			}
+			for _, r := range listRecords(s.gens, s.current) {
+				r.Host = s.target
+				recs = append(recs, r)
+			}
+		}
+		if err := writeRecords(os.Stdout, opts.Format, opts.Columns, recs); err != nil {
+			return err
+		}
+		return loadErr
+	}
+
+	var all []generation.Generation
+	for _, s := range states {
+		if s != nil {
+			all = append(all, s.gens...)
+		}
+	}
+	tracked := isTracked(all)
+
+	var rows [][]string
+	for _, s := range states {
+		if s == nil {
+			continue
+		}
+		group := make([][]string, 0, len(s.gens))
+		for _, g := range s.gens {
+			group = append(group, listRow(sys, g, s.current, opts.Columns, tracked))
+		}
+		rows = append(rows, groupRows(s.target, group)...)
+	}
+
+	if len(rows) > 0 {
+		headers := append([]string{"Host"}, withColumns(sys.Headers(), opts.Columns)...)
+		fmt.Println(util.RenderTable(headers, rows...))
+		if tracked {
+			fmt.Println(stateLegend(all))
+		}
+	}
+	return loadErr
+}
+
+// CleanHosts builds a cleanup plan for every target, asks for a single
+// confirmation and then deletes the doomed generations and collects garbage
+// on all hosts concurrently. Nothing is deleted unless every host could be
+// planned. The output of each host is held back and printed under its own
+// heading once all are done, and sudo passwords are asked for one at a time
+// through the password cache shared by all connections.
+func CleanHosts(ctx context.Context, sys generation.System, targets []string, opts CleanOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	retentionMode := opts.Retention.IsSet()
+
+	cache := askpass.NewPasswordCache()
+	states, err := loadHosts(ctx, sys, targets, cache, nil)
+	defer closeHosts(states)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		s.h = exec.NewCapturedHost(s.h, passwordKey(s.target), cache, &s.out)
+	}
+
+	plans := make([][]action, len(states))
+	for i, s := range states {
+		plans[i] = opts.plan(s.gens, s.current)
+	}
+
+	if isStructured(opts.Format) {
+		var recs []record
+		for i, s := range states {
+			for _, r := range planRecords(plans[i], s.current) {
+				r.Host = s.target
+				recs = append(recs, r)
+			}
+		}
+		if err := writeRecords(os.Stdout, opts.Format, nil, recs); err != nil {
+			return err
+		}
+	} else {
+		headers := append([]string{"Host"}, sys.Headers()...)
+		if retentionMode {
+			headers = append(headers, "Kept by")
+		}
+
+		var rows [][]string
+		for i, s := range states {
+			group := make([][]string, 0, len(plans[i]))
+			for _, a := range plans[i] {
+				group = append(group, cleanRow(sys, a, s.current, retentionMode))
+			}
+			rows = append(rows, groupRows(s.target, group)...)
+		}
+
+		printSection("Cleanup Plan")
+		fmt.Fprintln(os.Stderr, util.RenderTable(headers, rows...))
+	}
+
+	reclaims := make([]*generation.Reclaim, len(states))
+	p := pool.New()
+	for i, s := range states {
+		toDelete := doomed(plans[i])
+		if len(toDelete) == 0 {
+			continue
+		}
+		p.Go(func() {
+			r, err := generation.EstimateReclaim(ctx, sys, s.h, diff.NewCachedQuerier(s.h, diff.DefaultCache()), toDelete)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not estimate reclaimable space on %s: %s\n", s.target, err)
+				return
+			}
+			reclaims[i] = &r
+		})
+	}
+	p.Wait()
+
+	var total generation.Reclaim
+	for i, r := range reclaims {
+		if r == nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Estimated space to reclaim on %s: %s (%d store paths)\n", states[i].target, formatBytes(r.Bytes), r.Paths)
+		total.Bytes += r.Bytes
+		total.Paths += r.Paths
+	}
+	if total.Paths > 0 {
+		fmt.Fprintf(os.Stderr, "Estimated space to reclaim in total: %s (%d store paths)\n", formatBytes(total.Bytes), total.Paths)
+	}
+
+	if !opts.Confirm {
+		ok, err := tui.RunConfirm("Do you want to continue?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection(fmt.Sprintf("Cleaning up %d hosts", len(states)))
+
+	results := make([]string, len(states))
+	errs := make([]error, len(states))
+	p = pool.New()
+	for i, s := range states {
+		p.Go(func() {
+			res, err := cleanHost(ctx, sys, s, doomed(plans[i]), opts.SkipGC)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", s.target, err)
+				return
+			}
+			results[i] = res
+		})
+	}
+	p.Wait()
+
+	for _, s := range states {
+		if s.out.Len() == 0 {
+			continue
+		}
+		fmt.Fprintln(os.Stderr)
+		printSection(s.target)
+		os.Stderr.Write(s.out.Bytes())
+	}
+
+	rows := make([][]string, 0, len(states))
+	for i, s := range states {
+		status := results[i]
+		if errs[i] != nil {
+			status = delStyle.Render("failed")
+		}
+		rows = append(rows, []string{s.target, strconv.Itoa(len(doomed(plans[i]))), status})
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, util.RenderTable([]string{"Host", "Deleted", "Freed"}, rows...))
+
+	return errors.Join(errs...)
+}
+
+// cleanHost deletes toDelete from a single host, refreshes its boot menu and
+// collects garbage, returning a summary of the space freed. Its output goes
+// to the host's own buffer.
+func cleanHost(ctx context.Context, sys generation.System, s *hostState, toDelete []generation.Generation, skipGC bool) (string, error) {
+	w := exec.Terminal(s.h)
+
+	if err := sys.DeleteGenerations(s.h, toDelete); err != nil {
+		return "", err
+	}
+
+	if bl, ok := sys.(generation.Bootloader); ok && len(toDelete) > 0 {
+		fprintSection(w, "Updating bootloader")
+		if err := updateBootloader(ctx, w, bl, s.h); err != nil {
+			return "", fmt.Errorf("update bootloader: %w", err)
+		}
+	}
+
+	if skipGC {
+		return "skipped gc", nil
+	}
+
+	fprintSection(w, "Collecting garbage from nix store")
+	stats, err := sys.CollectGarbage(ctx, s.h)
+	if err != nil {
+		return "", err
+	}
+	if stats == nil {
+		return "", nil
+	}
+	return fmt.Sprintf("%s (%d store paths)", formatBytes(stats.Freed), stats.Paths), nil
+}
+
+// passwordKey returns the password cache key of target, user@host, the same
+// key its SSH password is cached under.
+func passwordKey(target string) string {
+	user, host := util.ParseTarget(target)
+	if user == "" {
+		user = util.GetUser()
+	}
+	return fmt.Sprintf("%s@%s", user, host)
+}
+
+// groupRows prefixes rows with a host column that names target on the first
+// row of its group only.
+func groupRows(target string, rows [][]string) [][]string {
+	out := make([][]string, 0, len(rows))
+	for i, row := range rows {
+		host := ""
+		if i == 0 {
+			host = target
+		}
+		out = append(out, append([]string{host}, row...))
+	}
+	return out
+}
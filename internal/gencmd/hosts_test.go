@@ -0,0 +1,61 @@
+package gencmd
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"web", []string{"web"}},
+		{"web,db", []string{"web", "db"}},
+		{" web , root@db ,", []string{"web", "root@db"}},
+		{"web,db,web", []string{"web", "db"}},
+	}
+	for _, tt := range tests {
+		if got := ParseTargets(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseTargets(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	got := groupRows("web", [][]string{{"2", "a"}, {"1", "b"}})
+	want := [][]string{{"web", "2", "a"}, {"", "1", "b"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("row %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriteRecords_CSVHost(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	current := generation.Generation{ID: 2}
+	recs := listRecords([]generation.Generation{{ID: 2, BuildDate: date}}, current)
+	recs[0].Host = "web"
+
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, FormatCSV, nil, recs); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.HasPrefix(lines[0], "host,id,") {
+		t.Errorf("header = %q, want host column first", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "web,2,") {
+		t.Errorf("row = %q, want host first", lines[1])
+	}
+}
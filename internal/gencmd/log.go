@@ -0,0 +1,150 @@
+package gencmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"charm.land/lipgloss/v2"
+	"github.com/arnarg/nilla-utils/internal/diff"
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+var logHeaderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+
+// LogOptions configures the behaviour of Log.
+type LogOptions struct {
+	Limit   uint
+	From    *int
+	To      *int
+	Package string
+}
+
+// logEntry pairs a generation with the one it is compared against. prev is
+// nil for the oldest generation on the host.
+type logEntry struct {
+	gen  generation.Generation
+	prev *generation.Generation
+}
+
+// Log prints, newest first, what changed in each generation of sys compared
+// to the generation before it. When a package filter is set, generations that
+// did not touch a matching package are left out.
+func Log(ctx context.Context, sys generation.System, target string, opts LogOptions) error {
+	if opts.From != nil && opts.To != nil && *opts.From > *opts.To {
+		return fmt.Errorf("--from cannot be greater than --to")
+	}
+
+	h, err := exec.NewHost(ctx, target, nil)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	current, err := sys.Current(h)
+	if err != nil {
+		return err
+	}
+
+	generations, err := sys.List(h)
+	if err != nil {
+		return err
+	}
+
+	sortDesc(generations)
+
+	// Every generation is both the newer and the older side of a comparison.
+	querier := diff.NewMemoQuerier(diff.NewCachedQuerier(h, diff.DefaultCache()))
+	renderer := diff.NewTerminalRenderer()
+
+	shown := uint(0)
+	for _, e := range logEntries(generations, opts.From, opts.To) {
+		if opts.Limit > 0 && shown >= opts.Limit {
+			break
+		}
+
+		if e.prev == nil {
+			if opts.Package != "" {
+				continue
+			}
+			printLogHeader(os.Stdout, e.gen, current)
+			fmt.Fprintln(os.Stdout, "No previous generation to compare against.")
+			fmt.Fprintln(os.Stdout)
+			shown++
+			continue
+		}
+
+		report, err := diff.CalculateReport(ctx,
+			&diff.Generation{Path: e.prev.Path(), Querier: querier},
+			&diff.Generation{Path: e.gen.Path(), Querier: querier},
+		)
+		if err != nil {
+			return fmt.Errorf("diff of generation %d against %d: %w", e.gen.ID, e.prev.ID, err)
+		}
+
+		if opts.Package != "" {
+			report.Changes = filterChanges(report.Changes, opts.Package)
+			if len(report.Changes) == 0 {
+				continue
+			}
+		}
+
+		printLogHeader(os.Stdout, e.gen, current)
+		if err := renderer.Render(os.Stdout, report); err != nil {
+			return fmt.Errorf("render failed: %w", err)
+		}
+		fmt.Fprintln(os.Stdout)
+		shown++
+	}
+
+	return nil
+}
+
+// logEntries selects the generations within [from, to] from gens (sorted
+// newest first) and pairs each with its predecessor. The predecessor may lie
+// outside the range so the oldest selected generation is still compared.
+func logEntries(gens []generation.Generation, from, to *int) []logEntry {
+	var entries []logEntry
+	for i, g := range gens {
+		if from != nil && g.ID < *from {
+			continue
+		}
+		if to != nil && g.ID > *to {
+			continue
+		}
+		e := logEntry{gen: g}
+		if i+1 < len(gens) {
+			e.prev = &gens[i+1]
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// filterChanges keeps the changes whose package name contains pkg.
+func filterChanges(changes []diff.Change, pkg string) []diff.Change {
+	var out []diff.Change
+	for _, c := range changes {
+		if strings.Contains(string(c.Name), pkg) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func printLogHeader(w io.Writer, g, current generation.Generation) {
+	header := fmt.Sprintf("generation %d", g.ID)
+	if g.ID == current.ID {
+		header += " (current)"
+	}
+	fmt.Fprintln(w, logHeaderStyle.Render(header))
+	fmt.Fprintf(w, "Date:    %s\n", g.BuildDate.Format(time.DateTime))
+	if g.Version != "" {
+		fmt.Fprintf(w, "Version: %s\n", g.Version)
+	}
+	fmt.Fprintln(w)
+}
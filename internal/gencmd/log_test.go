@@ -0,0 +1,52 @@
+package gencmd
+
+import (
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/diff"
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+func TestLogEntries(t *testing.T) {
+	gens := []generation.Generation{{ID: 5}, {ID: 4}, {ID: 2}, {ID: 1}}
+	from, to := 2, 4
+
+	tests := []struct {
+		name     string
+		from, to *int
+		want     [][2]int // {gen, prev}; prev 0 means none
+	}{
+		{"all", nil, nil, [][2]int{{5, 4}, {4, 2}, {2, 1}, {1, 0}}},
+		{"range", &from, &to, [][2]int{{4, 2}, {2, 1}}},
+		{"from only", &to, nil, [][2]int{{5, 4}, {4, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := logEntries(gens, tt.from, tt.to)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, e := range entries {
+				prev := 0
+				if e.prev != nil {
+					prev = e.prev.ID
+				}
+				if e.gen.ID != tt.want[i][0] || prev != tt.want[i][1] {
+					t.Errorf("entry %d: got {%d, %d}, want %v", i, e.gen.ID, prev, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFilterChanges(t *testing.T) {
+	changes := []diff.Change{
+		{Name: "openssl", Type: diff.Changed},
+		{Name: "openssh", Type: diff.Changed},
+		{Name: "openssl-static", Type: diff.Added},
+	}
+	got := filterChanges(changes, "openssl")
+	if len(got) != 2 || got[0].Name != "openssl" || got[1].Name != "openssl-static" {
+		t.Errorf("got %v", got)
+	}
+}
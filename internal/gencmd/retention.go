@@ -0,0 +1,131 @@
+package gencmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+// Retention is a restic-style retention policy evaluated against the build
+// date of each generation. A generation is kept when any rule keeps it.
+type Retention struct {
+	OlderThan   time.Duration
+	KeepDaily   uint
+	KeepWeekly  uint
+	KeepMonthly uint
+}
+
+// IsSet reports whether any time- or calendar-based rule is configured.
+func (r Retention) IsSet() bool {
+	return r.OlderThan > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0 || r.KeepMonthly > 0
+}
+
+// ParseAge parses an age such as "30d", "2w" or "12h". Any value accepted by
+// time.ParseDuration works as well.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	units := map[byte]time.Duration{
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	if unit, ok := units[s[len(s)-1]]; ok {
+		n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+		if err == nil {
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (expected e.g. 30d, 2w or 12h)", s)
+	}
+	return d, nil
+}
+
+func formatAge(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d%(7*day) == 0:
+		return fmt.Sprintf("%dw", d/(7*day))
+	case d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+// bucketRule keeps the newest generation in each of the newest n distinct
+// calendar buckets.
+type bucketRule struct {
+	name   string
+	n      uint
+	bucket func(t time.Time) int
+}
+
+// buildPlanRetention evaluates keep (newest N), r, pins and the current
+// generation against gens, which must be sorted newest first. Every kept
+// generation records the rules that kept it.
+func buildPlanRetention(gens []generation.Generation, current generation.Generation, keep uint, r Retention, now time.Time) []action {
+	rules := []*bucketRule{
+		{name: "daily", n: r.KeepDaily, bucket: func(t time.Time) int {
+			return t.Year()*1000 + t.YearDay()
+		}},
+		{name: "weekly", n: r.KeepWeekly, bucket: func(t time.Time) int {
+			y, w := t.ISOWeek()
+			return y*100 + w
+		}},
+		{name: "monthly", n: r.KeepMonthly, bucket: func(t time.Time) int {
+			return t.Year()*100 + int(t.Month())
+		}},
+	}
+	last := make([]int, len(rules))
+	for i := range last {
+		last[i] = -1
+	}
+
+	// Pinned generations other than the current one do not count toward
+	// keep, like in buildPlan
+	var newest uint
+
+	actions := make([]action, 0, len(gens))
+	for _, g := range gens {
+		var reasons []string
+
+		if g.ID == current.ID {
+			reasons = append(reasons, "current")
+		}
+		if g.Pinned {
+			reasons = append(reasons, "pinned")
+		}
+		if !g.Pinned || g.ID == current.ID {
+			if newest < keep {
+				reasons = append(reasons, "last")
+			}
+			newest++
+		}
+		if r.OlderThan > 0 && now.Sub(g.BuildDate) < r.OlderThan {
+			reasons = append(reasons, "within "+formatAge(r.OlderThan))
+		}
+		for j, rule := range rules {
+			if rule.n == 0 {
+				continue
+			}
+			b := rule.bucket(g.BuildDate)
+			if b == last[j] {
+				continue
+			}
+			last[j] = b
+			rule.n--
+			reasons = append(reasons, rule.name)
+		}
+
+		actions = append(actions, action{gen: g, keep: len(reasons) > 0, reasons: reasons})
+	}
+	return actions
+}
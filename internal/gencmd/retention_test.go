@@ -0,0 +1,106 @@
+package gencmd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/generation"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"-3h", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAge(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuildPlanRetention(t *testing.T) {
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return now.AddDate(0, 0, -d) }
+
+	// Newest first: two generations on the same day, then spread over months.
+	g := []generation.Generation{
+		{ID: 9, BuildDate: day(0)},
+		{ID: 8, BuildDate: day(0).Add(-time.Hour)},
+		{ID: 7, BuildDate: day(1)},
+		{ID: 6, BuildDate: day(9)},
+		{ID: 5, BuildDate: day(40)},
+		{ID: 4, BuildDate: day(45)},
+		{ID: 3, BuildDate: day(70)},
+		{ID: 2, BuildDate: day(100)},
+		{ID: 1, BuildDate: day(200)},
+	}
+
+	tests := []struct {
+		name    string
+		current int
+		keep    uint
+		r       Retention
+		pinned  []int
+		want    []int
+	}{
+		{"daily", 9, 0, Retention{KeepDaily: 2}, nil, []int{9, 7}},
+		{"weekly", 9, 0, Retention{KeepWeekly: 2}, nil, []int{9, 6}},
+		{"monthly", 9, 0, Retention{KeepMonthly: 3}, nil, []int{9, 5, 3}},
+		{"older than", 9, 0, Retention{OlderThan: 10 * 24 * time.Hour}, nil, []int{9, 8, 7, 6}},
+		{"combined with keep", 9, 3, Retention{KeepMonthly: 2}, nil, []int{9, 8, 7, 5}},
+		{"current always kept", 2, 0, Retention{KeepDaily: 1}, nil, []int{9, 2}},
+		{"pinned not counted toward keep", 9, 2, Retention{}, []int{8, 3}, []int{9, 8, 7, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gens := slices.Clone(g)
+			for i := range gens {
+				gens[i].Pinned = slices.Contains(tt.pinned, gens[i].ID)
+			}
+
+			actions := buildPlanRetention(gens, generation.Generation{ID: tt.current}, tt.keep, tt.r, now)
+			if k := keptIDs(actions); !slices.Equal(k, tt.want) {
+				t.Errorf("kept: got %v want %v", k, tt.want)
+			}
+			for _, a := range actions {
+				if a.keep != (len(a.reasons) > 0) {
+					t.Errorf("generation %d: keep=%v with reasons %v", a.gen.ID, a.keep, a.reasons)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlanRetention_Reasons(t *testing.T) {
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	g := []generation.Generation{{ID: 2, BuildDate: now}, {ID: 1, BuildDate: now.AddDate(0, -1, 0)}}
+
+	actions := buildPlanRetention(g, generation.Generation{ID: 2}, 1, Retention{
+		OlderThan:   7 * 24 * time.Hour,
+		KeepMonthly: 2,
+	}, now)
+
+	if want := []string{"current", "last", "within 1w", "monthly"}; !slices.Equal(actions[0].reasons, want) {
+		t.Errorf("reasons: got %v want %v", actions[0].reasons, want)
+	}
+	if want := []string{"monthly"}; !slices.Equal(actions[1].reasons, want) {
+		t.Errorf("reasons: got %v want %v", actions[1].reasons, want)
+	}
+}
@@ -0,0 +1,100 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+)
+
+// Bootloader is implemented by systems whose generations are listed in a boot
+// menu. The menu has to be regenerated after generations are deleted, and its
+// default can differ from the running generation.
+type Bootloader interface {
+	// BootEntries returns the boot menu entries currently installed on h.
+	BootEntries(h exec.Host) ([]string, error)
+	// UpdateBootloader reinstalls the boot menu from the current generation.
+	UpdateBootloader(ctx context.Context, h exec.Host) error
+	// SetBootDefault makes gen the generation booted by default without
+	// activating it.
+	SetBootDefault(ctx context.Context, h exec.Host, gen Generation) error
+}
+
+var (
+	// systemd-boot entries live on the ESP, which NixOS mounts at /boot by
+	// default and at /efi when boot.loader.efi.efiSysMountPoint says so.
+	systemdBootEntryDirs = []string{"/boot/loader/entries", "/efi/loader/entries"}
+	grubConfigPath       = "/boot/grub/grub.cfg"
+
+	grubMenuEntryRe = regexp.MustCompile(`(?m)^\s*menuentry\s+"([^"]+)"`)
+)
+
+// BootEntries lists systemd-boot entries or, failing that, GRUB menu entries.
+// The ESP is commonly only readable by root, so remote hosts are inspected
+// under sudo.
+func (NixOSSystem) BootEntries(h exec.Host) ([]string, error) {
+	for _, dir := range systemdBootEntryDirs {
+		out, err := runBootOutput(h, "ls", "-1", dir)
+		if err != nil {
+			continue
+		}
+		var entries []string
+		for _, name := range strings.Fields(out) {
+			if strings.HasSuffix(name, ".conf") {
+				entries = append(entries, strings.TrimSuffix(name, ".conf"))
+			}
+		}
+		return entries, nil
+	}
+
+	out, err := runBootOutput(h, "cat", grubConfigPath)
+	if err != nil {
+		return nil, errors.New("no systemd-boot entries or GRUB configuration found")
+	}
+	return parseGrubEntries(out), nil
+}
+
+// UpdateBootloader runs switch-to-configuration boot of the current
+// generation, which rewrites the boot menu from the remaining profile links.
+func (s NixOSSystem) UpdateBootloader(ctx context.Context, h exec.Host) error {
+	current, err := s.Current(h)
+	if err != nil {
+		return err
+	}
+	switchp := filepath.Join(current.path, "bin", "switch-to-configuration")
+	if h.IsLocal() {
+		return runCmd(ctx, h, switchp, "boot")
+	}
+	return runCmd(ctx, h, "sudo", switchp, "boot")
+}
+
+// SetBootDefault switches the system profile to gen and runs its
+// switch-to-configuration boot, leaving the running system untouched.
+func (NixOSSystem) SetBootDefault(ctx context.Context, h exec.Host, gen Generation) error {
+	sudo := !h.IsLocal()
+	if err := runMaybeSudo(ctx, h, sudo, "nix-env", "-p", nixosCurrentLink,
+		"--switch-generation", strconv.Itoa(gen.ID)); err != nil {
+		return err
+	}
+	switchp := filepath.Join(gen.path, "bin", "switch-to-configuration")
+	return runMaybeSudo(ctx, h, sudo, switchp, "boot")
+}
+
+func parseGrubEntries(cfg string) []string {
+	var entries []string
+	for _, m := range grubMenuEntryRe.FindAllStringSubmatch(cfg, -1) {
+		entries = append(entries, m[1])
+	}
+	return entries
+}
+
+func runBootOutput(h exec.Host, name string, args ...string) (string, error) {
+	if h.IsLocal() {
+		return runOutput(h, name, args...)
+	}
+	return runOutput(h, "sudo", append([]string{name}, args...)...)
+}
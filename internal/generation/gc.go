@@ -0,0 +1,152 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/util"
+)
+
+// GCStats is the summary printed by nix store gc.
+type GCStats struct {
+	Paths int
+	Freed int64
+}
+
+// Reclaim is an estimate of what garbage collection frees once a set of
+// generations is deleted.
+type Reclaim struct {
+	Paths int
+	Bytes int64
+}
+
+var gcSummaryRe = regexp.MustCompile(`(\d+) store paths deleted, ([\d.]+) ([KMGT]?i?B) freed`)
+
+// parseGCStats extracts the summary line from nix store gc output. It returns
+// nil when the output has none, e.g. when gc was interrupted.
+func parseGCStats(out string) *GCStats {
+	m := gcSummaryRe.FindAllStringSubmatch(out, -1)
+	if m == nil {
+		return nil
+	}
+	last := m[len(m)-1]
+
+	paths, err := strconv.Atoi(last[1])
+	if err != nil {
+		return nil
+	}
+	size, err := strconv.ParseFloat(last[2], 64)
+	if err != nil {
+		return nil
+	}
+	units := map[string]float64{
+		util.BytesUnitBytes: 1,
+		util.BytesUnitKiB:   util.KiB,
+		util.BytesUnitMiB:   util.MiB,
+		util.BytesUnitGiB:   util.GiB,
+		util.BytesUnitTiB:   util.TiB,
+	}
+	mult, ok := units[last[3]]
+	if !ok {
+		return nil
+	}
+	return &GCStats{Paths: paths, Freed: int64(size * mult)}
+}
+
+// tailBuffer is an io.Writer that only retains the last max bytes written.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+// PathSizer returns the NAR size of every store path in the closure of a
+// path, as diff.StoreQuerier does.
+type PathSizer interface {
+	GetPathSizes(ctx context.Context, path string) (map[string]int64, error)
+}
+
+// EstimateReclaim computes the store paths that become garbage when gens are
+// deleted: their closure minus everything reachable from the remaining GC
+// roots, summed by NAR size. The links of gens are still in place, so the
+// roots they contribute are left out explicitly. The roots are listed with
+// the same privileges sys collects garbage with, as Nix hides the roots of
+// other users from unprivileged callers.
+func EstimateReclaim(ctx context.Context, sys System, h exec.Host, sizes PathSizer, gens []Generation) (Reclaim, error) {
+	if len(gens) == 0 {
+		return Reclaim{}, nil
+	}
+
+	deleted := map[string]bool{}
+	for _, g := range gens {
+		deleted[g.path] = true
+	}
+
+	name, args := "nix-store", []string{"--gc", "--print-roots"}
+	if sys.GCPrivileged(h) {
+		name, args = "sudo", append([]string{name}, args...)
+	}
+	out, err := runOutput(h, name, args...)
+	if err != nil {
+		return Reclaim{}, fmt.Errorf("list gc roots: %w", err)
+	}
+	roots := parseGCRoots(out, deleted)
+
+	live := map[string]bool{}
+	if len(roots) > 0 {
+		out, err := runOutput(h, "nix-store", append([]string{"--query", "--requisites"}, roots...)...)
+		if err != nil {
+			return Reclaim{}, fmt.Errorf("query live closure: %w", err)
+		}
+		for _, p := range strings.Fields(out) {
+			live[p] = true
+		}
+	}
+
+	doomed := map[string]int64{}
+	for _, g := range gens {
+		s, err := sizes.GetPathSizes(ctx, g.path)
+		if err != nil {
+			return Reclaim{}, fmt.Errorf("query closure of generation %d: %w", g.ID, err)
+		}
+		maps.Copy(doomed, s)
+	}
+
+	var r Reclaim
+	for p, size := range doomed {
+		if live[p] {
+			continue
+		}
+		r.Paths++
+		r.Bytes += size
+	}
+	return r, nil
+}
+
+// parseGCRoots parses nix-store --gc --print-roots output ("<link> -> <path>")
+// into the distinct store paths held by links not in exclude.
+func parseGCRoots(out string, exclude map[string]bool) []string {
+	seen := map[string]bool{}
+	var roots []string
+	for _, line := range strings.Split(out, "\n") {
+		link, path, ok := strings.Cut(strings.TrimSpace(line), " -> ")
+		if !ok || exclude[link] || seen[path] {
+			continue
+		}
+		seen[path] = true
+		roots = append(roots, path)
+	}
+	return roots
+}
@@ -0,0 +1,142 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/util"
+	"github.com/go-test/deep"
+)
+
+func TestParseGCStats(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *GCStats
+	}{
+		{
+			name: "mebibytes",
+			in:   "deleting '/nix/store/abc-foo'\n2 store paths deleted, 12.50 MiB freed\n",
+			want: &GCStats{Paths: 2, Freed: int64(12.5 * util.MiB)},
+		},
+		{
+			name: "gibibytes",
+			in:   "1234 store paths deleted, 1.00 GiB freed",
+			want: &GCStats{Paths: 1234, Freed: util.GiB},
+		},
+		{
+			name: "nothing freed",
+			in:   "0 store paths deleted, 0.0 B freed",
+			want: &GCStats{Paths: 0, Freed: 0},
+		},
+		{
+			name: "no summary",
+			in:   "error: interrupted by the user",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(parseGCStats(tt.in), tt.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseGCRoots(t *testing.T) {
+	out := `/nix/var/nix/profiles/system-1-link -> /nix/store/aaa-nixos-system
+/nix/var/nix/profiles/system-2-link -> /nix/store/bbb-nixos-system
+/nix/var/nix/profiles/system -> /nix/store/bbb-nixos-system
+/proc/1234/maps -> /nix/store/ccc-glibc
+{censored} -> /nix/store/ddd-hello
+`
+	got := parseGCRoots(out, map[string]bool{"/nix/var/nix/profiles/system-1-link": true})
+	want := []string{"/nix/store/bbb-nixos-system", "/nix/store/ccc-glibc", "/nix/store/ddd-hello"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// fakeSizer answers GetPathSizes from a map keyed by path.
+type fakeSizer map[string]map[string]int64
+
+func (f fakeSizer) GetPathSizes(_ context.Context, path string) (map[string]int64, error) {
+	sizes, ok := f[path]
+	if !ok {
+		return nil, fmt.Errorf("unexpected path %s", path)
+	}
+	return sizes, nil
+}
+
+func TestEstimateReclaim(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	sizes := fakeSizer{
+		"/nix/var/nix/profiles/system-1-link": {
+			"/nix/store/sys1":       100,
+			"/nix/store/old-kernel": 1000,
+			"/nix/store/glibc":      5000,
+		},
+	}
+
+	tests := []struct {
+		name  string
+		local bool
+		roots string
+	}{
+		{"local", true, "nix-store --gc --print-roots"},
+		{"remote lists roots under sudo", false, "sudo nix-store --gc --print-roots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newFakeHost(tt.local)
+			h.addNixOSGen(1, "23.11", "6.1.0", t0)
+			h.addNixOSGen(2, "24.05", "6.6.0", t0)
+
+			gens, err := NixOSSystem{}.List(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h.outputs[tt.roots] = "/nix/var/nix/profiles/system-1-link -> /nix/store/sys1\n" +
+				"/nix/var/nix/profiles/system-2-link -> /nix/store/sys2\n"
+			h.outputs["nix-store --query --requisites /nix/store/sys2"] = "/nix/store/sys2\n/nix/store/glibc\n"
+
+			r, err := EstimateReclaim(context.Background(), NixOSSystem{}, h, sizes, gens[:1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Paths != 2 || r.Bytes != 1100 {
+				t.Errorf("got %+v, want 2 paths and 1100 bytes", r)
+			}
+			if !slices.Contains(h.ranCmds, tt.roots) {
+				t.Errorf("expected %q to run, ran %v", tt.roots, h.ranCmds)
+			}
+		})
+	}
+}
+
+func TestCollectGarbage_ReportsFreed(t *testing.T) {
+	h := newFakeHost(true)
+	h.outputs["nix store gc -v"] = "deleting '/nix/store/abc-foo'\n3 store paths deleted, 2.00 KiB freed\n"
+
+	stats, err := HomeSystem{}.CollectGarbage(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(stats, &GCStats{Paths: 3, Freed: 2 * util.KiB}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tb := &tailBuffer{max: 4}
+	tb.Write([]byte("abc"))
+	tb.Write([]byte("defg"))
+	if got := string(tb.buf); got != "defg" {
+		t.Errorf("got %q want %q", got, "defg")
+	}
+}
@@ -9,26 +9,52 @@ import (
 
 // Generation is the common representation of a NixOS or Home Manager generation.
 // KernelVersion is only populated for NixOS generations.
+//
+// Pinned generations are protected from cleanup; see System.Pin. Active (the
+// running generation) and Booted (the generation the machine booted into) are
+// only tracked by systems that can tell, and may differ from Current, which
+// is the profile's default.
+//
+// The remaining metadata is comparatively expensive to collect and is only
+// populated on request by System.Describe. ClosureSize is filled in by
+// callers that query the store for it.
 type Generation struct {
 	ID            int
 	BuildDate     time.Time
 	Version       string
 	KernelVersion string
+	Pinned        bool
+	Active        bool
+	Booted        bool
+
+	ConfigurationRevision string
+	Label                 string
+	NixpkgsRevision       string
+	ClosureSize           int64
+	Specialisations       []string
 
 	path string
+	// storePath is the resolved target of the profile link.
+	storePath string
 }
 
 // Path returns the filesystem path of the generation profile link.
 func (g Generation) Path() string { return g.path }
 
-// System abstracts the differences between NixOS and Home Manager generations so
-// that listing, deletion and garbage collection can be driven generically.
+// System abstracts the differences between NixOS, Home Manager and plain
+// profile generations so that listing, deletion and garbage collection can be
+// driven generically.
 type System interface {
 	Current(h exec.Host) (Generation, error)
 	List(h exec.Host) ([]Generation, error)
+	Describe(ctx context.Context, h exec.Host, g *Generation) error
 	DeleteGenerations(h exec.Host, gens []Generation) error
 	Rollback(ctx context.Context, h exec.Host, gen Generation) error
-	CollectGarbage(ctx context.Context, h exec.Host) error
+	Pin(ctx context.Context, h exec.Host, gen Generation) error
+	Unpin(ctx context.Context, h exec.Host, gen Generation) error
+	CollectGarbage(ctx context.Context, h exec.Host) (*GCStats, error)
+	// GCPrivileged reports whether garbage collection on h runs under sudo.
+	GCPrivileged(h exec.Host) bool
 	Headers() []string
 	Row(g Generation) []string
 	RequiresLocalRoot() bool
@@ -37,6 +37,7 @@ type fakeHost struct {
 	user    string
 	homeDir string
 	entries map[string]fakeEntry
+	outputs map[string]string
 
 	removed []string
 	ranCmds []string
@@ -48,6 +49,7 @@ func newFakeHost(local bool) *fakeHost {
 		user:    "alice",
 		homeDir: "/home/alice",
 		entries: map[string]fakeEntry{},
+		outputs: map[string]string{},
 	}
 }
 
@@ -147,6 +149,10 @@ func (c *fakeCommand) Run() error {
 			c.stdout.Write([]byte(s))
 		}
 	}
+	if out, ok := c.host.outputs[strings.Join(append([]string{c.name}, c.args...), " ")]; ok {
+		write(out)
+		return nil
+	}
 	switch c.name {
 	case "readlink":
 		t, err := c.host.Readlink(c.args[0])
@@ -170,7 +176,22 @@ func (c *fakeCommand) Run() error {
 			c.host.Remove(p)
 		}
 		return nil
+	case "ln":
+		// ln -sfn <target> <link>
+		n := len(c.args)
+		c.host.entries[c.args[n-1]] = fakeEntry{kind: kSymlink, target: c.args[n-2]}
+		return nil
+	case "nix-store":
+		// nix-store --realise <target> --add-root <link> --indirect
+		if i := slices.Index(c.args, "--add-root"); i > 0 {
+			c.host.entries[c.args[i+1]] = fakeEntry{kind: kSymlink, target: c.args[i-1]}
+		}
+		return nil
 	case "sudo":
+		if len(c.args) >= 1 && (c.args[0] == "ln" || c.args[0] == "nix-store") {
+			sub := &fakeCommand{host: c.host, name: c.args[0], args: c.args[1:]}
+			return sub.Run()
+		}
 		if len(c.args) >= 1 && c.args[0] == "rm" {
 			for _, p := range c.args[1:] {
 				c.host.Remove(p)
@@ -349,7 +370,7 @@ func TestNixOSSystem_DeleteGenerations_RemoteBatched(t *testing.T) {
 func TestNixOSSystem_CollectGarbage(t *testing.T) {
 	t.Run("local", func(t *testing.T) {
 		h := newFakeHost(true)
-		if err := (NixOSSystem{}).CollectGarbage(context.Background(), h); err != nil {
+		if _, err := (NixOSSystem{}).CollectGarbage(context.Background(), h); err != nil {
 			t.Fatalf("CollectGarbage: %v", err)
 		}
 		if !slices.Contains(h.ranCmds, "nix store gc -v") {
@@ -358,7 +379,7 @@ func TestNixOSSystem_CollectGarbage(t *testing.T) {
 	})
 	t.Run("remote", func(t *testing.T) {
 		h := newFakeHost(false)
-		if err := (NixOSSystem{}).CollectGarbage(context.Background(), h); err != nil {
+		if _, err := (NixOSSystem{}).CollectGarbage(context.Background(), h); err != nil {
 			t.Fatalf("CollectGarbage: %v", err)
 		}
 		if !slices.Contains(h.ranCmds, "sudo nix store gc -v") {
@@ -448,3 +469,401 @@ func TestHomeSystem_HeadersAndRow(t *testing.T) {
 		t.Error("Home should not require local root")
 	}
 }
+
+func TestNixOSSystem_Describe(t *testing.T) {
+	h := newFakeHost(false)
+	mtime := time.Unix(1700000000, 0)
+	h.addNixOSGen(1, "24.05", "6.6.0", mtime)
+	base := nixosProfilesDir + "/system-1-link"
+	h.entries[base+"/boot.json"] = fakeEntry{kind: kFile, content: `{
+		"org.nixos.bootspec.v1": {"label": "NixOS 24.05 (Linux 6.6.0)"},
+		"org.nixos.specialisation.v1": {"work": {}, "gaming": {}}
+	}`}
+	h.outputs[base+"/sw/bin/nixos-version --json"] = `{"nixosVersion":"24.05","nixpkgsRevision":"abc123","configurationRevision":"deadbeef"}`
+
+	gens, err := NixOSSystem{}.List(h)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	g := gens[0]
+	if err := (NixOSSystem{}).Describe(context.Background(), h, &g); err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if g.Label != "NixOS 24.05 (Linux 6.6.0)" {
+		t.Errorf("label: got %q", g.Label)
+	}
+	if !slices.Equal(g.Specialisations, []string{"gaming", "work"}) {
+		t.Errorf("specialisations: got %v", g.Specialisations)
+	}
+	if g.NixpkgsRevision != "abc123" {
+		t.Errorf("nixpkgs revision: got %q", g.NixpkgsRevision)
+	}
+	if g.ConfigurationRevision != "deadbeef" {
+		t.Errorf("configuration revision: got %q", g.ConfigurationRevision)
+	}
+}
+
+func TestNixOSSystem_Describe_Fallbacks(t *testing.T) {
+	// Without boot.json the specialisation directory is listed, and a
+	// configuration-revision file takes precedence over nixos-version.
+	h := newFakeHost(true)
+	mtime := time.Unix(1700000000, 0)
+	h.addNixOSGen(1, "24.05", "6.6.0", mtime)
+	base := nixosProfilesDir + "/system-1-link"
+	h.entries[base+"/specialisation/work"] = fakeEntry{kind: kSymlink, mtime: mtime}
+	h.entries[base+"/configuration-revision"] = fakeEntry{kind: kFile, content: "cafe\n"}
+	h.outputs[base+"/sw/bin/nixos-version --json"] = `{"nixpkgsRevision":"abc123","configurationRevision":"deadbeef"}`
+
+	gens, _ := NixOSSystem{}.List(h)
+	g := gens[0]
+	if err := (NixOSSystem{}).Describe(context.Background(), h, &g); err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if g.Label != "" {
+		t.Errorf("label: got %q want empty", g.Label)
+	}
+	if !slices.Equal(g.Specialisations, []string{"work"}) {
+		t.Errorf("specialisations: got %v", g.Specialisations)
+	}
+	if g.ConfigurationRevision != "cafe" {
+		t.Errorf("configuration revision: got %q want cafe", g.ConfigurationRevision)
+	}
+}
+
+func TestNixOSSystem_Describe_EmptyBootspecSpecialisations(t *testing.T) {
+	// A boot.json without specialisations still falls back to the directory.
+	h := newFakeHost(true)
+	mtime := time.Unix(1700000000, 0)
+	h.addNixOSGen(1, "24.05", "6.6.0", mtime)
+	base := nixosProfilesDir + "/system-1-link"
+	h.entries[base+"/boot.json"] = fakeEntry{kind: kFile, content: `{
+		"org.nixos.bootspec.v1": {"label": "NixOS 24.05 (Linux 6.6.0)"}
+	}`}
+	h.entries[base+"/specialisation/work"] = fakeEntry{kind: kSymlink, mtime: mtime}
+
+	gens, _ := NixOSSystem{}.List(h)
+	g := gens[0]
+	if err := (NixOSSystem{}).Describe(context.Background(), h, &g); err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if !slices.Equal(g.Specialisations, []string{"work"}) {
+		t.Errorf("specialisations: got %v", g.Specialisations)
+	}
+}
+
+func TestHomeSystem_Describe(t *testing.T) {
+	h := newFakeHost(true)
+	dir := localHomeDir()
+	mtime := time.Unix(1700000000, 0)
+	h.addHomeGen(dir, 1, "24.05", mtime, true)
+
+	gens, _ := HomeSystem{}.List(h)
+	g := gens[0]
+	if err := (HomeSystem{}).Describe(context.Background(), h, &g); err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if g.Specialisations == nil || len(g.Specialisations) != 0 {
+		t.Errorf("expected empty specialisations, got %v", g.Specialisations)
+	}
+}
+
+func TestNixOSSystem_PinAndUnpin(t *testing.T) {
+	h := newFakeHost(true)
+	t0 := time.Unix(1700000000, 0)
+	h.addNixOSGen(1, "23.05", "6.1.0", t0)
+	h.addNixOSGen(2, "23.11", "6.6.0", t0)
+	h.setNixOSCurrent(2, t0)
+
+	gens, err := NixOSSystem{}.List(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (NixOSSystem{}).Pin(context.Background(), h, gens[0]); err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+
+	pin := nixosProfilesDir + "/system-1-pin"
+	if e, ok := h.entries[pin]; !ok || e.target != "/nix/store/sys1" {
+		t.Fatalf("pin link: got %+v", e)
+	}
+
+	gens, err = NixOSSystem{}.List(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gens) != 2 {
+		t.Fatalf("pin link listed as a generation: %v", gens)
+	}
+	for _, g := range gens {
+		if g.Pinned != (g.ID == 1) {
+			t.Errorf("generation %d: pinned = %v", g.ID, g.Pinned)
+		}
+	}
+
+	if err := (NixOSSystem{}).Unpin(context.Background(), h, gens[0]); err != nil {
+		t.Fatalf("Unpin: %v", err)
+	}
+	if _, ok := h.entries[pin]; ok {
+		t.Error("pin link still present after Unpin")
+	}
+}
+
+func TestNixOSSystem_PinRemoteUsesSudo(t *testing.T) {
+	h := newFakeHost(false)
+	t0 := time.Unix(1700000000, 0)
+	h.addNixOSGen(3, "23.11", "6.6.0", t0)
+	h.setNixOSCurrent(3, t0)
+
+	cur, err := NixOSSystem{}.Current(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (NixOSSystem{}).Pin(context.Background(), h, cur); err != nil {
+		t.Fatal(err)
+	}
+	if err := (NixOSSystem{}).Unpin(context.Background(), h, cur); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"sudo nix-store --realise /nix/store/sys3 --add-root /nix/var/nix/profiles/system-3-pin --indirect",
+		"sudo rm -f /nix/var/nix/profiles/system-3-pin",
+	}
+	if !slices.Equal(h.ranCmds, want) {
+		t.Errorf("commands: got %v want %v", h.ranCmds, want)
+	}
+}
+
+func TestHomeSystem_PinnedCurrent(t *testing.T) {
+	h := newFakeHost(true)
+	dir := localHomeDir()
+	t0 := time.Unix(1700000000, 0)
+	h.addHomeGen(dir, 4, "24.05", t0, true)
+
+	cur, err := HomeSystem{}.Current(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.Pinned {
+		t.Fatal("current unexpectedly pinned")
+	}
+	if err := (HomeSystem{}).Pin(context.Background(), h, cur); err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err = HomeSystem{}.Current(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cur.Pinned {
+		t.Error("current not reported as pinned")
+	}
+}
+
+func TestParseGrubEntries(t *testing.T) {
+	cfg := `menuentry "NixOS - Default" --class nixos --unrestricted {
+  linux /kernels/a
+}
+submenu "NixOS - All configurations" --class submenu {
+  menuentry "NixOS - Configuration 42 (2024-05-01 - 24.05)" --class nixos --unrestricted {
+  }
+  menuentry "NixOS - Configuration 41 (2024-04-20 - 24.05)" --class nixos --unrestricted {
+  }
+}
+`
+	want := []string{
+		"NixOS - Default",
+		"NixOS - Configuration 42 (2024-05-01 - 24.05)",
+		"NixOS - Configuration 41 (2024-04-20 - 24.05)",
+	}
+	if got := parseGrubEntries(cfg); !slices.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestNixOSSystem_Bootloader(t *testing.T) {
+	var _ Bootloader = NixOSSystem{}
+
+	h := newFakeHost(false)
+	t0 := time.Unix(1700000000, 0)
+	h.addNixOSGen(7, "24.05", "6.6.0", t0)
+	h.setNixOSCurrent(7, t0)
+	h.outputs["sudo ls -1 /boot/loader/entries"] = "nixos-generation-6.conf\nnixos-generation-7.conf\n"
+
+	entries, err := NixOSSystem{}.BootEntries(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nixos-generation-6", "nixos-generation-7"}; !slices.Equal(entries, want) {
+		t.Errorf("entries: got %v want %v", entries, want)
+	}
+
+	if err := (NixOSSystem{}).UpdateBootloader(context.Background(), h); err != nil {
+		t.Fatal(err)
+	}
+	want := "sudo /nix/var/nix/profiles/system-7-link/bin/switch-to-configuration boot"
+	if last := h.ranCmds[len(h.ranCmds)-1]; last != want {
+		t.Errorf("last command: got %q want %q", last, want)
+	}
+}
+
+func TestProfileSystem_ListAndCurrent(t *testing.T) {
+	h := newFakeHost(false)
+	dir := h.homeDir + "/.local/state/nix/profiles"
+	t0 := time.Unix(1700000000, 0)
+	for _, id := range []int{1, 2} {
+		link := fmt.Sprintf("%s/profile-%d-link", dir, id)
+		h.entries[link] = fakeEntry{kind: kSymlink, target: fmt.Sprintf("/nix/store/profile%d", id), mtime: t0}
+	}
+	h.entries[dir+"/profile"] = fakeEntry{kind: kSymlink, target: "profile-2-link", mtime: t0}
+	// Generations of another profile in the same directory are ignored.
+	h.addHomeGen(dir, 7, "24.05", t0, false)
+
+	sys := ProfileSystem{Path: "~/.local/state/nix/profiles/profile"}
+
+	gens, err := sys.List(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gens) != 2 {
+		t.Fatalf("expected 2 generations, got %d", len(gens))
+	}
+	if row := sys.Row(gens[0]); row[2] != "/nix/store/profile1" {
+		t.Errorf("row: got %v", row)
+	}
+
+	cur, err := sys.Current(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.ID != 2 {
+		t.Errorf("current: got %d want 2", cur.ID)
+	}
+
+	if err := sys.Rollback(context.Background(), h, gens[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := "nix-env -p " + dir + "/profile --switch-generation 1"
+	if !slices.Contains(h.ranCmds, want) {
+		t.Errorf("expected %q, got %v", want, h.ranCmds)
+	}
+}
+
+func (h *fakeHost) addMicroVMGen(name string, id int, mtime time.Time) {
+	link := fmt.Sprintf("%s/%s-%d-link", microvmProfilesDir, name, id)
+	h.entries[link] = fakeEntry{kind: kSymlink, target: fmt.Sprintf("/nix/store/runner%d", id), mtime: mtime}
+	h.entries[microvmProfilesDir+"/"+name] = fakeEntry{kind: kSymlink, target: fmt.Sprintf("%s-%d-link", name, id), mtime: mtime}
+}
+
+func TestMicroVMSystem_CurrentAndBooted(t *testing.T) {
+	h := newFakeHost(true)
+	t0 := time.Unix(1700000000, 0)
+	h.addMicroVMGen("web", 1, t0)
+	h.addMicroVMGen("web", 2, t0)
+	h.addMicroVMGen("web", 3, t0)
+	h.entries[microvmStateDir+"/web/current"] = fakeEntry{kind: kSymlink, target: "/nix/store/runner3"}
+	h.entries[microvmStateDir+"/web/booted"] = fakeEntry{kind: kSymlink, target: "/nix/store/runner2"}
+
+	sys := MicroVMSystem{Name: "web"}
+	gens, err := sys.List(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range gens {
+		if g.Booted != (g.ID == 2) {
+			t.Errorf("generation %d: booted = %v", g.ID, g.Booted)
+		}
+	}
+
+	cur, err := sys.Current(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.ID != 3 {
+		t.Errorf("current: got %d want 3", cur.ID)
+	}
+}
+
+func TestMicroVMSystem_RollbackWithRestart(t *testing.T) {
+	h := newFakeHost(true)
+	t0 := time.Unix(1700000000, 0)
+	h.addMicroVMGen("web", 1, t0)
+	h.addMicroVMGen("web", 2, t0)
+
+	sys := MicroVMSystem{Name: "web", Restart: true}
+	gens, err := sys.profile().List(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sys.Rollback(context.Background(), h, gens[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"nix-env -p /nix/var/nix/profiles/microvm/web --switch-generation 1",
+		"ln -sfn /nix/store/runner1 /var/lib/microvms/web/current",
+		"systemctl restart microvm@web.service",
+	}
+	if !slices.Equal(h.ranCmds, want) {
+		t.Errorf("commands: got %v want %v", h.ranCmds, want)
+	}
+}
+
+func TestRecordMicroVMRunner(t *testing.T) {
+	h := newFakeHost(false)
+	t0 := time.Unix(1700000000, 0)
+	h.addMicroVMGen("web", 1, t0)
+	h.entries[microvmStateDir+"/web/current"] = fakeEntry{kind: kSymlink, target: "/nix/store/runner1"}
+
+	// Already recorded.
+	if err := RecordMicroVMRunner(context.Background(), h, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.ranCmds) != 0 {
+		t.Fatalf("expected no commands, got %v", h.ranCmds)
+	}
+
+	h.entries[microvmStateDir+"/web/current"] = fakeEntry{kind: kSymlink, target: "/nix/store/runner2"}
+	if err := RecordMicroVMRunner(context.Background(), h, "web"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sudo mkdir -p /nix/var/nix/profiles/microvm",
+		"sudo nix-env -p /nix/var/nix/profiles/microvm/web --set /nix/store/runner2",
+	}
+	if !slices.Equal(h.ranCmds, want) {
+		t.Errorf("commands: got %v want %v", h.ranCmds, want)
+	}
+}
+
+func TestNixOSSystem_ActiveAndBooted(t *testing.T) {
+	h := newFakeHost(false)
+	t0 := time.Unix(1700000000, 0)
+	h.addNixOSGen(1, "23.11", "6.1.0", t0)
+	h.addNixOSGen(2, "24.05", "6.6.0", t0)
+	h.addNixOSGen(3, "24.05", "6.6.1", t0)
+	h.setNixOSCurrent(3, t0)
+	h.entries[nixosActiveLink] = fakeEntry{kind: kSymlink, target: "/nix/store/sys2"}
+	h.entries[nixosBootedLink] = fakeEntry{kind: kSymlink, target: "/nix/store/sys1"}
+
+	gens, err := NixOSSystem{}.List(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range gens {
+		if g.Active != (g.ID == 2) || g.Booted != (g.ID == 1) {
+			t.Errorf("generation %d: active=%v booted=%v", g.ID, g.Active, g.Booted)
+		}
+	}
+
+	if err := (NixOSSystem{}).SetBootDefault(context.Background(), h, gens[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sudo nix-env -p /nix/var/nix/profiles/system --switch-generation 1",
+		"sudo /nix/var/nix/profiles/system-1-link/bin/switch-to-configuration boot",
+	}
+	if !slices.Equal(h.ranCmds, want) {
+		t.Errorf("commands: got %v want %v", h.ranCmds, want)
+	}
+}
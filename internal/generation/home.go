@@ -57,7 +57,12 @@ func (HomeSystem) Current(h exec.Host) (Generation, error) {
 	if err != nil {
 		return Generation{}, err
 	}
-	return buildHomeGeneration(h, filepath.Dir(path), ei)
+	g, err := buildHomeGeneration(h, filepath.Dir(path), ei)
+	if err != nil {
+		return Generation{}, err
+	}
+	g.Pinned = isPinned(h, g.path)
+	return g, nil
 }
 
 func (HomeSystem) List(h exec.Host) ([]Generation, error) {
@@ -76,6 +81,17 @@ func (HomeSystem) List(h exec.Host) ([]Generation, error) {
 	return []Generation{}, nil
 }
 
+// Describe fills in the specialisations of g. Home Manager does not record a
+// label or the revisions it was built from, so those are left empty.
+func (HomeSystem) Describe(_ context.Context, h exec.Host, g *Generation) error {
+	specs, err := readSpecialisations(h, g.path)
+	if err != nil {
+		return err
+	}
+	g.Specialisations = specs
+	return nil
+}
+
 func (HomeSystem) DeleteGenerations(h exec.Host, gens []Generation) error {
 	for _, g := range gens {
 		if err := h.Remove(g.path); err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -85,12 +101,27 @@ func (HomeSystem) DeleteGenerations(h exec.Host, gens []Generation) error {
 	return nil
 }
 
-func (HomeSystem) CollectGarbage(ctx context.Context, h exec.Host) error {
+// Pin protects gen from cleanup. Home generations are user-owned, so no
+// elevation is required.
+func (HomeSystem) Pin(ctx context.Context, h exec.Host, gen Generation) error {
+	return setPin(ctx, h, gen, true, false)
+}
+
+func (HomeSystem) Unpin(ctx context.Context, h exec.Host, gen Generation) error {
+	return setPin(ctx, h, gen, false, false)
+}
+
+func (HomeSystem) CollectGarbage(ctx context.Context, h exec.Host) (*GCStats, error) {
 	// Home generations are user-owned; no elevation is required locally or
 	// remotely. The gc runs against the host's own store.
 	return runGC(ctx, h, "nix", "store", "gc", "-v")
 }
 
+// GCPrivileged is always false, gc runs as the user.
+func (HomeSystem) GCPrivileged(exec.Host) bool {
+	return false
+}
+
 func (HomeSystem) Rollback(ctx context.Context, h exec.Host, gen Generation) error {
 	// The profile path is the directory of the generation link with the
 	// generation suffix stripped: .../home-manager-38-link -> .../home-manager
@@ -137,6 +168,8 @@ func listHomeGenerations(h exec.Host, dir string) ([]Generation, error) {
 		return nil, err
 	}
 
+	pinned := pinnedLinks(entries)
+
 	var gens []Generation
 	for _, e := range entries {
 		if !e.IsSymlink || !homeGenListRe.MatchString(e.Name) {
@@ -146,6 +179,7 @@ func listHomeGenerations(h exec.Host, dir string) ([]Generation, error) {
 		if err != nil {
 			return nil, err
 		}
+		g.Pinned = pinned[e.Name]
 		gens = append(gens, g)
 	}
 	return gens, nil
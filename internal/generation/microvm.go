@@ -0,0 +1,165 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/util"
+)
+
+const (
+	microvmStateDir    = "/var/lib/microvms"
+	microvmProfilesDir = "/nix/var/nix/profiles/microvm"
+)
+
+// MicroVMSystem implements System for an installed MicroVM. microvm.nix only
+// keeps "current" and "booted" runner links in the VM's state directory, so
+// the runner history is tracked in a profile under
+// /nix/var/nix/profiles/microvm that RecordMicroVMRunner appends to after
+// every install and update. When Restart is set, Rollback restarts the VM so
+// the rolled back runner is booted right away.
+type MicroVMSystem struct {
+	Name    string
+	Restart bool
+}
+
+func (MicroVMSystem) RequiresLocalRoot() bool { return true }
+
+func (MicroVMSystem) Headers() []string {
+	return []string{"Generation", "Build date", "Runner"}
+}
+
+func (MicroVMSystem) Row(g Generation) []string {
+	return []string{
+		strconv.Itoa(g.ID),
+		g.BuildDate.Format(time.DateTime),
+		g.storePath,
+	}
+}
+
+// Current returns the generation of the runner the "current" link points at,
+// falling back to the profile's own current generation when that runner was
+// installed outside of nilla.
+func (s MicroVMSystem) Current(h exec.Host) (Generation, error) {
+	gens, err := s.List(h)
+	if err != nil {
+		return Generation{}, err
+	}
+	if runner, err := h.Readlink(s.link("current")); err == nil {
+		for _, g := range gens {
+			if g.storePath == runner {
+				return g, nil
+			}
+		}
+	}
+	return s.profile().Current(h)
+}
+
+// List returns the recorded runner generations, marking the one the VM is
+// currently booted from.
+func (s MicroVMSystem) List(h exec.Host) ([]Generation, error) {
+	gens, err := s.profile().List(h)
+	if err != nil {
+		return nil, fmt.Errorf("no runner history for MicroVM %q, it is recorded by install and update: %w", s.Name, err)
+	}
+	booted, err := h.Readlink(s.link("booted"))
+	if err != nil {
+		return gens, nil
+	}
+	for i := range gens {
+		gens[i].Booted = gens[i].storePath == booted
+	}
+	return gens, nil
+}
+
+// Describe is a no-op: runners carry no metadata beyond their contents.
+func (MicroVMSystem) Describe(context.Context, exec.Host, *Generation) error {
+	return nil
+}
+
+func (s MicroVMSystem) DeleteGenerations(h exec.Host, gens []Generation) error {
+	return s.profile().DeleteGenerations(h, gens)
+}
+
+// Rollback switches the runner profile to gen and points the VM's "current"
+// link at its runner, which is what microvm@.service starts. The VM keeps
+// running the old runner until it is restarted.
+func (s MicroVMSystem) Rollback(ctx context.Context, h exec.Host, gen Generation) error {
+	if err := s.profile().Rollback(ctx, h, gen); err != nil {
+		return err
+	}
+
+	sudo := !h.IsLocal()
+	if err := runMaybeSudo(ctx, h, sudo, "ln", "-sfn", gen.storePath, s.link("current")); err != nil {
+		return err
+	}
+	if !s.Restart {
+		return nil
+	}
+	return runMaybeSudo(ctx, h, sudo, "systemctl", "restart", fmt.Sprintf("microvm@%s.service", s.Name))
+}
+
+func (s MicroVMSystem) Pin(ctx context.Context, h exec.Host, gen Generation) error {
+	return s.profile().Pin(ctx, h, gen)
+}
+
+func (s MicroVMSystem) Unpin(ctx context.Context, h exec.Host, gen Generation) error {
+	return s.profile().Unpin(ctx, h, gen)
+}
+
+func (s MicroVMSystem) CollectGarbage(ctx context.Context, h exec.Host) (*GCStats, error) {
+	if s.GCPrivileged(h) {
+		return runGC(ctx, h, "sudo", "nix", "store", "gc", "-v")
+	}
+	return runGC(ctx, h, "nix", "store", "gc", "-v")
+}
+
+// GCPrivileged is true for remote hosts, like for NixOS.
+func (MicroVMSystem) GCPrivileged(h exec.Host) bool {
+	return !h.IsLocal()
+}
+
+func (s MicroVMSystem) profile() ProfileSystem {
+	return ProfileSystem{Path: microvmProfile(s.Name)}
+}
+
+func (s MicroVMSystem) link(name string) string {
+	return filepath.Join(microvmStateDir, s.Name, name)
+}
+
+func microvmProfile(name string) string {
+	return filepath.Join(microvmProfilesDir, name)
+}
+
+// RecordMicroVMRunner adds the runner the "current" link of MicroVM name points
+// at as a new generation of its runner profile. It is a no-op when that runner
+// is already the profile's current generation.
+func RecordMicroVMRunner(ctx context.Context, h exec.Host, name string) error {
+	s := MicroVMSystem{Name: name}
+	runner, err := h.Readlink(s.link("current"))
+	if err != nil {
+		return err
+	}
+	if target, err := h.Readlink(microvmProfile(name)); err == nil {
+		if cur, err := h.Readlink(filepath.Join(microvmProfilesDir, filepath.Base(target))); err == nil && cur == runner {
+			return nil
+		}
+	}
+
+	sudo := !h.IsLocal() || !util.IsRoot()
+	if err := runMaybeSudo(ctx, h, sudo, "mkdir", "-p", microvmProfilesDir); err != nil {
+		return err
+	}
+	return runMaybeSudo(ctx, h, sudo, "nix-env", "-p", microvmProfile(name), "--set", runner)
+}
+
+func runMaybeSudo(ctx context.Context, h exec.Host, sudo bool, name string, args ...string) error {
+	if sudo {
+		return runCmd(ctx, h, "sudo", append([]string{name}, args...)...)
+	}
+	return runCmd(ctx, h, name, args...)
+}
@@ -2,11 +2,14 @@ package generation
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +21,8 @@ const nixosProfilesDir = "/nix/var/nix/profiles"
 
 var (
 	nixosCurrentLink = nixosProfilesDir + "/system"
+	nixosActiveLink  = "/run/current-system"
+	nixosBootedLink  = "/run/booted-system"
 	nixosGenIDRe     = regexp.MustCompile(`^system-(\d+)-link$`)
 	nixosGenListRe   = regexp.MustCompile(`^system-\d+-link$`)
 	kernelVersionRe  = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
@@ -54,7 +59,12 @@ func (NixOSSystem) Current(h exec.Host) (Generation, error) {
 	if err != nil {
 		return Generation{}, err
 	}
-	return buildNixOSGeneration(h, nixosProfilesDir, ei)
+	g, err := buildNixOSGeneration(h, nixosProfilesDir, ei)
+	if err != nil {
+		return Generation{}, err
+	}
+	g.Pinned = isPinned(h, g.path)
+	return g, nil
 }
 
 func (NixOSSystem) List(h exec.Host) ([]Generation, error) {
@@ -63,6 +73,8 @@ func (NixOSSystem) List(h exec.Host) ([]Generation, error) {
 		return nil, err
 	}
 
+	pinned := pinnedLinks(entries)
+
 	var gens []Generation
 	for _, e := range entries {
 		if !e.IsSymlink || !nixosGenListRe.MatchString(e.Name) {
@@ -72,11 +84,68 @@ func (NixOSSystem) List(h exec.Host) ([]Generation, error) {
 		if err != nil {
 			return nil, err
 		}
+		g.Pinned = pinned[e.Name]
 		gens = append(gens, g)
 	}
+
+	// The running and booted systems are store paths rather than profile
+	// links, so they are matched by target.
+	active, _ := h.Readlink(nixosActiveLink)
+	booted, _ := h.Readlink(nixosBootedLink)
+	for i := range gens {
+		if gens[i].storePath == "" {
+			continue
+		}
+		gens[i].Active = gens[i].storePath == active
+		gens[i].Booted = gens[i].storePath == booted
+	}
 	return gens, nil
 }
 
+// Describe fills in the label, specialisations and revisions of g. The label
+// and specialisations come from the bootspec document (boot.json) with a
+// fallback to the specialisation directory. Revisions are read from the
+// configuration-revision file when present and otherwise from the generation's
+// own nixos-version tool. Missing metadata is left empty.
+func (NixOSSystem) Describe(_ context.Context, h exec.Host, g *Generation) error {
+	if b, err := h.ReadFile(filepath.Join(g.path, "boot.json")); err == nil {
+		label, specs, err := parseBootspec(b)
+		if err != nil {
+			return fmt.Errorf("generation %d: %w", g.ID, err)
+		}
+		g.Label = label
+		g.Specialisations = specs
+	}
+	if len(g.Specialisations) == 0 {
+		specs, err := readSpecialisations(h, g.path)
+		if err != nil {
+			return err
+		}
+		g.Specialisations = specs
+	}
+
+	if b, err := h.ReadFile(filepath.Join(g.path, "configuration-revision")); err == nil {
+		g.ConfigurationRevision = strings.TrimSpace(string(b))
+	}
+
+	// nixos-version is a store path of the generation itself, so it reports
+	// the revisions the generation was built from rather than those of the
+	// running system.
+	out, err := runOutput(h, filepath.Join(g.path, "sw", "bin", "nixos-version"), "--json")
+	if err != nil {
+		return nil
+	}
+	info, err := parseNixOSVersionJSON([]byte(out))
+	if err != nil {
+		return nil
+	}
+	g.NixpkgsRevision = info.NixpkgsRevision
+	if g.ConfigurationRevision == "" {
+		g.ConfigurationRevision = info.ConfigurationRevision
+	}
+	return nil
+}
+
 func (NixOSSystem) DeleteGenerations(h exec.Host, gens []Generation) error {
 	if len(gens) == 0 {
 		return nil
@@ -123,12 +192,27 @@ func (NixOSSystem) Rollback(ctx context.Context, h exec.Host, gen Generation) er
 	return runCmd(ctx, h, "sudo", switchp, "switch")
 }
 
-func (NixOSSystem) CollectGarbage(ctx context.Context, h exec.Host) error {
-	// Local cleanup already elevated to root; remote gc must run under sudo.
-	if h.IsLocal() {
-		return runGC(ctx, h, "nix", "store", "gc", "-v")
+// Pin protects gen from cleanup. Remote profile links are root-owned, so the
+// pin is created under sudo there.
+func (NixOSSystem) Pin(ctx context.Context, h exec.Host, gen Generation) error {
+	return setPin(ctx, h, gen, true, !h.IsLocal())
+}
+
+func (NixOSSystem) Unpin(ctx context.Context, h exec.Host, gen Generation) error {
+	return setPin(ctx, h, gen, false, !h.IsLocal())
+}
+
+func (s NixOSSystem) CollectGarbage(ctx context.Context, h exec.Host) (*GCStats, error) {
+	if s.GCPrivileged(h) {
+		return runGC(ctx, h, "sudo", "nix", "store", "gc", "-v")
 	}
-	return runGC(ctx, h, "sudo", "nix", "store", "gc", "-v")
+	return runGC(ctx, h, "nix", "store", "gc", "-v")
+}
+
+// GCPrivileged is true for remote hosts. Local cleanup already elevated to
+// root.
+func (NixOSSystem) GCPrivileged(h exec.Host) bool {
+	return !h.IsLocal()
 }
 
 func buildNixOSGeneration(h exec.Host, root string, e exec.EntryInfo) (Generation, error) {
@@ -153,12 +237,15 @@ func buildNixOSGeneration(h exec.Host, root string, e exec.EntryInfo) (Generatio
 		return Generation{}, err
 	}
 
+	target, _ := h.Readlink(path)
+
 	return Generation{
 		ID:            id,
 		BuildDate:     e.ModTime,
 		Version:       strings.TrimSpace(string(verBytes)),
 		KernelVersion: kernel,
 		path:          path,
+		storePath:     target,
 	}, nil
 }
 
@@ -175,15 +262,73 @@ func readKernelVersion(h exec.Host, system string) (string, error) {
 	return "Unknown", nil
 }
 
-func runGC(ctx context.Context, h exec.Host, name string, args ...string) error {
+type nixosVersionInfo struct {
+	NixosVersion          string `json:"nixosVersion"`
+	NixpkgsRevision       string `json:"nixpkgsRevision"`
+	ConfigurationRevision string `json:"configurationRevision"`
+}
+
+func parseNixOSVersionJSON(b []byte) (nixosVersionInfo, error) {
+	var info nixosVersionInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nixosVersionInfo{}, err
+	}
+	return info, nil
+}
+
+// parseBootspec extracts the boot label and the sorted specialisation names
+// from a bootspec v1 document.
+func parseBootspec(b []byte) (string, []string, error) {
+	var doc struct {
+		V1 struct {
+			Label string `json:"label"`
+		} `json:"org.nixos.bootspec.v1"`
+		Specialisations map[string]json.RawMessage `json:"org.nixos.specialisation.v1"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return "", nil, fmt.Errorf("parse boot.json: %w", err)
+	}
+	specs := make([]string, 0, len(doc.Specialisations))
+	for name := range doc.Specialisations {
+		specs = append(specs, name)
+	}
+	slices.Sort(specs)
+	return doc.V1.Label, specs, nil
+}
+
+// readSpecialisations lists the entries of a generation's specialisation
+// directory. A generation without specialisations yields an empty list.
+func readSpecialisations(h exec.Host, path string) ([]string, error) {
+	entries, err := h.ReadDir(filepath.Join(path, "specialisation"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	specs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		specs = append(specs, e.Name)
+	}
+	slices.Sort(specs)
+	return specs, nil
+}
+
+// runGC streams the gc log to stderr while keeping its tail, which holds the
+// summary of what was freed.
+func runGC(ctx context.Context, h exec.Host, name string, args ...string) (*GCStats, error) {
 	c, err := h.CommandContext(ctx, name, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	tail := &tailBuffer{max: 4096}
 	c.SetStdin(os.Stdin)
-	c.SetStderr(os.Stderr)
-	c.SetStdout(os.Stderr)
-	return c.Run()
+	c.SetStderr(io.MultiWriter(exec.Terminal(h), tail))
+	c.SetStdout(io.MultiWriter(exec.Terminal(h), tail))
+	if err := c.Run(); err != nil {
+		return nil, err
+	}
+	return parseGCStats(string(tail.buf)), nil
 }
 
 func runCmd(ctx context.Context, h exec.Host, name string, args ...string) error {
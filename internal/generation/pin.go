@@ -0,0 +1,65 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+)
+
+// A pin is a symlink next to the generation's profile link (system-5-link is
+// pinned by system-5-pin) pointing at the same store path. Pin links do not
+// match the generation link patterns, so they are invisible to nix-env and to
+// List. Pins are created with `nix-store --add-root --indirect`, which also
+// registers them in /nix/var/nix/gcroots/auto, so they keep the generation
+// alive wherever the profile lives, including Home Manager and custom profiles
+// outside /nix/var/nix/profiles. Removing a pin leaves a dangling root that
+// the next garbage collection cleans up.
+const pinSuffix = "-pin"
+
+func pinPath(linkPath string) string {
+	return strings.TrimSuffix(linkPath, "-link") + pinSuffix
+}
+
+// pinnedLinks returns the names of the generation links in entries that have
+// a pin next to them.
+func pinnedLinks(entries []exec.EntryInfo) map[string]bool {
+	pinned := map[string]bool{}
+	for _, e := range entries {
+		if e.IsSymlink && strings.HasSuffix(e.Name, pinSuffix) {
+			pinned[strings.TrimSuffix(e.Name, pinSuffix)+"-link"] = true
+		}
+	}
+	return pinned
+}
+
+func isPinned(h exec.Host, linkPath string) bool {
+	_, err := h.Lstat(pinPath(linkPath))
+	return err == nil
+}
+
+// setPin creates or removes the pin of g. sudo is used for profile
+// directories that are root-owned on remote hosts.
+func setPin(ctx context.Context, h exec.Host, g Generation, pinned, sudo bool) error {
+	if !pinned {
+		if sudo {
+			return runCmd(ctx, h, "sudo", "rm", "-f", pinPath(g.path))
+		}
+		if err := h.Remove(pinPath(g.path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	target, err := h.Readlink(g.path)
+	if err != nil {
+		return err
+	}
+	args := []string{"nix-store", "--realise", target, "--add-root", pinPath(g.path), "--indirect"}
+	if sudo {
+		return runCmd(ctx, h, "sudo", args...)
+	}
+	return runCmd(ctx, h, args[0], args[1:]...)
+}
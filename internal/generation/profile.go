@@ -0,0 +1,204 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+	"github.com/arnarg/nilla-utils/internal/util"
+	"golang.org/x/sys/unix"
+)
+
+// ProfileSystem implements System for an arbitrary Nix profile, such as a
+// `nix profile` user profile, a per-user profile under
+// /nix/var/nix/profiles/per-user or a custom `nix-env -p` profile. Path is the
+// profile link itself (e.g. ~/.local/state/nix/profiles/profile), whose
+// generations are the <name>-N-link siblings next to it. A leading "~/" is
+// resolved against the home directory of the user on the host.
+type ProfileSystem struct {
+	Path string
+}
+
+// RequiresLocalRoot reports whether the local profile directory is writable
+// only by someone else, as is the case for /nix/var/nix/profiles itself.
+func (p ProfileSystem) RequiresLocalRoot() bool {
+	dir := filepath.Dir(p.Path)
+	if rest, ok := strings.CutPrefix(dir, "~"); ok {
+		dir = util.GetHomeDir() + rest
+	}
+	return unix.Access(dir, unix.W_OK) != nil
+}
+
+func (ProfileSystem) Headers() []string {
+	return []string{"Generation", "Build date", "Store path"}
+}
+
+func (ProfileSystem) Row(g Generation) []string {
+	return []string{
+		strconv.Itoa(g.ID),
+		g.BuildDate.Format(time.DateTime),
+		g.storePath,
+	}
+}
+
+func (p ProfileSystem) Current(h exec.Host) (Generation, error) {
+	profile := p.resolve(h)
+	res, err := h.Readlink(profile)
+	if err != nil {
+		return Generation{}, err
+	}
+	dir := filepath.Dir(profile)
+	ei, err := h.Lstat(filepath.Join(dir, filepath.Base(res)))
+	if err != nil {
+		return Generation{}, err
+	}
+	g, err := p.build(h, dir, ei)
+	if err != nil {
+		return Generation{}, err
+	}
+	g.Pinned = isPinned(h, g.path)
+	return g, nil
+}
+
+func (p ProfileSystem) List(h exec.Host) ([]Generation, error) {
+	profile := p.resolve(h)
+	dir := filepath.Dir(profile)
+	entries, err := h.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	re := profileGenRe(filepath.Base(profile))
+	pinned := pinnedLinks(entries)
+
+	var gens []Generation
+	for _, e := range entries {
+		if !e.IsSymlink || !re.MatchString(e.Name) {
+			continue
+		}
+		g, err := p.build(h, dir, e)
+		if err != nil {
+			return nil, err
+		}
+		g.Pinned = pinned[e.Name]
+		gens = append(gens, g)
+	}
+	return gens, nil
+}
+
+// Describe is a no-op: a plain profile carries no metadata beyond its
+// contents.
+func (ProfileSystem) Describe(context.Context, exec.Host, *Generation) error {
+	return nil
+}
+
+func (p ProfileSystem) DeleteGenerations(h exec.Host, gens []Generation) error {
+	if len(gens) == 0 {
+		return nil
+	}
+	if p.needsSudo(h) {
+		args := []string{"rm"}
+		for _, g := range gens {
+			args = append(args, g.path)
+		}
+		c, err := h.Command("sudo", args...)
+		if err != nil {
+			return err
+		}
+		c.SetStdin(os.Stdin)
+		c.SetStderr(os.Stderr)
+		c.SetStdout(os.Stdout)
+		return c.Run()
+	}
+	for _, g := range gens {
+		if err := h.Remove(g.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback points the profile at gen. Profiles have no activation step.
+func (p ProfileSystem) Rollback(ctx context.Context, h exec.Host, gen Generation) error {
+	args := []string{"nix-env", "-p", p.resolve(h), "--switch-generation", strconv.Itoa(gen.ID)}
+	if p.needsSudo(h) {
+		return runCmd(ctx, h, "sudo", args...)
+	}
+	return runCmd(ctx, h, args[0], args[1:]...)
+}
+
+func (p ProfileSystem) Pin(ctx context.Context, h exec.Host, gen Generation) error {
+	return setPin(ctx, h, gen, true, p.needsSudo(h))
+}
+
+func (p ProfileSystem) Unpin(ctx context.Context, h exec.Host, gen Generation) error {
+	return setPin(ctx, h, gen, false, p.needsSudo(h))
+}
+
+func (ProfileSystem) CollectGarbage(ctx context.Context, h exec.Host) (*GCStats, error) {
+	// Like Home Manager, gc goes through the daemon and needs no elevation.
+	return runGC(ctx, h, "nix", "store", "gc", "-v")
+}
+
+// GCPrivileged is always false, gc runs as the user.
+func (ProfileSystem) GCPrivileged(exec.Host) bool {
+	return false
+}
+
+// resolve expands a leading "~/" in the profile path on h.
+func (p ProfileSystem) resolve(h exec.Host) string {
+	rest, ok := strings.CutPrefix(p.Path, "~/")
+	if !ok {
+		return p.Path
+	}
+	_, home := homeUserAndDir(h, "")
+	return filepath.Join(home, rest)
+}
+
+// needsSudo reports whether the profile directory on a remote host is not
+// writable by the SSH user. Local runs have already self-elevated if needed.
+func (p ProfileSystem) needsSudo(h exec.Host) bool {
+	if h.IsLocal() {
+		return false
+	}
+	_, err := runOutput(h, "test", "-w", filepath.Dir(p.resolve(h)))
+	return err != nil
+}
+
+func (p ProfileSystem) build(h exec.Host, dir string, e exec.EntryInfo) (Generation, error) {
+	m := profileGenIDRe.FindStringSubmatch(e.Name)
+	if m == nil {
+		return Generation{}, fmt.Errorf("generation path '%s' does not match pattern", e.Name)
+	}
+	id, err := strconv.Atoi(m[1])
+	if err != nil {
+		return Generation{}, err
+	}
+
+	path := filepath.Join(dir, e.Name)
+
+	target, err := h.Readlink(path)
+	if err != nil {
+		return Generation{}, err
+	}
+
+	return Generation{
+		ID:        id,
+		BuildDate: e.ModTime,
+		path:      path,
+		storePath: target,
+	}, nil
+}
+
+var profileGenIDRe = regexp.MustCompile(`-(\d+)-link$`)
+
+func profileGenRe(name string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `-\d+-link$`)
+}
@@ -58,6 +58,16 @@ func (c NixCommand) Reporter(reporter ProgressReporter) NixCommand {
 }
 
 func (c NixCommand) Run(ctx context.Context) ([]byte, error) {
+	// Refuse a nix too old for the flags below. The probe is cached per
+	// executor, and callers reuse it to pick the parser of the output.
+	info, err := Probe(ctx, c.exec)
+	if err != nil {
+		return nil, err
+	}
+	if err := info.Supported(); err != nil {
+		return nil, err
+	}
+
 	cmd := "nix"
 	args := []string{}
 
@@ -91,11 +91,12 @@ func (e StartRealiseEvent) Action() ActionType {
 
 // StartCopyPathEvent
 type StartCopyPathEvent struct {
-	ID   int64
-	Path string
-	From string
-	To   string
-	Text string
+	ID     int64
+	Parent int64
+	Path   string
+	From   string
+	To     string
+	Text   string
 }
 
 func (e StartCopyPathEvent) Action() ActionType {
@@ -125,6 +126,93 @@ func (e StartFileTransferEvent) Action() ActionType {
 	return ActionTypeStart
 }
 
+// StartSubstituteEvent is the substitution of Path from the binary cache
+// Substituter. The download itself is a child StartCopyPathEvent.
+type StartSubstituteEvent struct {
+	ID          int64
+	Parent      int64
+	Path        string
+	Substituter string
+}
+
+func (e StartSubstituteEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
+// StartQueryPathInfoEvent is a lookup of Path in the binary cache
+// Substituter.
+type StartQueryPathInfoEvent struct {
+	ID          int64
+	Parent      int64
+	Path        string
+	Substituter string
+	Text        string
+}
+
+func (e StartQueryPathInfoEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
+// StartPostBuildHookEvent is the post-build-hook running for the derivation
+// Path, usually to upload its outputs. Its output arrives as
+// ResultPostBuildLogLineEvent.
+type StartPostBuildHookEvent struct {
+	ID     int64
+	Parent int64
+	Path   string
+	Text   string
+}
+
+func (e StartPostBuildHookEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
+// StartBuildWaitingEvent is Nix waiting, for a lock on an output path that
+// another process is building or for a remote builder to become available.
+// Text says which.
+type StartBuildWaitingEvent struct {
+	ID     int64
+	Parent int64
+	Text   string
+}
+
+func (e StartBuildWaitingEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
+// StartFetchTreeEvent is the fetching of a flake input or fetcher call
+// during evaluation.
+type StartFetchTreeEvent struct {
+	ID     int64
+	Parent int64
+	Text   string
+}
+
+func (e StartFetchTreeEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
+// StartOptimiseStoreEvent is the deduplication of files in the store.
+type StartOptimiseStoreEvent struct {
+	ID     int64
+	Parent int64
+}
+
+func (e StartOptimiseStoreEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
+// StartVerifyPathsEvent is the verification of store paths, which reports
+// ResultUntrustedPathEvent and ResultCorruptedPathEvent.
+type StartVerifyPathsEvent struct {
+	ID     int64
+	Parent int64
+}
+
+func (e StartVerifyPathsEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
 // ResultProgressEvent
 type ResultProgressEvent struct {
 	ID       int64
@@ -178,6 +266,58 @@ func (e ResultBuildLogLineEvent) Action() ActionType {
 	return ActionTypeResult
 }
 
+// ResultPostBuildLogLineEvent is a line of post-build-hook output.
+type ResultPostBuildLogLineEvent struct {
+	ID   int64
+	Text string
+}
+
+func (e ResultPostBuildLogLineEvent) Action() ActionType {
+	return ActionTypeResult
+}
+
+// ResultFileLinkedEvent is a file replaced by a hard link while optimising
+// the store, freeing Bytes.
+type ResultFileLinkedEvent struct {
+	ID     int64
+	Bytes  int64
+	Blocks int64
+}
+
+func (e ResultFileLinkedEvent) Action() ActionType {
+	return ActionTypeResult
+}
+
+// ResultUntrustedPathEvent is a path without a signature by a trusted key.
+type ResultUntrustedPathEvent struct {
+	ID   int64
+	Path string
+}
+
+func (e ResultUntrustedPathEvent) Action() ActionType {
+	return ActionTypeResult
+}
+
+// ResultCorruptedPathEvent is a path whose contents do not match its hash.
+type ResultCorruptedPathEvent struct {
+	ID   int64
+	Path string
+}
+
+func (e ResultCorruptedPathEvent) Action() ActionType {
+	return ActionTypeResult
+}
+
+// ResultFetchStatusEvent is a status line of a fetch, like git progress.
+type ResultFetchStatusEvent struct {
+	ID     int64
+	Status string
+}
+
+func (e ResultFetchStatusEvent) Action() ActionType {
+	return ActionTypeResult
+}
+
 // StopEvent
 type StopEvent struct {
 	ID int64
@@ -298,6 +438,20 @@ func decodeRawStartEvent(val *fastjson.Value) Event {
 		return decodeRawStartBuildEvent(val)
 	case protoEventTypeFileTransfer:
 		return decodeRawStartFileTransferEvent(val)
+	case protoEventTypeSubstitute:
+		return decodeRawStartSubstituteEvent(val)
+	case protoEventTypeQueryPathInfo:
+		return decodeRawStartQueryPathInfoEvent(val)
+	case protoEventTypePostBuildHook:
+		return decodeRawStartPostBuildHookEvent(val)
+	case protoEventTypeBuildWaiting:
+		return decodeRawStartBuildWaitingEvent(val)
+	case protoEventTypeFetchTree:
+		return decodeRawStartFetchTreeEvent(val)
+	case protoEventTypeOptimiseStore:
+		return decodeRawStartOptimiseStoreEvent(val)
+	case protoEventTypeVerifyPaths:
+		return decodeRawStartVerifyPathsEvent(val)
 	}
 
 	return nil
@@ -383,11 +537,12 @@ func decodeRawStartCopyPathEvent(val *fastjson.Value) Event {
 	}
 
 	return StartCopyPathEvent{
-		ID:   id,
-		Path: string(p),
-		From: string(from),
-		To:   string(to),
-		Text: string(text),
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+		Path:   string(p),
+		From:   string(from),
+		To:     string(to),
+		Text:   string(text),
 	}
 }
 
@@ -464,6 +619,142 @@ func decodeRawStartFileTransferEvent(val *fastjson.Value) Event {
 	}
 }
 
+func decodeRawStartSubstituteEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 2 {
+		return nil
+	}
+
+	// Get path
+	p := fields[0].GetStringBytes()
+	if p == nil {
+		return nil
+	}
+
+	return StartSubstituteEvent{
+		ID:          id,
+		Parent:      val.GetInt64("parent"),
+		Path:        string(p),
+		Substituter: string(fields[1].GetStringBytes()),
+	}
+}
+
+func decodeRawStartQueryPathInfoEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 2 {
+		return nil
+	}
+
+	// Get path
+	p := fields[0].GetStringBytes()
+	if p == nil {
+		return nil
+	}
+
+	return StartQueryPathInfoEvent{
+		ID:          id,
+		Parent:      val.GetInt64("parent"),
+		Path:        string(p),
+		Substituter: string(fields[1].GetStringBytes()),
+		Text:        string(val.GetStringBytes("text")),
+	}
+}
+
+func decodeRawStartPostBuildHookEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 1 {
+		return nil
+	}
+
+	// Get derivation path
+	p := fields[0].GetStringBytes()
+	if p == nil {
+		return nil
+	}
+
+	return StartPostBuildHookEvent{
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+		Path:   string(p),
+		Text:   string(val.GetStringBytes("text")),
+	}
+}
+
+func decodeRawStartBuildWaitingEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	return StartBuildWaitingEvent{
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+		Text:   string(val.GetStringBytes("text")),
+	}
+}
+
+func decodeRawStartFetchTreeEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	return StartFetchTreeEvent{
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+		Text:   string(val.GetStringBytes("text")),
+	}
+}
+
+func decodeRawStartOptimiseStoreEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	return StartOptimiseStoreEvent{
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+	}
+}
+
+func decodeRawStartVerifyPathsEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	return StartVerifyPathsEvent{
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+	}
+}
+
 func decodeRawResultEvent(val *fastjson.Value) Event {
 	switch val.GetInt("type") {
 	case protoResultTypeProgress:
@@ -474,6 +765,20 @@ func decodeRawResultEvent(val *fastjson.Value) Event {
 		return decodeRawResultSetPhaseEvent(val)
 	case protoResultTypeBuildLogLine:
 		return decodeRawResultBuildLogLineEvent(val)
+	case protoResultTypePostBuildLogLine:
+		return decodeRawResultPostBuildLogLineEvent(val)
+	case protoResultTypeFileLinked:
+		return decodeRawResultFileLinkedEvent(val)
+	case protoResultTypeUntrustedPath:
+		return decodeRawResultPathEvent(val, func(id int64, p string) Event {
+			return ResultUntrustedPathEvent{id, p}
+		})
+	case protoResultTypeCorruptedPath:
+		return decodeRawResultPathEvent(val, func(id int64, p string) Event {
+			return ResultCorruptedPathEvent{id, p}
+		})
+	case protoResultTypeFetchStatus:
+		return decodeRawResultFetchStatusEvent(val)
 	}
 
 	return nil
@@ -583,3 +888,87 @@ func decodeRawResultBuildLogLineEvent(val *fastjson.Value) Event {
 
 	return ResultBuildLogLineEvent{id, string(text)}
 }
+
+func decodeRawResultPostBuildLogLineEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 1 {
+		return nil
+	}
+
+	// Parse text
+	text := fields[0].GetStringBytes()
+	if text == nil {
+		return nil
+	}
+
+	return ResultPostBuildLogLineEvent{id, string(text)}
+}
+
+func decodeRawResultFileLinkedEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 2 {
+		return nil
+	}
+
+	return ResultFileLinkedEvent{id, fields[0].GetInt64(), fields[1].GetInt64()}
+}
+
+// decodeRawResultPathEvent decodes a result whose only field is a store path
+// into the event built by mk.
+func decodeRawResultPathEvent(val *fastjson.Value, mk func(int64, string) Event) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 1 {
+		return nil
+	}
+
+	// Parse path
+	p := fields[0].GetStringBytes()
+	if p == nil {
+		return nil
+	}
+
+	return mk(id, string(p))
+}
+
+func decodeRawResultFetchStatusEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Parse fields
+	fields := val.GetArray("fields")
+	if len(fields) < 1 {
+		return nil
+	}
+
+	// Parse status
+	status := fields[0].GetStringBytes()
+	if status == nil {
+		return nil
+	}
+
+	return ResultFetchStatusEvent{id, string(status)}
+}
@@ -0,0 +1,114 @@
+package nix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestProgressDecoder(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Event
+	}{
+		{
+			name: "build",
+			in:   `@nix {"action":"start","id":5,"level":3,"parent":0,"text":"building '/nix/store/aaaa-hello-2.12.1.drv'","type":105,"fields":["/nix/store/aaaa-hello-2.12.1.drv","",1,1]}`,
+			want: StartBuildEvent{ID: 5, Path: "/nix/store/aaaa-hello-2.12.1.drv", Text: "building '/nix/store/aaaa-hello-2.12.1.drv'"},
+		},
+		{
+			name: "copy path with parent",
+			in:   `@nix {"action":"start","id":8,"level":3,"parent":7,"text":"copying path","type":100,"fields":["/nix/store/bbbb-zlib-1.3.1","https://cache.nixos.org","local"]}`,
+			want: StartCopyPathEvent{ID: 8, Parent: 7, Path: "/nix/store/bbbb-zlib-1.3.1", From: "https://cache.nixos.org", To: "local", Text: "copying path"},
+		},
+		{
+			name: "substitute",
+			in:   `@nix {"action":"start","id":7,"level":4,"parent":2,"text":"","type":108,"fields":["/nix/store/bbbb-zlib-1.3.1","https://cache.nixos.org"]}`,
+			want: StartSubstituteEvent{ID: 7, Parent: 2, Path: "/nix/store/bbbb-zlib-1.3.1", Substituter: "https://cache.nixos.org"},
+		},
+		{
+			name: "query path info",
+			in:   `@nix {"action":"start","id":9,"level":5,"parent":0,"text":"querying info about '/nix/store/bbbb-zlib-1.3.1' on 'https://cache.nixos.org'","type":109,"fields":["/nix/store/bbbb-zlib-1.3.1","https://cache.nixos.org"]}`,
+			want: StartQueryPathInfoEvent{
+				ID:          9,
+				Path:        "/nix/store/bbbb-zlib-1.3.1",
+				Substituter: "https://cache.nixos.org",
+				Text:        "querying info about '/nix/store/bbbb-zlib-1.3.1' on 'https://cache.nixos.org'",
+			},
+		},
+		{
+			name: "post-build-hook",
+			in:   `@nix {"action":"start","id":10,"level":4,"parent":5,"text":"running post-build-hook '/etc/upload.sh'","type":110,"fields":["/nix/store/aaaa-hello-2.12.1.drv"]}`,
+			want: StartPostBuildHookEvent{ID: 10, Parent: 5, Path: "/nix/store/aaaa-hello-2.12.1.drv", Text: "running post-build-hook '/etc/upload.sh'"},
+		},
+		{
+			name: "build waiting",
+			in:   `@nix {"action":"start","id":11,"level":1,"parent":0,"text":"waiting for lock on '/nix/store/cccc-firefox-130.0'","type":111}`,
+			want: StartBuildWaitingEvent{ID: 11, Text: "waiting for lock on '/nix/store/cccc-firefox-130.0'"},
+		},
+		{
+			name: "fetch tree",
+			in:   `@nix {"action":"start","id":12,"level":4,"parent":0,"text":"fetching github input 'github:NixOS/nixpkgs'","type":112}`,
+			want: StartFetchTreeEvent{ID: 12, Text: "fetching github input 'github:NixOS/nixpkgs'"},
+		},
+		{
+			name: "optimise store",
+			in:   `@nix {"action":"start","id":13,"level":3,"parent":0,"text":"","type":106}`,
+			want: StartOptimiseStoreEvent{ID: 13},
+		},
+		{
+			name: "verify paths",
+			in:   `@nix {"action":"start","id":14,"level":3,"parent":0,"text":"","type":107}`,
+			want: StartVerifyPathsEvent{ID: 14},
+		},
+		{
+			name: "post-build log line",
+			in:   `@nix {"action":"result","id":10,"type":107,"fields":["copying 1 paths to s3://cache"]}`,
+			want: ResultPostBuildLogLineEvent{ID: 10, Text: "copying 1 paths to s3://cache"},
+		},
+		{
+			name: "file linked",
+			in:   `@nix {"action":"result","id":13,"type":100,"fields":[4096,8]}`,
+			want: ResultFileLinkedEvent{ID: 13, Bytes: 4096, Blocks: 8},
+		},
+		{
+			name: "untrusted path",
+			in:   `@nix {"action":"result","id":14,"type":102,"fields":["/nix/store/bbbb-zlib-1.3.1"]}`,
+			want: ResultUntrustedPathEvent{ID: 14, Path: "/nix/store/bbbb-zlib-1.3.1"},
+		},
+		{
+			name: "corrupted path",
+			in:   `@nix {"action":"result","id":14,"type":103,"fields":["/nix/store/bbbb-zlib-1.3.1"]}`,
+			want: ResultCorruptedPathEvent{ID: 14, Path: "/nix/store/bbbb-zlib-1.3.1"},
+		},
+		{
+			name: "fetch status",
+			in:   `@nix {"action":"result","id":12,"type":108,"fields":["Receiving objects: 50%"]}`,
+			want: ResultFetchStatusEvent{ID: 12, Status: "Receiving objects: 50%"},
+		},
+		{
+			name: "substitute without substituter",
+			in:   `@nix {"action":"start","id":7,"level":4,"parent":2,"text":"","type":108,"fields":["/nix/store/bbbb-zlib-1.3.1"]}`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Event
+			for ev := range NewProgressDecoder(strings.NewReader(tt.in + "\n")).Events {
+				got = append(got, ev)
+			}
+
+			var want []Event
+			if tt.want != nil {
+				want = []Event{tt.want}
+			}
+			if diff := deep.Equal(got, want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -152,6 +152,56 @@ func ListAttrsInProject(file string, entry *FixedOutputStoreEntry, attr string)
 	return names, nil
 }
 
+// TargetsInProject returns the deploy target of every system in attr that
+// has one set, keyed by system name.
+func TargetsInProject(file string, entry *FixedOutputStoreEntry, attr string) (map[string]string, error) {
+	storePathName, err := GetStorePathName(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create nix code that maps system names to their targets
+	code := fmt.Sprintf(
+		`
+			let
+				source = builtins.path {path = "%s"; sha256 = "%s"; name = "%s";};
+				project = import "${source}/%s";
+			in
+				builtins.mapAttrs (_: s: s.target or null) (project.%s or {})
+		`,
+		entry.Path, entry.Hash, storePathName,
+		file,
+		attr,
+	)
+
+	// Execute code
+	eval, err := exec.Command(
+		"nix", "eval",
+		"--extra-experimental-features", "nix-command",
+		"--json", "--expr", code,
+	).Output()
+	if err != nil {
+		if xerr, ok := err.(*exec.ExitError); ok {
+			return nil, errors.New(string(xerr.Stderr))
+		}
+		return nil, err
+	}
+
+	// Parse json, dropping systems without a target
+	raw := map[string]*string{}
+	if err := json.Unmarshal(eval, &raw); err != nil {
+		return nil, err
+	}
+	targets := map[string]string{}
+	for name, t := range raw {
+		if t != nil && *t != "" {
+			targets[name] = *t
+		}
+	}
+
+	return targets, nil
+}
+
 func ExistsInProject(file string, entry *FixedOutputStoreEntry, name string) (bool, error) {
 	storePathName, err := GetStorePathName(entry.Path)
 	if err != nil {
@@ -0,0 +1,167 @@
+package nix
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"charm.land/log/v2"
+	"github.com/arnarg/nilla-utils/internal/exec"
+)
+
+// Implementation is the Nix implementation installed on a host.
+type Implementation string
+
+const (
+	// CppNix is the original Nix, including distributions of it like
+	// Determinate Nix.
+	CppNix Implementation = "Nix"
+	// Lix is the Lix fork of Nix 2.18.
+	Lix Implementation = "Lix"
+)
+
+// Version is a Nix release version.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor or newer.
+func (v Version) AtLeast(major, minor int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+// Info describes the Nix installed on a host.
+type Info struct {
+	Implementation Implementation
+	Version        Version
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s %s", i.Implementation, i.Version)
+}
+
+// minCppNix is the oldest CppNix supported, the first to have
+// `nix build --print-out-paths`. Every Lix release has it.
+var minCppNix = Version{Major: 2, Minor: 8}
+
+// Supported returns an error describing why i cannot be used, or nil.
+func (i Info) Supported() error {
+	if i.Implementation == CppNix && !i.Version.AtLeast(minCppNix.Major, minCppNix.Minor) {
+		return fmt.Errorf("%s is not supported, nilla-utils needs Nix %d.%d or later, or Lix",
+			i, minCppNix.Major, minCppNix.Minor)
+	}
+	return nil
+}
+
+// PathInfoLayout is the shape of `nix path-info --json` output.
+type PathInfoLayout int
+
+const (
+	// PathInfoUnknown is used when the Nix version is not known, and the
+	// layout has to be detected from the output.
+	PathInfoUnknown PathInfoLayout = iota
+	// PathInfoArray is an array of objects with a "path" key.
+	PathInfoArray
+	// PathInfoObject is an object keyed by store path.
+	PathInfoObject
+)
+
+// PathInfoLayout returns the shape of `nix path-info --json` output. CppNix
+// keys it by store path since 2.19, Lix forked before that.
+func (i Info) PathInfoLayout() PathInfoLayout {
+	if i.Implementation == CppNix && i.Version.AtLeast(2, 19) {
+		return PathInfoObject
+	}
+	return PathInfoArray
+}
+
+// versionRe matches `nix --version` output of CppNix ("nix (Nix) 2.24.9"),
+// Determinate Nix ("nix (Determinate Nix 3.8.5) 2.30.2") and Lix
+// ("nix (Lix, like Nix) 2.91.1"). Pre-releases and Lix dev builds carry a
+// suffix after the patch version.
+var versionRe = regexp.MustCompile(`^nix \(([^)]*)\) (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseInfo parses the output of `nix --version`.
+func ParseInfo(out string) (Info, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	m := versionRe.FindStringSubmatch(line)
+	if m == nil {
+		return Info{}, fmt.Errorf("unrecognised nix --version output %q", line)
+	}
+
+	info := Info{Implementation: CppNix}
+	if strings.HasPrefix(m[1], "Lix") {
+		info.Implementation = Lix
+	}
+	info.Version.Major, _ = strconv.Atoi(m[2])
+	info.Version.Minor, _ = strconv.Atoi(m[3])
+	if m[4] != "" {
+		info.Version.Patch, _ = strconv.Atoi(m[4])
+	}
+	return info, nil
+}
+
+// probeCache remembers the Nix found per executor. Local executors share a
+// single entry, as they all run the same nix. Failed probes are not cached.
+type probeCache struct {
+	mu    sync.Mutex
+	infos map[any]Info
+}
+
+func newProbeCache() *probeCache {
+	return &probeCache{infos: map[any]Info{}}
+}
+
+var probes = newProbeCache()
+
+// Probe detects the Nix implementation and version that e runs, running
+// `nix --version` once per executor.
+func Probe(ctx context.Context, e exec.Executor) (Info, error) {
+	return probes.probe(ctx, e)
+}
+
+func (c *probeCache) probe(ctx context.Context, e exec.Executor) (Info, error) {
+	var key any = e
+	if e.IsLocal() {
+		key = "local"
+	}
+
+	c.mu.Lock()
+	info, ok := c.infos[key]
+	c.mu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	cmd, err := e.CommandContext(ctx, "nix", "--version")
+	if err != nil {
+		return Info{}, err
+	}
+	buf := &bytes.Buffer{}
+	cmd.SetStdout(buf)
+	if err := cmd.Run(); err != nil {
+		return Info{}, fmt.Errorf("failed to detect nix version: %w", err)
+	}
+
+	info, err = ParseInfo(buf.String())
+	if err != nil {
+		return Info{}, err
+	}
+	log.Debugf("Detected %s", info)
+
+	c.mu.Lock()
+	c.infos[key] = info
+	c.mu.Unlock()
+	return info, nil
+}
@@ -0,0 +1,166 @@
+package nix
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/exec"
+)
+
+func TestParseInfo(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Info
+		wantErr bool
+	}{
+		{in: "nix (Nix) 2.24.9\n", want: Info{CppNix, Version{2, 24, 9}}},
+		{in: "nix (Nix) 2.18.8", want: Info{CppNix, Version{2, 18, 8}}},
+		{in: "nix (Nix) 2.26.0pre20241217_dirty", want: Info{CppNix, Version{2, 26, 0}}},
+		{in: "nix (Determinate Nix 3.8.5) 2.30.2", want: Info{CppNix, Version{2, 30, 2}}},
+		{in: "nix (Lix, like Nix) 2.91.1", want: Info{Lix, Version{2, 91, 1}}},
+		{in: "nix (Lix, like Nix) 2.93.0-dev-pre20250301-abcdef0\nSystem type: x86_64-linux\n", want: Info{Lix, Version{2, 93, 0}}},
+		{in: "nix (Nix) 2.3", want: Info{CppNix, Version{2, 3, 0}}},
+		{in: "bash: nix: command not found", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseInfo(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfoCapabilities(t *testing.T) {
+	tests := []struct {
+		info      Info
+		supported bool
+		layout    PathInfoLayout
+	}{
+		{Info{CppNix, Version{2, 3, 18}}, false, PathInfoArray},
+		{Info{CppNix, Version{2, 8, 0}}, true, PathInfoArray},
+		{Info{CppNix, Version{2, 18, 8}}, true, PathInfoArray},
+		{Info{CppNix, Version{2, 19, 0}}, true, PathInfoObject},
+		{Info{CppNix, Version{3, 0, 0}}, true, PathInfoObject},
+		{Info{Lix, Version{2, 91, 1}}, true, PathInfoArray},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.info.String(), func(t *testing.T) {
+			if err := tt.info.Supported(); (err == nil) != tt.supported {
+				t.Errorf("Supported() = %v, want supported %v", err, tt.supported)
+			}
+			if got := tt.info.PathInfoLayout(); got != tt.layout {
+				t.Errorf("PathInfoLayout() = %v, want %v", got, tt.layout)
+			}
+		})
+	}
+}
+
+// versionExecutor answers `nix --version` with out and counts how often it
+// was asked.
+type versionExecutor struct {
+	out   string
+	err   error
+	local bool
+	runs  int
+}
+
+func (e *versionExecutor) Command(name string, args ...string) (exec.Command, error) {
+	return e.CommandContext(context.Background(), name, args...)
+}
+
+func (e *versionExecutor) CommandContext(context.Context, string, ...string) (exec.Command, error) {
+	e.runs++
+	return &versionCommand{e: e}, nil
+}
+
+func (e *versionExecutor) PathExists(string) (bool, error) { return false, nil }
+func (e *versionExecutor) IsLocal() bool                   { return e.local }
+
+type versionCommand struct {
+	e      *versionExecutor
+	stdout io.Writer
+}
+
+func (c *versionCommand) Run() error {
+	if c.e.err != nil {
+		return c.e.err
+	}
+	_, err := io.WriteString(c.stdout, c.e.out)
+	return err
+}
+
+func (c *versionCommand) Start() error          { return c.Run() }
+func (c *versionCommand) Wait() error           { return nil }
+func (c *versionCommand) SetStdin(io.Reader)    {}
+func (c *versionCommand) SetStdout(w io.Writer) { c.stdout = w }
+func (c *versionCommand) SetStderr(io.Writer)   {}
+func (c *versionCommand) StdinPipe() (io.WriteCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *versionCommand) StdoutPipe() (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *versionCommand) StderrPipe() (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestProbeCache(t *testing.T) {
+	cache := newProbeCache()
+	ctx := context.Background()
+
+	local := &versionExecutor{out: "nix (Nix) 2.24.9\n", local: true}
+	otherLocal := &versionExecutor{out: "nix (Nix) 2.24.9\n", local: true}
+	remote := &versionExecutor{out: "nix (Lix, like Nix) 2.91.1\n"}
+
+	for range 2 {
+		for _, e := range []*versionExecutor{local, otherLocal, remote} {
+			if _, err := cache.probe(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if local.runs+otherLocal.runs != 1 {
+		t.Errorf("expected local executors to share one probe, ran %d times", local.runs+otherLocal.runs)
+	}
+	if remote.runs != 1 {
+		t.Errorf("expected the remote executor to be probed once, ran %d times", remote.runs)
+	}
+
+	info, err := cache.probe(ctx, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Implementation != Lix {
+		t.Errorf("expected the remote to run Lix, got %s", info)
+	}
+}
+
+func TestProbeCacheRetriesFailures(t *testing.T) {
+	cache := newProbeCache()
+	e := &versionExecutor{err: errors.New("connection reset")}
+
+	if _, err := cache.probe(context.Background(), e); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	e.err = nil
+	e.out = "nix (Nix) 2.24.9"
+	if _, err := cache.probe(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.runs != 2 {
+		t.Errorf("expected a failed probe to be retried, ran %d times", e.runs)
+	}
+}
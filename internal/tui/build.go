@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"slices"
 	"strings"
 
@@ -18,11 +19,13 @@ import (
 type BuildReporter struct {
 	maxLines int
 	verbose  bool
+	logDir   string
 }
 
 func NewBuildReporter(mode ReporterMode) *BuildReporter {
 	reporter := &BuildReporter{
 		maxLines: listHardMax,
+		logDir:   defaultLogDir(),
 	}
 
 	switch mode {
@@ -37,7 +40,9 @@ func NewBuildReporter(mode ReporterMode) *BuildReporter {
 }
 
 func (r *BuildReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) error {
+	logs := newBuildLogs(r.logDir)
 	m := buildModel{
+		logs:              logs,
 		baseModel:         newBaseModel(r.maxLines, r.verbose, "Initializing build..."),
 		buildProgress:     progress{id: 0},
 		copyPathsProgress: progress{id: 0},
@@ -45,8 +50,17 @@ func (r *BuildReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) e
 		downloads:         map[int64]*copy{},
 		builds:            map[int64]*build{},
 		transfers:         map[int64]int64{},
+		substitutes:       map[int64]string{},
+		hooks:             map[int64]*hook{},
+		waiting:           map[int64]*waiting{},
 	}
-	return runTUIModel(ctx, m, decoder)
+	err := runTUIModel(ctx, m, decoder)
+
+	// Show the end of failed logs, which the progress view had no room for
+	logs.close()
+	logs.report(os.Stderr)
+
+	return err
 }
 
 func extractName(p string) string {
@@ -63,10 +77,17 @@ type buildModel struct {
 	downloads copies
 	transfers map[int64]int64
 	builds    map[int64]*build
+
+	// substitutes maps substitution activities to their binary cache
+	substitutes map[int64]string
+	hooks       map[int64]*hook
+	waiting     map[int64]*waiting
+
+	logs *buildLogs
 }
 
 func (m buildModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if cmd, handled := m.updateCommon(msg, len(m.builds)+len(m.downloads)); handled {
+	if cmd, handled := m.updateCommon(msg, m.activeCount()); handled {
 		return m, cmd
 	}
 	if ev, ok := msg.(nix.Event); ok {
@@ -75,13 +96,29 @@ func (m buildModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m buildModel) activeCount() int {
+	return len(m.builds) + len(m.hooks) + len(m.waiting) + len(m.downloads)
+}
+
+// activeItems lists builds, post-build-hooks, waits and then downloads, so
+// substitutions are kept apart from builds. Each group is newest first.
 func (m buildModel) activeItems() []item {
-	items := make([]item, 0, len(m.builds)+len(m.downloads))
-	for _, b := range m.builds {
-		items = append(items, b)
+	items := make([]item, 0, m.activeCount())
+	for _, group := range [][]item{
+		sortedItems(m.builds),
+		sortedItems(m.hooks),
+		sortedItems(m.waiting),
+		sortedItems(m.downloads),
+	} {
+		items = append(items, group...)
 	}
-	for _, d := range m.downloads {
-		items = append(items, d)
+	return items
+}
+
+func sortedItems[T item](active map[int64]T) []item {
+	items := make([]item, 0, len(active))
+	for _, i := range active {
+		items = append(items, i)
 	}
 	slices.SortFunc(items, func(a, b item) int {
 		return cmp.Compare(b.orderKey(), a.orderKey())
@@ -119,8 +156,12 @@ func (m buildModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		m.realiseProgress = transfer{id: ev.ID}
 		return m, nil
 
+	case nix.StartSubstituteEvent:
+		m.substitutes[ev.ID] = substituterHost(ev.Substituter)
+		return m, nil
+
 	case nix.StartCopyPathEvent:
-		m.downloads[ev.ID] = &copy{id: ev.ID, name: extractName(ev.Path)}
+		m.downloads[ev.ID] = &copy{id: ev.ID, name: extractName(ev.Path), source: m.substitutes[ev.Parent]}
 		if m.verbose {
 			return m, tea.Println(ev.Text)
 		}
@@ -135,6 +176,24 @@ func (m buildModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 
 	case nix.StartBuildEvent:
 		m.builds[ev.ID] = &build{id: ev.ID, name: strings.TrimSuffix(extractName(ev.Path), ".drv")}
+		m.logs.start(ev.ID, ev.Path)
+		return m, nil
+
+	case nix.StartPostBuildHookEvent:
+		m.hooks[ev.ID] = &hook{id: ev.ID, name: strings.TrimSuffix(extractName(ev.Path), ".drv")}
+		return m, nil
+
+	case nix.StartBuildWaitingEvent:
+		if ev.Text != "" {
+			m.waiting[ev.ID] = &waiting{id: ev.ID, text: ev.Text}
+		}
+		return m, nil
+
+	case nix.StartFetchTreeEvent:
+		// Fetching happens during evaluation, before there is any progress
+		if !m.initialized && ev.Text != "" {
+			m.lastMsg = ev.Text
+		}
 		return m, nil
 	}
 
@@ -143,19 +202,28 @@ func (m buildModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 
 func (m buildModel) handleStopEvent(ev nix.StopEvent) (tea.Model, tea.Cmd) {
 	delete(m.transfers, ev.ID)
+	delete(m.substitutes, ev.ID)
+	delete(m.waiting, ev.ID)
+	m.logs.stop(ev.ID)
 
 	if b, ok := m.builds[ev.ID]; ok {
 		m.list = m.list.add(b)
 		delete(m.builds, ev.ID)
 	}
 
+	if h, ok := m.hooks[ev.ID]; ok {
+		h.last = ""
+		m.list = m.list.add(h)
+		delete(m.hooks, ev.ID)
+	}
+
 	if d, ok := m.downloads[ev.ID]; ok {
 		m.realiseProgress.done += d.total
 		m.list = m.list.add(d)
 		delete(m.downloads, ev.ID)
 	}
 
-	if m.initialized && len(m.builds) < 1 && len(m.downloads) < 1 {
+	if m.initialized && m.activeCount() < 1 {
 		m.lastMsg = ""
 	}
 
@@ -202,7 +270,40 @@ func (m buildModel) handleResultEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+	case nix.ResultPostBuildLogLineEvent:
+		h, ok := m.hooks[ev.ID]
+		if !ok {
+			return m, nil
+		}
+		h.last = util.TrimSpaceAnsi(ev.Text)
+		if m.verbose {
+			return m, tea.Printf(
+				"%s %s",
+				lipgloss.NewStyle().
+					Foreground(lipgloss.Color("14")).
+					SetString(fmt.Sprintf("%s (post-build-hook)>", h.name)).
+					String(),
+				ev.Text,
+			)
+		}
+		return m, nil
+
+	case nix.ResultFetchStatusEvent:
+		if !m.initialized {
+			m.lastMsg = ev.Status
+		}
+		return m, nil
+
+	case nix.ResultUntrustedPathEvent:
+		m.err = errors.Join(m.err, untrustedPathError(ev.Path))
+		return m, nil
+
+	case nix.ResultCorruptedPathEvent:
+		m.err = errors.Join(m.err, corruptedPathError(ev.Path))
+		return m, nil
+
 	case nix.ResultBuildLogLineEvent:
+		m.logs.add(ev.ID, ev.Text)
 		if m.verbose {
 			if b, ok := m.builds[ev.ID]; ok {
 				return m, tea.Printf(
@@ -227,7 +328,8 @@ func (m buildModel) handleMessageEvent(ev nix.MessageEvent) (tea.Model, tea.Cmd)
 
 	// Level 0 errors that aren't trace warnings are actual errors
 	if ev.Level == nix.MsgLevelError && !isTraceWarning {
-		m.err = errors.Join(m.err, errors.New(ev.Text))
+		m.logs.failure(ev.Text)
+		m.err = errors.Join(m.err, errors.New(explain(ev.Text)))
 		return m, nil
 	}
 
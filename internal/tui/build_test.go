@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arnarg/nilla-utils/internal/nix"
+)
+
+func newTestBuildModel() buildModel {
+	return buildModel{
+		baseModel:   newBaseModel(listHardMax, false, ""),
+		downloads:   map[int64]*copy{},
+		builds:      map[int64]*build{},
+		transfers:   map[int64]int64{},
+		substitutes: map[int64]string{},
+		hooks:       map[int64]*hook{},
+		waiting:     map[int64]*waiting{},
+		logs:        newBuildLogs(""),
+	}
+}
+
+func feed(m buildModel, events ...nix.Event) buildModel {
+	for _, ev := range events {
+		next, _ := m.handleEvent(ev)
+		m = next.(buildModel)
+	}
+	return m
+}
+
+func TestBuildModelActivities(t *testing.T) {
+	m := feed(newTestBuildModel(),
+		nix.StartSubstituteEvent{ID: 2, Path: "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-zlib-1.3.1", Substituter: "https://cache.nixos.org"},
+		nix.StartCopyPathEvent{ID: 3, Parent: 2, Path: "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-zlib-1.3.1"},
+		nix.StartBuildEvent{ID: 4, Path: "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1.drv"},
+		nix.StartBuildWaitingEvent{ID: 5, Text: "waiting for lock on '/nix/store/cccc-firefox-130.0'"},
+		nix.StartPostBuildHookEvent{ID: 6, Path: "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1.drv"},
+		nix.ResultPostBuildLogLineEvent{ID: 6, Text: "copying 1 paths to s3://cache"},
+	)
+
+	var got []string
+	for _, i := range m.activeItems() {
+		got = append(got, i.String())
+	}
+	want := []string{
+		"hello-2.12.1",
+		"hello-2.12.1 [post-build-hook: copying 1 paths to s3://cache]",
+		"waiting for lock on '/nix/store/cccc-firefox-130.0'",
+		"zlib-1.3.1 from cache.nixos.org",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("active items = %q, want %q", got, want)
+	}
+	for i := range want {
+		// Muted parts are styled, compare the text only
+		if !strings.Contains(stripStyle(got[i]), want[i]) {
+			t.Errorf("active item %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	m = feed(m, nix.StopEvent{ID: 5}, nix.StopEvent{ID: 6})
+	if len(m.waiting) != 0 || len(m.hooks) != 0 {
+		t.Errorf("expected stopped waits and hooks to be removed, got %d and %d", len(m.waiting), len(m.hooks))
+	}
+}
+
+func TestBuildModelUntrusted(t *testing.T) {
+	m := feed(newTestBuildModel(),
+		nix.MessageEvent{Text: "error: cannot add path '/nix/store/bbbb-zlib-1.3.1' because it lacks a signature by a trusted key", Level: nix.MsgLevelError},
+	)
+	if m.err == nil || !strings.Contains(m.err.Error(), "trusted-users") {
+		t.Errorf("expected the error to be explained, got %v", m.err)
+	}
+
+	m = feed(newTestBuildModel(), nix.ResultUntrustedPathEvent{ID: 1, Path: "/nix/store/bbbb-zlib-1.3.1"})
+	if m.err == nil || !strings.Contains(m.err.Error(), "trusted-public-keys") {
+		t.Errorf("expected an explained untrusted path error, got %v", m.err)
+	}
+}
+
+// stripStyle removes ANSI escape sequences.
+func stripStyle(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
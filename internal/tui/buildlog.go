@@ -0,0 +1,200 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"charm.land/lipgloss/v2"
+	"charm.land/log/v2"
+)
+
+// failedLogLines is how many lines of a failed derivation's log are printed,
+// the same as the default of Nix's log-lines setting.
+const failedLogLines = 25
+
+// keptLogSessions is how many session log directories are kept below the
+// base directory, including the current one.
+const keptLogSessions = 10
+
+// failedDrvRe finds the derivation in the error Nix reports for a failed
+// builder, "builder for '<drv>' failed" or "Cannot build '<drv>'" in newer
+// versions. Failed dependencies are worded differently and do not match.
+var failedDrvRe = regexp.MustCompile(`(?:builder for|Cannot build) '(/nix/store/[^']+\.drv)'`)
+
+// buildLogs collects the build log lines of every derivation in a build. The
+// last failedLogLines lines of each are kept in memory, and full logs are
+// written to a session directory below baseDir when there is one, of which
+// the newest keptLogSessions are kept.
+type buildLogs struct {
+	baseDir string
+	dir     string
+
+	logs   map[int64]*buildLog
+	byPath map[string]*buildLog
+	failed []string
+}
+
+type buildLog struct {
+	name   string
+	base   string
+	lines  []string
+	file   *os.File
+	path   string
+	opened bool
+}
+
+func newBuildLogs(baseDir string) *buildLogs {
+	return &buildLogs{
+		baseDir: baseDir,
+		logs:    map[int64]*buildLog{},
+		byPath:  map[string]*buildLog{},
+	}
+}
+
+// defaultLogDir returns where session log directories are created, or an
+// empty string when there is no user cache directory.
+func defaultLogDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "nilla-utils", "logs")
+}
+
+// start begins the log of the build activity id of the derivation path.
+func (l *buildLogs) start(id int64, path string) {
+	base := strings.TrimSuffix(filepath.Base(path), ".drv")
+	b := &buildLog{name: strings.TrimSuffix(extractName(path), ".drv"), base: base}
+	l.logs[id] = b
+	l.byPath[path] = b
+}
+
+// add appends a line to the log of the build activity id.
+func (l *buildLogs) add(id int64, line string) {
+	b, ok := l.logs[id]
+	if !ok {
+		return
+	}
+
+	if len(b.lines) == failedLogLines {
+		b.lines = b.lines[1:]
+	}
+	b.lines = append(b.lines, line)
+
+	if !b.opened {
+		b.file = l.create(b.base)
+		if b.file != nil {
+			b.path = b.file.Name()
+		}
+		b.opened = true
+	}
+	if b.file != nil {
+		fmt.Fprintln(b.file, line)
+	}
+}
+
+// stop closes the log file of the build activity id, if it is one.
+func (l *buildLogs) stop(id int64) {
+	if b, ok := l.logs[id]; ok && b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+}
+
+// failure records the derivation named in a Nix error message as failed.
+func (l *buildLogs) failure(msg string) {
+	for _, m := range failedDrvRe.FindAllStringSubmatch(msg, -1) {
+		l.failed = append(l.failed, m[1])
+	}
+}
+
+// create opens the log file named base, creating the session directory
+// on first use and pruning old ones. Logs are only a convenience, so failing
+// to write them is logged and otherwise ignored.
+func (l *buildLogs) create(base string) *os.File {
+	if l.baseDir == "" {
+		return nil
+	}
+	if l.dir == "" {
+		if err := os.MkdirAll(l.baseDir, 0o755); err != nil {
+			log.Debugf("Could not create build log directory: %s", err)
+			l.baseDir = ""
+			return nil
+		}
+		dir, err := os.MkdirTemp(l.baseDir, time.Now().Format("20060102-150405")+"-*")
+		if err != nil {
+			log.Debugf("Could not create build log directory: %s", err)
+			l.baseDir = ""
+			return nil
+		}
+		l.dir = dir
+		pruneLogSessions(l.baseDir, keptLogSessions)
+	}
+
+	f, err := os.Create(filepath.Join(l.dir, base+".log"))
+	if err != nil {
+		log.Debugf("Could not create build log: %s", err)
+		return nil
+	}
+	return f
+}
+
+// close closes every log file still open. The logs of every derivation are
+// kept, old sessions are pruned when a new one starts.
+func (l *buildLogs) close() {
+	for id := range l.logs {
+		l.stop(id)
+	}
+}
+
+// pruneLogSessions removes all but the newest keep session directories in
+// baseDir. Their names start with the time they were created, so they sort
+// oldest first.
+func pruneLogSessions(baseDir string, keep int) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		log.Debugf("Could not list build log directories: %s", err)
+		return
+	}
+
+	var sessions []string
+	for _, e := range entries {
+		if e.IsDir() {
+			sessions = append(sessions, e.Name())
+		}
+	}
+	for len(sessions) > keep {
+		if err := os.RemoveAll(filepath.Join(baseDir, sessions[0])); err != nil {
+			log.Debugf("Could not remove build log directory: %s", err)
+		}
+		sessions = sessions[1:]
+	}
+}
+
+// report prints the end of the log of every failed derivation, followed by
+// where the full logs are.
+func (l *buildLogs) report(w io.Writer) {
+	for _, path := range l.failed {
+		b, ok := l.byPath[path]
+		if !ok || len(b.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "Last %d log lines of %s:\n", len(b.lines), b.name)
+		prefix := lipgloss.NewStyle().Foreground(lipgloss.Color("13")).Render(b.name + ">")
+		for _, line := range b.lines {
+			fmt.Fprintf(w, "%s %s\n", prefix, line)
+		}
+	}
+
+	if l.dir != "" {
+		fmt.Fprintf(w, "%s %s\n",
+			lipgloss.NewStyle().Bold(true).Render("Build logs:"),
+			l.dir,
+		)
+	}
+}
@@ -0,0 +1,144 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+const (
+	helloDrv = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1.drv"
+	zlibDrv  = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-zlib-1.3.1.drv"
+)
+
+func TestBuildLogs(t *testing.T) {
+	logs := newBuildLogs(t.TempDir())
+
+	logs.start(1, helloDrv)
+	logs.start(2, zlibDrv)
+	for i := range 30 {
+		logs.add(1, fmt.Sprintf("hello line %d", i))
+	}
+	logs.add(2, "zlib line")
+	logs.stop(2)
+	logs.failure("error: builder for '" + helloDrv + "' failed with exit code 2")
+	logs.close()
+
+	var out bytes.Buffer
+	logs.report(&out)
+	report := out.String()
+
+	for _, want := range []string{
+		"Last 25 log lines of hello-2.12.1:",
+		"hello line 5\n",
+		"hello line 29\n",
+		"Build logs:",
+		logs.dir,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+	for _, unwanted := range []string{"hello line 4\n", "zlib line"} {
+		if strings.Contains(report, unwanted) {
+			t.Errorf("report should not contain %q:\n%s", unwanted, report)
+		}
+	}
+
+	full, err := os.ReadFile(filepath.Join(logs.dir, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(full), "\n"); n != 30 {
+		t.Errorf("expected the full log of 30 lines, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(logs.dir, "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-zlib-1.3.1.log")); err != nil {
+		t.Errorf("expected the log of the successful build to be kept, got %v", err)
+	}
+}
+
+func TestBuildLogsSuccess(t *testing.T) {
+	logs := newBuildLogs(t.TempDir())
+	logs.start(1, helloDrv)
+	logs.add(1, "hello line")
+	logs.stop(1)
+	logs.close()
+
+	var out bytes.Buffer
+	logs.report(&out)
+	if strings.Contains(out.String(), "log lines of") {
+		t.Errorf("expected no log tail without failures:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Build logs:") {
+		t.Errorf("expected the log directory to be printed:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(logs.dir, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1.log")); err != nil {
+		t.Errorf("expected the log of the successful build to be kept, got %v", err)
+	}
+}
+
+func TestPruneLogSessions(t *testing.T) {
+	base := t.TempDir()
+	for _, name := range []string{"20250101-120000-1", "20250102-120000-2", "20250103-120000-3", "20250104-120000-4"} {
+		if err := os.MkdirAll(filepath.Join(base, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneLogSessions(base, 2)
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if diff := deep.Equal(got, []string{"20250103-120000-3", "20250104-120000-4"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestBuildLogsWithoutDirectory(t *testing.T) {
+	logs := newBuildLogs("")
+	logs.start(1, helloDrv)
+	logs.add(1, "hello line")
+	logs.failure("error: Cannot build '" + helloDrv + "'.\n       Reason: builder failed with exit code 2.")
+	logs.close()
+
+	var out bytes.Buffer
+	logs.report(&out)
+	if !strings.Contains(out.String(), "hello line") {
+		t.Errorf("expected the log tail without a log directory:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "Build logs:") {
+		t.Errorf("expected no log directory:\n%s", out.String())
+	}
+}
+
+func TestFailedDrvRe(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"error: builder for '" + helloDrv + "' failed with exit code 1", helloDrv},
+		{"error: Cannot build '" + helloDrv + "'.\n       Reason: builder failed with exit code 1.", helloDrv},
+		{"error: 1 dependencies of derivation '" + zlibDrv + "' failed to build", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if m := failedDrvRe.FindStringSubmatch(tt.msg); m != nil {
+			got = m[1]
+		}
+		if got != tt.want {
+			t.Errorf("failedDrvRe on %q = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,30 @@ package tui
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"charm.land/bubbles/v2/textinput"
 	tea "charm.land/bubbletea/v2"
 )
 
+// WhyFunc explains why a package is part of the change being confirmed.
+type WhyFunc func(pkg string) (string, error)
+
+type whyResultMsg struct {
+	pkg string
+	out string
+	err error
+}
+
 type confirmModel struct {
 	message string
 	done    bool
 	answer  bool
+
+	why     WhyFunc
+	asking  bool
+	running bool
+	input   textinput.Model
 }
 
 func (m confirmModel) Init() tea.Cmd {
@@ -19,11 +35,32 @@ func (m confirmModel) Init() tea.Cmd {
 
 func (m confirmModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case whyResultMsg:
+		m.running = false
+		if msg.err != nil {
+			return m, tea.Printf("Could not explain %s: %s", msg.pkg, msg.err)
+		}
+		return m, tea.Printf("Why %s is in the closure:\n%s", msg.pkg, strings.TrimRight(msg.out, "\n"))
+
 	case tea.KeyPressMsg:
+		if m.running {
+			return m, nil
+		}
+		if m.asking {
+			return m.updateAsking(msg)
+		}
 		switch msg.String() {
 		case "y":
 			m.done = true
 			m.answer = true
+		case "w":
+			if m.why != nil {
+				m.asking = true
+				m.input.Reset()
+				return m, m.input.Focus()
+			}
+			m.done = true
+			m.answer = false
 		default:
 			m.done = true
 			m.answer = false
@@ -34,18 +71,63 @@ func (m confirmModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m confirmModel) updateAsking(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.asking = false
+		return m, nil
+	case "enter":
+		m.asking = false
+		pkg := strings.TrimSpace(m.input.Value())
+		if pkg == "" {
+			return m, nil
+		}
+		m.running = true
+		why := m.why
+		return m, func() tea.Msg {
+			out, err := why(pkg)
+			return whyResultMsg{pkg: pkg, out: out, err: err}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
 func (m confirmModel) View() tea.View {
 	if m.done {
 		return tea.NewView("")
 	}
+	if m.running {
+		return tea.NewView(fmt.Sprintf("\nLooking up %s...", strings.TrimSpace(m.input.Value())))
+	}
+	if m.asking {
+		return tea.NewView("\n" + m.input.View())
+	}
+	if m.why != nil {
+		return tea.NewView(fmt.Sprintf("\n%s [y/n, w: why is a package included]", m.message))
+	}
 
 	return tea.NewView(fmt.Sprintf("\n%s [y/n]", m.message))
 }
 
 func RunConfirm(msg string) (bool, error) {
+	return RunConfirmWhy(msg, nil)
+}
+
+// RunConfirmWhy asks for confirmation like RunConfirm. When why is set,
+// pressing w prompts for a package name and prints why explains about it
+// before asking again.
+func RunConfirmWhy(msg string, why WhyFunc) (bool, error) {
+	input := textinput.New()
+	input.Prompt = "Package: "
+
 	// Initialize model
 	init := confirmModel{
 		message: msg,
+		why:     why,
+		input:   input,
 	}
 
 	// Create a bubbletea program
@@ -176,13 +176,19 @@ func (m copyModel) handleResultEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 			m.transferProgress.expected = ev.Expected
 			return m, nil
 		}
+
+	case nix.ResultUntrustedPathEvent:
+		m.err = errors.Join(m.err, untrustedPathError(ev.Path))
+
+	case nix.ResultCorruptedPathEvent:
+		m.err = errors.Join(m.err, corruptedPathError(ev.Path))
 	}
 	return m, nil
 }
 
 func (m copyModel) handleMessageEvent(ev nix.MessageEvent) (tea.Model, tea.Cmd) {
 	if ev.Level == nix.MsgLevelError {
-		m.err = errors.New(ev.Text)
+		m.err = errors.New(explain(ev.Text))
 		return m, nil
 	}
 
@@ -0,0 +1,43 @@
+package tui
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// untrustedHint explains why a store refuses paths, which Nix itself leaves
+// to the reader.
+const untrustedHint = `The receiving store only accepts paths signed by a key in its trusted-public-keys,
+or paths copied by one of its trusted-users. Add the deploying user to
+nix.settings.trusted-users on that host, or sign the paths with "nix store sign"
+and add the public key to its nix.settings.trusted-public-keys.`
+
+// untrustedRe matches the errors of stores refusing unsigned paths.
+var untrustedRe = regexp.MustCompile(`lacks a (valid )?signature`)
+
+// explain appends an explanation to Nix errors that need one.
+func explain(text string) string {
+	if untrustedRe.MatchString(text) {
+		return text + "\n" + untrustedHint
+	}
+	return text
+}
+
+func untrustedPathError(path string) error {
+	return fmt.Errorf("path '%s' is not signed by a trusted key\n%s", path, untrustedHint)
+}
+
+func corruptedPathError(path string) error {
+	return fmt.Errorf("path '%s' does not match its hash and may be corrupted", path)
+}
+
+// substituterHost shortens a substituter URI like https://cache.nixos.org to
+// its host for display.
+func substituterHost(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+	return u.Host
+}
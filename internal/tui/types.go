@@ -74,23 +74,60 @@ func (b *build) String() string {
 	return b.name
 }
 
+// copy is a path being copied. Source is the binary cache it is substituted
+// from, if it is.
 type copy struct {
-	id    int64
-	name  string
-	done  int64
-	total int64
+	id     int64
+	name   string
+	source string
+	done   int64
+	total  int64
 }
 
 func (c *copy) orderKey() int64 { return c.id }
 
 func (c *copy) String() string {
+	s := c.name
 	if c.total > 0 {
 		total, unit := util.ConvertBytes(c.total)
 		done := util.ConvertBytesToUnit(c.done, unit)
 
-		return fmt.Sprintf("%s [%.2f/%.2f %s]", c.name, done, total, unit)
+		s = fmt.Sprintf("%s [%.2f/%.2f %s]", c.name, done, total, unit)
+	}
+	if c.source != "" {
+		s += overflowStyle.Render(" from " + c.source)
+	}
+	return s
+}
+
+// hook is a post-build-hook running for a derivation, usually uploading its
+// outputs, with the last line it printed.
+type hook struct {
+	id   int64
+	name string
+	last string
+}
+
+func (h *hook) orderKey() int64 { return h.id }
+
+func (h *hook) String() string {
+	if h.last != "" {
+		return fmt.Sprintf("%s [post-build-hook: %s]", h.name, h.last)
 	}
-	return c.name
+	return fmt.Sprintf("%s [post-build-hook]", h.name)
+}
+
+// waiting is Nix waiting for a lock on an output path or for a remote
+// builder.
+type waiting struct {
+	id   int64
+	text string
+}
+
+func (w *waiting) orderKey() int64 { return w.id }
+
+func (w *waiting) String() string {
+	return overflowStyle.Render(w.text)
 }
 
 type copies map[int64]*copy
@@ -9,6 +9,15 @@ let
     ;
 
   globalModules = config.modules;
+
+  # Record pinned inputs in the generation as nilla-inputs.json
+  inputsModule =
+    { pkgs, ... }:
+    {
+      home.extraBuilderCommands = ''
+        ln -s ${pkgs.writeText "nilla-inputs.json" (import ./inputs-lock.nix inputs)} $out/nilla-inputs.json
+      '';
+    };
 in
 {
   includes = [
@@ -30,6 +39,12 @@ in
                 default.value = { };
               };
 
+              target = lib.options.create {
+                description = "The SSH target (e.g. `user@host`) this system is deployed to. Used by `generations --all-targets`.";
+                type = lib.types.nullish lib.types.string;
+                default.value = null;
+              };
+
               system = lib.options.create {
                 description = "The system of pkgs to use.";
                 type = lib.types.string;
@@ -95,7 +110,7 @@ in
                   builder {
                     pkgs = config.pkgs;
                     lib = config.pkgs.lib;
-                    modules = config.modules;
+                    modules = config.modules ++ [ inputsModule ];
                     extraSpecialArgs = {
                       homeModules = if globalModules ? "home" then globalModules.home else { };
                     }
@@ -0,0 +1,36 @@
+# Describes the pinned inputs as JSON. Built systems record this as
+# nilla-inputs.json so a deploy can show which inputs changed.
+inputs:
+let
+  fields = [
+    "type"
+    "repository"
+    "branch"
+    "revision"
+    "version"
+    "url"
+    "lastModified"
+  ];
+
+  wanted = builtins.listToAttrs (
+    map (name: {
+      inherit name;
+      value = null;
+    }) fields
+  );
+
+  # Only the lock metadata is read. The outPath of a pin is never touched, as
+  # that would fetch every input, used by the configuration or not.
+  describe = input: builtins.intersectAttrs wanted input.src;
+
+  # Only pins carry a revision or url, plain paths have nothing to compare
+  isPinned = input: input ? src && (input.src ? revision || input.src ? url);
+
+  pinned = builtins.removeAttrs inputs (
+    builtins.filter (name: !(isPinned inputs.${name})) (builtins.attrNames inputs)
+  );
+in
+builtins.toJSON {
+  version = 1;
+  inputs = builtins.mapAttrs (_: describe) pinned;
+}
@@ -1,7 +1,12 @@
-# NixOS module to add options generateRegistryFromInputs
-# and generateNixPathFromInputs.
+# NixOS module to add options generateRegistryFromInputs,
+# generateNixPathFromInputs and recordInputs.
 inputs:
-{ config, lib, ... }:
+{
+  config,
+  lib,
+  pkgs,
+  ...
+}:
 let
   nillaExtras =
     if inputs ? nilla && inputs.nilla ? src then
@@ -29,6 +34,11 @@ in
       default = false;
       description = "Automatically add all inputs to $NIX_PATH.";
     };
+    recordInputs = lib.mkOption {
+      type = lib.types.bool;
+      default = true;
+      description = "Record the revisions of all pinned inputs in the system, so deploys can show which changed.";
+    };
   };
 
   config = {
@@ -60,5 +70,10 @@ in
       # Add /etc/nix/inputs to NIX_PATH
       nixPath = lib.optionals (config.nix.generateNixPathFromInputs) [ "/etc/nix/inputs" ];
     };
+
+    # Record pinned inputs in the toplevel as nilla-inputs.json
+    system.extraSystemBuilderCmds = lib.mkIf (config.nix.recordInputs) ''
+      ln -s ${pkgs.writeText "nilla-inputs.json" (import ./inputs-lock.nix inputs)} $out/nilla-inputs.json
+    '';
   };
 }
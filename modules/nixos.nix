@@ -27,6 +27,12 @@ in
                 default.value = { };
               };
 
+              target = lib.options.create {
+                description = "The SSH target (e.g. `user@host`) this system is deployed to. Used by `generations --all-targets`.";
+                type = lib.types.nullish lib.types.string;
+                default.value = null;
+              };
+
               system = lib.options.create {
                 description = ''
                   The hostPlatform of the host. The NixOS option `nixpkgs.hostPlatform` in a NixOS module takes precedence over this.